@@ -0,0 +1,27 @@
+// Package builtin registers the checkers, storages and
+// notifiers shipped with checkup. Programs using checkup
+// as a library import it for its side effects:
+//
+//	import _ "github.com/feifeigood/checkup/builtin"
+package builtin
+
+import (
+	// checkers
+	_ "github.com/feifeigood/checkup/check/dns"
+	_ "github.com/feifeigood/checkup/check/exec"
+	_ "github.com/feifeigood/checkup/check/grpc"
+	_ "github.com/feifeigood/checkup/check/http"
+	_ "github.com/feifeigood/checkup/check/httpflow"
+	_ "github.com/feifeigood/checkup/check/icmp"
+	_ "github.com/feifeigood/checkup/check/mail"
+	_ "github.com/feifeigood/checkup/check/tcp"
+	_ "github.com/feifeigood/checkup/check/tls"
+	_ "github.com/feifeigood/checkup/check/udp"
+	_ "github.com/feifeigood/checkup/check/websocket"
+
+	// storages
+	_ "github.com/feifeigood/checkup/storage/fs"
+
+	// notifiers
+	_ "github.com/feifeigood/checkup/notifier/mail"
+)
@@ -0,0 +1,49 @@
+package builtin
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/feifeigood/checkup"
+)
+
+func TestValidate(t *testing.T) {
+	config, err := ioutil.ReadFile("../testdata/config.json")
+	if err != nil {
+		t.Fatalf("Cannot read config: %v", err)
+	}
+	if err := checkup.Validate(config); err != nil {
+		t.Errorf("Expected testdata/config.json to be valid, got %v", err)
+	}
+
+	err = checkup.Validate([]byte(`{
+		"checkers": [
+			{"type": "http", "endpoint_name": "Web", "endpoint_url": "ftp://example.com", "attempts": -1},
+			{"type": "tcp", "endpoint_name": "TCP", "endpoint_url": "example.com"},
+			{"type": "dns", "endpoint_name": "DNS", "endpoint_url": "1.1.1.1", "hostname_fqdn": "example.com", "transport": "quic"},
+			{"type": "exec", "name": "Exec"},
+			{"type": "icmp", "endpoint_name": "ICMP", "endpoint_url": "127.0.0.1", "count": -1},
+			{"type": "tls", "endpoint_name": "TLS", "endpoint_url": "example.com:443", "warning_days": 3}
+		],
+		"storage": {"type": "fs"},
+		"notifiers": [{"type": "mail", "from": "checkup@example.com", "to": ["ops@example.com"], "smtp": {}}]
+	}`))
+	want := []string{
+		"checkers[0].attempts: must not be negative",
+		"checkers[0].endpoint_url: scheme must be http or https",
+		"checkers[1].endpoint_url: address example.com: missing port in address",
+		`checkers[2].transport: unsupported transport "quic"`,
+		"checkers[3].command: must not be empty",
+		"checkers[4].count: must not be negative",
+		"checkers[5].critical_days: must not exceed warning_days (3)",
+		"storage.dir: must not be empty",
+		"notifiers[0].smtp.server: must not be empty",
+	}
+	if err == nil {
+		t.Fatalf("Expected errors")
+	}
+	if got := strings.Split(err.Error(), "; "); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -1,14 +1,21 @@
 package dns
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
 
+	"github.com/feifeigood/checkup"
 	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
 	"github.com/feifeigood/checkup/prometheus/metric"
 	"github.com/feifeigood/checkup/types"
@@ -17,34 +24,107 @@ import (
 // Type should match the package name
 const Type = "dns"
 
+// Transports supported by the Checker.
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+	TransportTLS = "tcp-tls"
+)
+
 var (
 	log = logrus.WithField("component", "dns")
+
+	// queryTypes are the record types which may be queried.
+	queryTypes = map[string]uint16{
+		"A":     dns.TypeA,
+		"AAAA":  dns.TypeAAAA,
+		"CNAME": dns.TypeCNAME,
+		"MX":    dns.TypeMX,
+		"TXT":   dns.TypeTXT,
+		"SRV":   dns.TypeSRV,
+		"NS":    dns.TypeNS,
+		"SOA":   dns.TypeSOA,
+	}
 )
 
-// Checker implements a Checker for TCP endpoints.
+// Checker implements a Checker for DNS servers.
 type Checker struct {
 	// Name is the name of the endpoint.
 	Name string `json:"endpoint_name"`
-	// This is the name of the DNS server you are testing.
+
+	// This is the address of the DNS server you are testing.
+	// If no port is given, 53 is used (853 for DNS-over-TLS).
 	URL string `json:"endpoint_url"`
+
 	// This is the fqdn of the target server to query the DNS server for.
 	Host string `json:"hostname_fqdn,omitempty"`
+
+	// QueryType is the record type to query for, one of
+	// A, AAAA, CNAME, MX, TXT, SRV, NS or SOA. Default is A.
+	QueryType string `json:"query_type,omitempty"`
+
+	// Transport is the protocol used to talk to the server,
+	// one of udp, tcp or tcp-tls (DNS-over-TLS). Default is udp.
+	Transport string `json:"transport,omitempty"`
+
+	// TLSServerName overrides the name used to verify the
+	// server certificate when Transport is tcp-tls.
+	TLSServerName string `json:"tls_server_name,omitempty"`
+
+	// TLSSkipVerify controls whether to skip server TLS
+	// certificate validation when Transport is tcp-tls.
+	TLSSkipVerify bool `json:"tls_skip_verify,omitempty"`
+
+	// ExpectRcode is the response code expected from a
+	// healthy server, e.g. NOERROR or NXDOMAIN. Default
+	// is NOERROR.
+	ExpectRcode string `json:"expect_rcode,omitempty"`
+
+	// ExpectAnswers is the exact set of answers (in any
+	// order) a healthy server returns for the query, e.g.
+	// "192.0.2.1" for A or "10 mx.example.com." for MX.
+	ExpectAnswers []string `json:"expect_answers,omitempty"`
+
+	// ExpectAnswersMatch is a list of regular expressions.
+	// If set, the response must contain answers and every
+	// answer must match at least one of them.
+	ExpectAnswersMatch []string `json:"expect_answers_match,omitempty"`
+
+	// MinTTL is the lowest TTL allowed on any answer.
+	MinTTL types.Duration `json:"min_ttl,omitempty"`
+
+	// ExpectAuthenticatedData requires the AD (DNSSEC
+	// authenticated data) flag to be set on the response.
+	ExpectAuthenticatedData bool `json:"expect_authenticated_data,omitempty"`
+
 	// Timeout is the maximum time to wait for a
-	// TCP connection to be established.
-	Timeout time.Duration `json:"timeout,omitempty"`
+	// single attempt to complete. Default is 1s.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
 	// ThresholdRTT is the maximum round trip time to
 	// allow for a healthy endpoint. If non-zero and a
 	// request takes longer than ThresholdRTT, the
 	// endpoint will be considered unhealthy. Note that
 	// this duration includes any in-between network
 	// latency.
-	ThresholdRTT time.Duration `json:"threshold_rtt,omitempty"`
+	ThresholdRTT types.Duration `json:"threshold_rtt,omitempty"`
+
 	// Attempts is how many requests the client will
 	// make to the endpoint in a single check.
 	Attempts int `json:"attempts,omitempty"`
 
+	// Every override every subcommand interval If set.
+	Every types.Duration `json:"every,omitempty"`
+
 	//
 	metrics []metric.Metric
+	answers []dns.RR
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
 }
 
 // New creates a new Checker instance based on json config
@@ -59,101 +139,332 @@ func (c *Checker) Type() string {
 	return Type
 }
 
+// GetEvery returns the checker specified check interval to override every subcommand
+func (c *Checker) GetEvery() time.Duration {
+	return c.Every.Duration
+}
+
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	}
+	if c.Host == "" {
+		errs = append(errs, types.NewValidationError("hostname_fqdn", "must not be empty"))
+	}
+	if _, ok := queryTypes[strings.ToUpper(c.QueryType)]; c.QueryType != "" && !ok {
+		errs = append(errs, types.NewValidationError("query_type", "unsupported query type %q", c.QueryType))
+	}
+	if _, err := c.client(); err != nil {
+		errs = append(errs, types.NewValidationError("transport", "unsupported transport %q", c.Transport))
+	}
+	if _, err := c.expectRcode(); err != nil {
+		errs = append(errs, types.NewValidationError("expect_rcode", "unknown rcode %q", c.ExpectRcode))
+	}
+	for i, expr := range c.ExpectAnswersMatch {
+		if _, err := regexp.Compile(expr); err != nil {
+			errs = append(errs, types.NewValidationError(fmt.Sprintf("expect_answers_match[%d]", i), "%v", err))
+		}
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":         c.Every.Duration,
+		"timeout":       c.Timeout.Duration,
+		"threshold_rtt": c.ThresholdRTT.Duration,
+		"min_ttl":       c.MinTTL.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
 // Check performs checks using c according to its configuration.
 // An error is only returned if there is a configuration error.
-func (c *Checker) Check() (types.Result, error) {
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
 	if c.Attempts < 1 {
 		c.Attempts = 1
 	}
 
 	result := types.NewResult()
+	result.Type = c.Type()
 	result.Title = c.Name
 	result.Endpoint = c.URL
-	result.Times = c.doChecks()
+
+	msg, err := c.message()
+	if err != nil {
+		return result, err
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return result, err
+	}
+
+	expectRcode, err := c.expectRcode()
+	if err != nil {
+		return result, err
+	}
+
+	matchers := make([]*regexp.Regexp, len(c.ExpectAnswersMatch))
+	for i, expr := range c.ExpectAnswersMatch {
+		if matchers[i], err = regexp.Compile(expr); err != nil {
+			return result, fmt.Errorf("invalid expect_answers_match %q: %w", expr, err)
+		}
+	}
+
+	result.Times = c.doChecks(ctx, client, msg, expectRcode, matchers)
 
 	return c.conclude(result), nil
 }
 
-// doChecks executes and returns each attempt.
-func (c *Checker) doChecks() types.Attempts {
-	var conn net.Conn
+// message builds the query message according to c.
+func (c *Checker) message() (*dns.Msg, error) {
+	if c.Host == "" {
+		return nil, fmt.Errorf("no hostname_fqdn to query")
+	}
+
+	qtype := dns.TypeA
+	if c.QueryType != "" {
+		var ok bool
+		if qtype, ok = queryTypes[strings.ToUpper(c.QueryType)]; !ok {
+			return nil, fmt.Errorf("unsupported query_type: %s", c.QueryType)
+		}
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(c.Host), qtype)
+	msg.RecursionDesired = true
+	// Setting AD on a query asks the server to report whether
+	// the response was validated (RFC 6840, section 5.7).
+	msg.AuthenticatedData = c.ExpectAuthenticatedData
+
+	return msg, nil
+}
+
+// client builds the dns.Client for the configured transport.
+func (c *Checker) client() (*dns.Client, error) {
+	client := new(dns.Client)
+
+	switch strings.ToLower(c.Transport) {
+	case "", TransportUDP:
+		client.Net = TransportUDP
+	case TransportTCP:
+		client.Net = TransportTCP
+	case TransportTLS:
+		client.Net = TransportTLS
+		client.TLSConfig = &tls.Config{
+			ServerName:         c.TLSServerName,
+			InsecureSkipVerify: c.TLSSkipVerify,
+		}
+		if client.TLSConfig.ServerName == "" {
+			if host, _, err := net.SplitHostPort(c.address()); err == nil {
+				client.TLSConfig.ServerName = host
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported transport: %s", c.Transport)
+	}
+
+	return client, nil
+}
 
-	timeout := c.Timeout
+// address returns c.URL with the default port for the
+// transport added if it has none.
+func (c *Checker) address() string {
+	if _, _, err := net.SplitHostPort(c.URL); err == nil {
+		return c.URL
+	}
+	port := "53"
+	if strings.ToLower(c.Transport) == TransportTLS {
+		port = "853"
+	}
+	return net.JoinHostPort(strings.Trim(c.URL, "[]"), port)
+}
+
+// expectRcode returns the expected response code.
+func (c *Checker) expectRcode() (int, error) {
+	if c.ExpectRcode == "" {
+		return dns.RcodeSuccess, nil
+	}
+	rcode, ok := dns.StringToRcode[strings.ToUpper(c.ExpectRcode)]
+	if !ok {
+		return 0, fmt.Errorf("unknown expect_rcode: %s", c.ExpectRcode)
+	}
+	return rcode, nil
+}
+
+// doChecks executes and returns each attempt.
+func (c *Checker) doChecks(ctx context.Context, client *dns.Client, msg *dns.Msg, expectRcode int, matchers []*regexp.Regexp) types.Attempts {
+	timeout := c.Timeout.Duration
 	if timeout == 0 {
 		timeout = time.Second
 	}
 
 	checks := make(types.Attempts, c.Attempts)
 	for i := 0; i < c.Attempts; i++ {
-		var err error
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+
 		start := time.Now()
+		resp, _, err := client.ExchangeContext(attemptCtx, msg.Copy(), c.address())
+		checks[i].RTT = time.Since(start)
+		cancel()
 
-		if c.Host != "" {
-			hostname := c.Host
-			m1 := new(dns.Msg)
-			m1.Id = dns.Id()
-			m1.RecursionDesired = true
-			m1.Question = make([]dns.Question, 1)
-			m1.Question[0] = dns.Question{Name: hostname, Qtype: dns.TypeA, Qclass: dns.ClassINET}
-			d := new(dns.Client)
-			_, _, err := d.Exchange(m1, c.URL)
-			if err != nil {
-				checks[i].Error = err.Error()
-				continue
-			}
+		if err != nil {
+			checks[i].Error = err.Error()
+			continue
 		}
-		if conn, err = net.DialTimeout("tcp", c.URL, timeout); err != nil {
+
+		if err := c.checkDown(resp, msg.Question[0].Qtype, expectRcode, matchers); err != nil {
 			checks[i].Error = err.Error()
-		} else {
-			conn.Close()
 		}
-		checks[i].RTT = time.Since(start)
 	}
 	return checks
 }
 
+// checkDown checks whether the server is down based on resp to
+// a query of type qtype and the configuration of c. It returns
+// a non-nil error if down. Note that it does not check for
+// degraded response.
+func (c *Checker) checkDown(resp *dns.Msg, qtype uint16, expectRcode int, matchers []*regexp.Regexp) error {
+	if resp.Rcode != expectRcode {
+		return fmt.Errorf("response rcode %s, expected %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[expectRcode])
+	}
+
+	if c.ExpectAuthenticatedData && !resp.AuthenticatedData {
+		return fmt.Errorf("response is not authenticated (AD flag not set)")
+	}
+
+	var answers []dns.RR
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == qtype {
+			answers = append(answers, rr)
+		}
+	}
+	c.answers = answers
+
+	values := make([]string, len(answers))
+	for i, rr := range answers {
+		values[i] = answerValue(rr)
+	}
+
+	if len(c.ExpectAnswers) > 0 && !sameSet(values, c.ExpectAnswers) {
+		return fmt.Errorf("answers [%s], expected [%s]", strings.Join(values, ", "), strings.Join(c.ExpectAnswers, ", "))
+	}
+
+	if len(matchers) > 0 {
+		if len(values) == 0 {
+			return fmt.Errorf("no %s answers", dns.TypeToString[qtype])
+		}
+		for _, value := range values {
+			if !matchAny(matchers, value) {
+				return fmt.Errorf("answer '%s' does not match any of expect_answers_match", value)
+			}
+		}
+	}
+
+	if c.MinTTL.Duration > 0 {
+		for _, rr := range answers {
+			ttl := time.Duration(rr.Header().Ttl) * time.Second
+			if ttl < c.MinTTL.Duration {
+				return fmt.Errorf("answer '%s' TTL %s is lower than %s", answerValue(rr), ttl, c.MinTTL)
+			}
+		}
+	}
+
+	return nil
+}
+
+// answerValue renders the data of rr without its header.
+func answerValue(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	case *dns.CNAME:
+		return rr.Target
+	case *dns.NS:
+		return rr.Ns
+	case *dns.MX:
+		return strconv.Itoa(int(rr.Preference)) + " " + rr.Mx
+	case *dns.TXT:
+		return strings.Join(rr.Txt, "")
+	case *dns.SRV:
+		return fmt.Sprintf("%d %d %d %s", rr.Priority, rr.Weight, rr.Port, rr.Target)
+	}
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// sameSet reports whether a and b hold the same values, in any order.
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(matchers []*regexp.Regexp, s string) bool {
+	for _, re := range matchers {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
 // conclude takes the data in result from the attempts and
 // computes remaining values needed to fill out the result.
 // It detects degraded (high-latency) responses and makes
 // the conclusion about the result's status.
 func (c *Checker) conclude(result types.Result) types.Result {
-	result.ThresholdRTT = c.ThresholdRTT
+	result.ThresholdRTT = c.ThresholdRTT.Duration
+
+	for _, rr := range c.answers {
+		m, _ := metric.New(
+			"checkup_dns",
+			map[string]string{
+				"title":    result.Title,
+				"endpoint": result.Endpoint,
+				"host":     c.Host,
+				"rrtype":   dns.TypeToString[rr.Header().Rrtype],
+				"answer":   answerValue(rr),
+			}, map[string]interface{}{
+				"answer_ttl_seconds": rr.Header().Ttl,
+			}, time.Now(), metric.Gauge,
+		)
+		c.metrics = append(c.metrics, m)
+	}
+	c.answers = nil
 
 	// Check errors (down)
 	for i := range result.Times {
 		if result.Times[i].Error != "" {
 			result.Down = true
-			m, _ := metric.New(
-				"checkup_dns",
-				map[string]string{
-					"title":    result.Title,
-					"endpoint": result.Endpoint,
-					"host":     c.Host,
-				}, map[string]interface{}{
-					"healthy": 0,
-				}, time.Now(), metric.Gauge,
-			)
-			c.metrics = append(c.metrics, m)
 			return result
 		}
 	}
 
-	m, _ := metric.New(
-		"checkup_dns",
-		map[string]string{
-			"title":    result.Title,
-			"endpoint": result.Endpoint,
-			"host":     c.Host,
-		}, map[string]interface{}{
-			"healthy": 1,
-		}, time.Now(), metric.Gauge,
-	)
-	c.metrics = append(c.metrics, m)
-
 	// Check round trip time (degraded)
-	if c.ThresholdRTT > 0 {
+	if c.ThresholdRTT.Duration > 0 {
 		stats := result.ComputeStats()
-		if stats.Median > c.ThresholdRTT {
+		if stats.Median > c.ThresholdRTT.Duration {
 			result.Notice = fmt.Sprintf("median round trip time exceeded threshold (%s)", c.ThresholdRTT)
 			result.Degraded = true
 			return result
@@ -1,54 +1,112 @@
 package dns
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
 	"net"
 	"testing"
 	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/feifeigood/checkup/types"
 )
 
-func TestChecker(t *testing.T) {
-	// Listen on localhost, random port
-	srv, err := net.Listen("tcp", "localhost:8382")
-	if err != nil {
-		t.Errorf("Couldn't start TCP test server with error: %v", err)
-	}
-	defer srv.Close()
-
-	// Accept a future connection
-	go func() {
-		for {
-			conn, err := srv.Accept()
-			if err != nil {
-				break
-			}
-			conn.Close()
+var testZone = map[uint16][]string{
+	dns.TypeA:   {"example.org. 300 IN A 192.0.2.1", "example.org. 300 IN A 192.0.2.2"},
+	dns.TypeMX:  {"example.org. 60 IN MX 10 mx.example.org."},
+	dns.TypeTXT: {`example.org. 300 IN TXT "v=spf1 -all"`},
+}
+
+// testHandler answers queries for example.org. from testZone,
+// setting the AD flag when the query asked for it. Queries for
+// no-question.example.org. are answered the same, without a
+// question section.
+func testHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.AuthenticatedData = r.AuthenticatedData
+
+	q := r.Question[0]
+	if q.Name == "no-question.example.org." {
+		m.Question = nil
+	} else if q.Name != "example.org." {
+		m.Rcode = dns.RcodeNameError
+		w.WriteMsg(m)
+		return
+	}
+	for _, s := range testZone[q.Qtype] {
+		rr, _ := dns.NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+	w.WriteMsg(m)
+}
+
+// startServer starts an in-process DNS server for the
+// network and returns its address.
+func startServer(t *testing.T, network string, tlsConfig *tls.Config) (string, func()) {
+	started := make(chan struct{})
+	srv := &dns.Server{
+		Handler:           dns.HandlerFunc(testHandler),
+		NotifyStartedFunc: func() { close(started) },
+	}
+
+	var addr string
+	switch network {
+	case "udp":
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Couldn't start UDP test server with error: %v", err)
+		}
+		srv.PacketConn = pc
+		addr = pc.LocalAddr().String()
+	default:
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Couldn't start TCP test server with error: %v", err)
 		}
-	}()
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		srv.Listener = l
+		addr = l.Addr().String()
+	}
+
+	go srv.ActivateAndServe()
+	<-started
+
+	return addr, func() { srv.Shutdown() }
+}
+
+func TestChecker(t *testing.T) {
+	endpt, shutdown := startServer(t, "udp", nil)
 
-	// Should know the host:port by now
-	endpt := srv.Addr().String()
 	testName := "TestDNS"
-	hc := Checker{Name: testName, URL: endpt, Attempts: 2}
+	hc := Checker{Name: testName, URL: endpt, Host: "example.org", Attempts: 2}
 
 	// Try an up server
-	result, err := hc.Check()
+	result, err := hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
+	if got, want := result.Type, Type; got != want {
+		t.Errorf("Expected result.Type='%s', got '%s'", want, got)
+	}
 	if got, want := result.Title, testName; got != want {
 		t.Errorf("Expected result.Title='%s', got '%s'", want, got)
 	}
 	if got, want := result.Endpoint, endpt; got != want {
 		t.Errorf("Expected result.Endpoint='%s', got '%s'", want, got)
 	}
-	if got, want := result.Down, false; got != want {
-		t.Errorf("Expected result.Down=%v, got %v", want, got)
-	}
-	if got, want := result.Degraded, false; got != want {
-		t.Errorf("Expected result.Degraded=%v, got %v", want, got)
-	}
 	if got, want := result.Healthy, true; got != want {
-		t.Errorf("Expected result.Healthy=%v, got %v", want, got)
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
 	}
 	if got, want := len(result.Times), hc.Attempts; got != want {
 		t.Errorf("Expected %d attempts, got %d", want, got)
@@ -58,36 +116,20 @@ func TestChecker(t *testing.T) {
 		t.Errorf("Expected timestamp to be recent, got %s", ts)
 	}
 
-	// Try various different down criteria
-	result, err = hc.Check()
-	if err != nil {
-		t.Errorf("Didn't expect an error: %v", err)
-	}
-	if got, want := result.Healthy, true; got != want {
-		t.Errorf("Expected result.Healthy=%v, got %v", want, got)
-	}
-
-	hc.ThresholdRTT = 1 * time.Nanosecond
-	result, err = hc.Check()
+	hc.ThresholdRTT = types.Duration{Duration: 1 * time.Nanosecond}
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
 	if got, want := result.Degraded, true; got != want {
 		t.Errorf("Expected result.Degraded=%v, got %v", want, got)
 	}
-
-	hc.ThresholdRTT = 0
-	result, err = hc.Check()
-	if err != nil {
-		t.Errorf("Didn't expect an error: %v", err)
-	}
-	if got, want := result.Down, false; got != want {
-		t.Errorf("Expected result.Down=%v, got %v", want, got)
-	}
+	hc.ThresholdRTT = types.Duration{}
 
 	// Try when the server is not even online
-	srv.Close()
-	result, err = hc.Check()
+	shutdown()
+	hc.Timeout = types.Duration{Duration: 100 * time.Millisecond}
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -97,46 +139,128 @@ func TestChecker(t *testing.T) {
 	if got, want := result.Down, true; got != want {
 		t.Errorf("Expected result.Down=%v, got %v", want, got)
 	}
-	if got, want := result.Healthy, false; got != want {
-		t.Errorf("Expected result.Healthy=%v, got %v", want, got)
-	}
 }
 
-func TestCheckerWithAgressiveTimeout(t *testing.T) {
-	// Listen on localhost, random port
-	srv, err := net.Listen("tcp", "localhost:0")
-	if err != nil {
-		t.Errorf("Couldn't start TCP test server with error: %v", err)
-	}
-	defer srv.Close()
-
-	// Accept a future connection
-	go func() {
-		for {
-			conn, err := srv.Accept()
-			if err != nil {
-				break
-			}
-			conn.Close()
+func TestCheckerAssertions(t *testing.T) {
+	endpt, shutdown := startServer(t, "udp", nil)
+	defer shutdown()
+
+	for _, test := range []struct {
+		name    string
+		checker Checker
+		down    bool
+	}{
+		{"answers", Checker{ExpectAnswers: []string{"192.0.2.2", "192.0.2.1"}}, false},
+		{"missing answer", Checker{ExpectAnswers: []string{"192.0.2.1"}}, true},
+		{"answers match", Checker{ExpectAnswersMatch: []string{`^192\.0\.2\.\d+$`}}, false},
+		{"answers mismatch", Checker{ExpectAnswersMatch: []string{`^192\.0\.2\.1$`}}, true},
+		{"mx", Checker{QueryType: "MX", ExpectAnswers: []string{"10 mx.example.org."}}, false},
+		{"txt", Checker{QueryType: "txt", ExpectAnswers: []string{"v=spf1 -all"}}, false},
+		{"no answers to match", Checker{QueryType: "AAAA", ExpectAnswersMatch: []string{`.`}}, true},
+		{"nxdomain", Checker{Host: "missing.example.org"}, true},
+		{"expect nxdomain", Checker{Host: "missing.example.org", ExpectRcode: "NXDOMAIN"}, false},
+		{"min ttl", Checker{MinTTL: types.Duration{Duration: 5 * time.Minute}}, false},
+		{"ttl too low", Checker{QueryType: "MX", MinTTL: types.Duration{Duration: 5 * time.Minute}}, true},
+		{"authenticated data", Checker{ExpectAuthenticatedData: true}, false},
+		{"no question section", Checker{Host: "no-question.example.org", ExpectAnswers: []string{"192.0.2.1", "192.0.2.2"}}, false},
+	} {
+		hc := test.checker
+		hc.Name = test.name
+		hc.URL = endpt
+		if hc.Host == "" {
+			hc.Host = "example.org"
 		}
-	}()
 
-	// Should know the host:port by now
-	endpt := srv.Addr().String()
-	testName := "TestTCP"
-	hc := Checker{Name: testName, URL: endpt, Attempts: 2, Timeout: 1 * time.Nanosecond}
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("%s: Didn't expect an error: %v", test.name, err)
+			continue
+		}
+		if got, want := result.Down, test.down; got != want {
+			t.Errorf("%s: Expected result.Down=%v, got %v (%v)", test.name, want, got, result.Times)
+		}
+	}
+}
+
+func TestCheckerTransports(t *testing.T) {
+	tcpAddr, shutdownTCP := startServer(t, "tcp", nil)
+	defer shutdownTCP()
+
+	tlsAddr, shutdownTLS := startServer(t, "tcp", &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t)},
+	})
+	defer shutdownTLS()
+
+	for _, hc := range []Checker{
+		{Name: "tcp", URL: tcpAddr, Transport: TransportTCP},
+		{Name: "tls", URL: tlsAddr, Transport: TransportTLS, TLSSkipVerify: true},
+	} {
+		hc.Host = "example.org"
+		hc.ExpectAnswers = []string{"192.0.2.1", "192.0.2.2"}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("%s: Didn't expect an error: %v", hc.Name, err)
+			continue
+		}
+		if got, want := result.Healthy, true; got != want {
+			t.Errorf("%s: Expected result.Healthy=%v, got %v (%v)", hc.Name, want, got, result.Times)
+		}
+	}
 
-	result, err := hc.Check()
+	// Certificate is not trusted
+	hc := Checker{Name: "tls", URL: tlsAddr, Host: "example.org", Transport: TransportTLS}
+	result, err := hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
-	if got, want := len(result.Times), hc.Attempts; got != want {
-		t.Errorf("Expected %d attempts, got %d", want, got)
-	}
 	if got, want := result.Down, true; got != want {
 		t.Errorf("Expected result.Down=%v, got %v", want, got)
 	}
-	if got, want := result.Healthy, false; got != want {
-		t.Errorf("Expected result.Healthy=%v, got %v", want, got)
+}
+
+func TestCheckerConfig(t *testing.T) {
+	for _, config := range []string{
+		`{"endpoint_name":"a","endpoint_url":"127.0.0.1:53"}`,
+		`{"endpoint_name":"a","endpoint_url":"127.0.0.1:53","hostname_fqdn":"example.org","query_type":"PTR"}`,
+		`{"endpoint_name":"a","endpoint_url":"127.0.0.1:53","hostname_fqdn":"example.org","transport":"quic"}`,
+		`{"endpoint_name":"a","endpoint_url":"127.0.0.1:53","hostname_fqdn":"example.org","expect_rcode":"BOGUS"}`,
+		`{"endpoint_name":"a","endpoint_url":"127.0.0.1:53","hostname_fqdn":"example.org","expect_answers_match":["("]}`,
+	} {
+		hc, err := New(json.RawMessage(config))
+		if err != nil {
+			t.Fatalf("Didn't expect an error decoding %s: %v", config, err)
+		}
+		if _, err := hc.Check(context.Background()); err == nil {
+			t.Errorf("Expected a configuration error for %s", config)
+		}
+	}
+
+	hc := Checker{URL: "192.0.2.53"}
+	if got, want := hc.address(), "192.0.2.53:53"; got != want {
+		t.Errorf("Expected address %s, got %s", want, got)
+	}
+	hc.Transport = TransportTLS
+	if got, want := hc.address(), "192.0.2.53:853"; got != want {
+		t.Errorf("Expected address %s, got %s", want, got)
+	}
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
 	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
 }
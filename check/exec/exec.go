@@ -1,6 +1,7 @@
 package exec
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/feifeigood/checkup"
 	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
 	"github.com/feifeigood/checkup/prometheus/metric"
 	"github.com/feifeigood/checkup/types"
@@ -17,6 +19,14 @@ import (
 // Type should match the package name
 const Type = "exec"
 
+// DefaultTimeout is the maximum time a command may run
+// when no Timeout is configured.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultMaxOutputBytes is how many bytes of the output of a
+// command are kept when no MaxOutputBytes is configured.
+const DefaultMaxOutputBytes = 1 << 20
+
 var (
 	log = logrus.WithField("component", "exec")
 )
@@ -32,6 +42,11 @@ type Checker struct {
 	// Arguments are individual program parameters.
 	Arguments []string `json:"arguments,omitempty"`
 
+	// Timeout is the maximum time the command may run
+	// in a single attempt before it is killed. Default
+	// is DefaultTimeout.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
 	// ThresholdRTT is the maximum round trip time to
 	// allow for a healthy endpoint. If non-zero and a
 	// request takes longer than ThresholdRTT, the
@@ -40,21 +55,21 @@ type Checker struct {
 	// latency.
 	ThresholdRTT time.Duration `json:"threshold_rtt,omitempty"`
 
-	// MustContain is a string that the response body
-	// must contain in order to be considered up.
-	// NOTE: If set, the entire response body will
-	// be consumed, which has the potential of using
-	// lots of memory and slowing down checks if the
-	// response body is large.
+	// MaxOutputBytes is how many bytes of the combined
+	// output of the command are kept. The rest is read
+	// and discarded. Default is DefaultMaxOutputBytes.
+	MaxOutputBytes int64 `json:"max_output_bytes,omitempty"`
+
+	// MustContain is a string that the output must
+	// contain in order to be considered up. NOTE: Only
+	// the first MaxOutputBytes of the output are searched.
 	MustContain string `json:"must_contain,omitempty"`
 
-	// MustNotContain is a string that the response
-	// body must NOT contain in order to be considered
-	// up. If both MustContain and MustNotContain are
-	// set, they are and-ed together. NOTE: If set,
-	// the entire response body will be consumed, which
-	// has the potential of using lots of memory and
-	// slowing down checks if the response body is large.
+	// MustNotContain is a string that the output must
+	// NOT contain in order to be considered up. If both
+	// MustContain and MustNotContain are set, they are
+	// and-ed together. NOTE: Only the first MaxOutputBytes
+	// of the output are searched.
 	MustNotContain string `json:"must_not_contain,omitempty"`
 
 	// Raise is a string that tells us if we should throw
@@ -79,6 +94,12 @@ type Checker struct {
 	metrics []metric.Metric
 }
 
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
 // New creates a new Checker instance based on json config
 func New(config json.RawMessage) (*Checker, error) {
 	var checker Checker
@@ -96,9 +117,37 @@ func (c *Checker) GetEvery() time.Duration {
 	return c.Every.Duration
 }
 
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("name", "must not be empty"))
+	}
+	if c.Command == "" {
+		errs = append(errs, types.NewValidationError("command", "must not be empty"))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	if c.MaxOutputBytes < 0 {
+		errs = append(errs, types.NewValidationError("max_output_bytes", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":           c.Every.Duration,
+		"timeout":         c.Timeout.Duration,
+		"threshold_rtt":   c.ThresholdRTT,
+		"attempt_spacing": c.AttemptSpacing,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
 // Check performs checks using c according to its configuration.
 // An error is only returned if there is a configuration error.
-func (c *Checker) Check() (types.Result, error) {
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
 	if c.Attempts < 1 {
 		c.Attempts = 1
 	}
@@ -107,21 +156,22 @@ func (c *Checker) Check() (types.Result, error) {
 	result.Title = c.Name
 	result.Type = c.Type()
 	result.Endpoint = strings.TrimSpace(fmt.Sprintf("%s %s", c.Command, strings.Join(c.Arguments, " ")))
-	result.Times = c.doChecks()
+	result.Times = c.doChecks(ctx)
 
 	return c.conclude(result), nil
 }
 
-func (c *Checker) doChecks() types.Attempts {
+func (c *Checker) doChecks(ctx context.Context) types.Attempts {
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
 	checks := make(types.Attempts, c.Attempts)
 	for i := 0; i < c.Attempts; i++ {
 		start := time.Now()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		command := exec.CommandContext(ctx, c.Command, c.Arguments...)
-		output, err := command.CombinedOutput()
+		output, err := c.run(ctx, timeout)
 
 		checks[i].RTT = time.Since(start)
 
@@ -141,12 +191,52 @@ func (c *Checker) doChecks() types.Attempts {
 		}
 
 		if c.AttemptSpacing > 0 {
-			time.Sleep(c.AttemptSpacing)
+			select {
+			case <-time.After(c.AttemptSpacing):
+			case <-ctx.Done():
+			}
 		}
 	}
 	return checks
 }
 
+// run executes the command, killing it once timeout
+// elapses or ctx is done, and returns the beginning of its
+// combined output, up to MaxOutputBytes.
+func (c *Checker) run(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	limit := c.MaxOutputBytes
+	if limit <= 0 {
+		limit = DefaultMaxOutputBytes
+	}
+	output := &limitedBuffer{limit: limit}
+
+	command := exec.CommandContext(ctx, c.Command, c.Arguments...)
+	command.Stdout = output
+	command.Stderr = output
+	err := command.Run()
+	return output.buf.Bytes(), err
+}
+
+// limitedBuffer keeps only the first limit bytes written to
+// it, so that commands are not blocked writing more.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.buf.Len()); room < int64(len(p)) {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
 // conclude takes the data in result from the attempts and
 // computes remaining values needed to fill out the result.
 // It detects degraded (high-latency) responses and makes
@@ -165,31 +255,10 @@ func (c *Checker) conclude(result types.Result) types.Result {
 				return result
 			}
 			result.Down = true
-			m, _ := metric.New(
-				"checkup_exec",
-				map[string]string{
-					"title":    result.Title,
-					"endpoint": result.Endpoint,
-				}, map[string]interface{}{
-					"healthy": 0,
-				}, time.Now(), metric.Gauge,
-			)
-			c.metrics = append(c.metrics, m)
 			return result
 		}
 	}
 
-	m, _ := metric.New(
-		"checkup_exec",
-		map[string]string{
-			"title":    result.Title,
-			"endpoint": result.Endpoint,
-		}, map[string]interface{}{
-			"healthy": 1,
-		}, time.Now(), metric.Gauge,
-	)
-	c.metrics = append(c.metrics, m)
-
 	// Check round trip time (degraded)
 	if c.ThresholdRTT > 0 {
 		stats := result.ComputeStats()
@@ -0,0 +1,355 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/check/internal/checkutil"
+	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
+	"github.com/feifeigood/checkup/prometheus/metric"
+	"github.com/feifeigood/checkup/types"
+)
+
+// Type should match the package name
+const Type = "grpc"
+
+// DefaultTimeout is the deadline of a health check
+// when no Timeout is configured.
+const DefaultTimeout = 5 * time.Second
+
+// Checker implements a Checker for gRPC servers implementing
+// the health checking protocol, grpc.health.v1.Health.
+type Checker struct {
+	// Name is the name of the endpoint.
+	Name string `json:"endpoint_name"`
+
+	// URL is the host:port of the endpoint.
+	URL string `json:"endpoint_url"`
+
+	// Service is the name of the service whose status
+	// is checked. By default, the status of the server
+	// as a whole is checked.
+	Service string `json:"service,omitempty"`
+
+	// Metadata is sent with the health checks, e.g. to
+	// authenticate them.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// TLSEnabled controls whether to enable TLS or not.
+	// If set, TLS is enabled.
+	TLSEnabled bool `json:"tls,omitempty"`
+
+	// TLSSkipVerify controls whether to skip server TLS
+	// certificate validation or not.
+	TLSSkipVerify bool `json:"tls_skip_verify,omitempty"`
+
+	// TLSCAFile is the Certificate Authority used
+	// to validate the server TLS certificate.
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+
+	// TLSCertFile and TLSKeyFile are the PEM encoded
+	// client certificate and key to authenticate with.
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+
+	// TLSServerName is the name the server certificate
+	// is verified against. By default, it is the host
+	// of URL.
+	TLSServerName string `json:"tls_server_name,omitempty"`
+
+	// Timeout is the deadline of connecting and of every
+	// health check. Default is DefaultTimeout.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
+	// ThresholdRTT is the maximum round trip time to
+	// allow for a healthy endpoint. If non-zero and a
+	// request takes longer than ThresholdRTT, the
+	// endpoint will be considered unhealthy. Note that
+	// this duration includes any in-between network
+	// latency.
+	ThresholdRTT types.Duration `json:"threshold_rtt,omitempty"`
+
+	// Attempts is how many requests the client will
+	// make to the endpoint in a single check.
+	Attempts int `json:"attempts,omitempty"`
+
+	// Every override every subcommand interval If set.
+	Every types.Duration `json:"every,omitempty"`
+
+	//
+	metrics []metric.Metric
+}
+
+// Type returns the checker package name
+func (c *Checker) Type() string {
+	return Type
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
+// New creates a new Checker instance based on json config
+func New(config json.RawMessage) (*Checker, error) {
+	var checker Checker
+	err := json.Unmarshal(config, &checker)
+	checker.metrics = []metric.Metric{}
+	return &checker, err
+}
+
+// GetEvery returns the checker specified check interval to override every subcommand
+func (c *Checker) GetEvery() time.Duration {
+	return c.Every.Duration
+}
+
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	} else if _, _, err := net.SplitHostPort(c.URL); err != nil {
+		errs = append(errs, types.NewValidationError("endpoint_url", "%v", err))
+	}
+	for key := range c.Metadata {
+		if key == "" {
+			errs = append(errs, types.NewValidationError("metadata", "keys must not be empty"))
+		} else if strings.HasPrefix(strings.ToLower(key), "grpc-") {
+			errs = append(errs, types.NewValidationError(types.JoinPath("metadata", key), "grpc- keys are reserved"))
+		}
+	}
+	if !c.TLSEnabled {
+		for field, set := range map[string]bool{
+			"tls_skip_verify": c.TLSSkipVerify,
+			"tls_ca_file":     c.TLSCAFile != "",
+			"tls_cert_file":   c.TLSCertFile != "",
+			"tls_server_name": c.TLSServerName != "",
+		} {
+			if set {
+				errs = append(errs, types.NewValidationError(field, "requires tls"))
+			}
+		}
+	}
+	if c.TLSCertFile != "" && c.TLSKeyFile == "" {
+		errs = append(errs, types.NewValidationError("tls_key_file", "must be set with tls_cert_file"))
+	}
+	if c.TLSKeyFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, types.NewValidationError("tls_cert_file", "must be set with tls_key_file"))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":         c.Every.Duration,
+		"timeout":       c.Timeout.Duration,
+		"threshold_rtt": c.ThresholdRTT.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
+// Check performs checks using c according to its configuration.
+// An error is only returned if there is a configuration error.
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
+	if c.Attempts < 1 {
+		c.Attempts = 1
+	}
+
+	result := types.NewResult()
+	result.Type = c.Type()
+	result.Title = c.Name
+	result.Endpoint = c.URL
+
+	creds, err := c.credentials()
+	if err != nil {
+		return result, err
+	}
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := grpc.DialContext(ctx, c.URL, creds)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+
+	// Connecting is timed as a step of the first attempt,
+	// apart from the round trip times of the health checks.
+	// If it fails, the health checks report why.
+	start := time.Now()
+	step := types.Step{Name: "connect"}
+	if err := connect(ctx, conn, timeout); err != nil {
+		step.Error = err.Error()
+	}
+	step.RTT = time.Since(start)
+
+	var unknown bool
+	result.Times, unknown = c.doChecks(ctx, healthpb.NewHealthClient(conn), timeout)
+	result.Times[0].Steps = append([]types.Step{step}, result.Times[0].Steps...)
+
+	return c.conclude(result, unknown), nil
+}
+
+// connect waits within timeout until conn is connected, or
+// has failed to. A failed connection is retried by calls.
+func connect(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		switch state := conn.GetState(); state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("connection %s", state)
+		default:
+			if !conn.WaitForStateChange(ctx, state) {
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// credentials returns the transport credentials of
+// the connection based on configuration.
+func (c *Checker) credentials() (grpc.DialOption, error) {
+	if !c.TLSEnabled {
+		return grpc.WithInsecure(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+	if c.TLSCAFile != "" {
+		pool, err := checkutil.LoadCAFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := checkutil.LoadKeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
+}
+
+// doChecks executes and returns each attempt. unknown is set
+// when an attempt got the UNKNOWN status.
+func (c *Checker) doChecks(ctx context.Context, client healthpb.HealthClient, timeout time.Duration) (checks types.Attempts, unknown bool) {
+	if len(c.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(c.Metadata))
+	}
+
+	checks = make(types.Attempts, c.Attempts)
+	for i := 0; i < c.Attempts; i++ {
+		start := time.Now()
+
+		serving, err := c.doCheck(ctx, client, timeout)
+
+		checks[i].RTT = time.Since(start)
+		if err != nil {
+			checks[i].Error = err.Error()
+			continue
+		}
+		if serving == healthpb.HealthCheckResponse_UNKNOWN {
+			unknown = true
+		}
+	}
+	return checks, unknown
+}
+
+// doCheck calls Health/Check with a deadline of timeout. It
+// returns the status, or an error unless it is SERVING or
+// UNKNOWN.
+func (c *Checker) doCheck(ctx context.Context, client healthpb.HealthClient, timeout time.Duration) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: c.Service})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound:
+			return 0, fmt.Errorf("unknown service %q", c.Service)
+		case codes.Unimplemented:
+			return 0, fmt.Errorf("health checking is not implemented")
+		}
+		return 0, err
+	}
+	switch serving := resp.GetStatus(); serving {
+	case healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_UNKNOWN:
+		return serving, nil
+	default:
+		return serving, fmt.Errorf("status %s", serving)
+	}
+}
+
+// conclude takes the data in result from the attempts and
+// computes remaining values needed to fill out the result.
+// It detects degraded (high-latency or unknown status)
+// responses and makes the conclusion about the result's status.
+// unknown is whether an attempt got the UNKNOWN status.
+func (c *Checker) conclude(result types.Result, unknown bool) types.Result {
+	result.ThresholdRTT = c.ThresholdRTT.Duration
+
+	// Check errors (down)
+	for i := range result.Times {
+		if result.Times[i].Error != "" {
+			result.Down = true
+			return result
+		}
+	}
+
+	// Check serving status (degraded)
+	if unknown {
+		result.Notice = "status UNKNOWN"
+		result.Degraded = true
+		return result
+	}
+
+	// Check round trip time (degraded)
+	if c.ThresholdRTT.Duration > 0 {
+		stats := result.ComputeStats()
+		if stats.Median > c.ThresholdRTT.Duration {
+			result.Notice = fmt.Sprintf("median round trip time exceeded threshold (%s)", c.ThresholdRTT)
+			result.Degraded = true
+			return result
+		}
+	}
+
+	result.Healthy = true
+	return result
+}
+
+func (c *Checker) Collect(collector checkup_prometheus_client.Collector) {
+	if c.metrics != nil && len(c.metrics) > 0 {
+		collector.Add(c.metrics)
+	}
+	c.metrics = []metric.Metric{}
+}
@@ -0,0 +1,211 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serve starts a gRPC server with the health service on a
+// local port, requiring the metadata token: s3cret.
+func serve(t *testing.T, opts ...grpc.ServerOption) (*health.Server, string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	opts = append(opts, grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if token := md.Get("token"); len(token) != 1 || token[0] != "s3cret" {
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		}
+		return handler(ctx, req)
+	}))
+	srv := grpc.NewServer(opts...)
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(ln)
+	return hs, ln.Addr().String(), srv.Stop
+}
+
+// newCert returns a self-signed certificate for 127.0.0.1.
+func newCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "checkup"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestChecker(t *testing.T) {
+	hs, addr, stop := serve(t)
+	defer stop()
+	hs.SetServingStatus("checkup.Serving", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("checkup.NotServing", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus("checkup.Unknown", healthpb.HealthCheckResponse_UNKNOWN)
+
+	for i, test := range []struct {
+		hc       Checker
+		healthy  bool
+		degraded bool
+		err      string
+	}{
+		{hc: Checker{}, healthy: true},
+		{hc: Checker{Service: "checkup.Serving"}, healthy: true},
+		{hc: Checker{Service: "checkup.NotServing"}, err: "status NOT_SERVING"},
+		{hc: Checker{Service: "checkup.Unknown"}, degraded: true},
+		{hc: Checker{Service: "checkup.Missing"}, err: `unknown service "checkup.Missing"`},
+		{hc: Checker{Metadata: map[string]string{"token": "wrong"}}, err: "rpc error: code = Unauthenticated desc = missing token"},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL, hc.Attempts = "Test", addr, 2
+		if hc.Metadata == nil {
+			hc.Metadata = map[string]string{"token": "s3cret"}
+		}
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Healthy, test.healthy; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+		if got, want := result.Degraded, test.degraded; got != want {
+			t.Errorf("Test %d: Expected result.Degraded=%v, got %v", i, want, got)
+		}
+		if got, want := result.Times[0].Error, test.err; got != want {
+			t.Errorf("Test %d: Expected error '%s', got '%s'", i, want, got)
+		}
+		// Connecting is not part of the round trip time
+		if steps := result.Times[0].Steps; len(steps) != 1 || steps[0].Name != "connect" || steps[0].Error != "" {
+			t.Errorf("Test %d: Expected a connect step, got %v", i, steps)
+		}
+	}
+
+	// Stopped servers are down
+	stop()
+	hc := Checker{Name: "Test", URL: addr}
+	hc.Timeout.Duration = time.Second
+	result, _ := hc.Check(context.Background())
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if got := result.Times[0].Error; !strings.Contains(got, "Unavailable") {
+		t.Errorf("Expected an Unavailable error, got '%s'", got)
+	}
+}
+
+func TestCheckerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkup")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert, caCert := newCert(t)
+	clientCert, clientX509 := newCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX509)
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	_, addr, stop := serve(t, grpc.Creds(creds))
+	defer stop()
+
+	write := func(name string, block *pem.Block) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatalf("Cannot write %s: %v", name, err)
+		}
+		return file
+	}
+	caFile := write("ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})
+	certFile := write("client.pem", &pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]})
+	keyDER, err := x509.MarshalECPrivateKey(clientCert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("Cannot marshal key: %v", err)
+	}
+	keyFile := write("client-key.pem", &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	for i, test := range []struct {
+		hc      Checker
+		healthy bool
+	}{
+		{Checker{TLSEnabled: true, TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile}, true},
+		{Checker{TLSEnabled: true, TLSCAFile: caFile}, false},
+		{Checker{TLSEnabled: true, TLSCertFile: certFile, TLSKeyFile: keyFile}, false},
+		{Checker{}, false},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL = "Test", addr
+		hc.Metadata = map[string]string{"token": "s3cret"}
+		hc.Timeout.Duration = time.Second
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Healthy, test.healthy; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	hc := Checker{
+		Name:        "Test",
+		URL:         "localhost",
+		Metadata:    map[string]string{"grpc-timeout": "1S"},
+		TLSCertFile: "client.pem",
+	}
+	want := []string{
+		"endpoint_url: address localhost: missing port in address",
+		"metadata.grpc-timeout: grpc- keys are reserved",
+		"tls_cert_file: requires tls",
+		"tls_key_file: must be set with tls_cert_file",
+	}
+	if got := strings.Split(hc.Validate().Error(), "; "); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
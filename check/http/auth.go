@@ -0,0 +1,332 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/checkup/check/internal/checkutil"
+	"github.com/feifeigood/checkup/types"
+)
+
+// Auth types
+const (
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthOAuth2 = "oauth2"
+)
+
+// Auth configures how a Checker authenticates its requests.
+// Secrets are read from files or environment variables rather
+// than stored in the configuration.
+type Auth struct {
+	// Type is one of basic, bearer and oauth2.
+	Type string `json:"type"`
+
+	// Username is the user of basic authentication.
+	Username string `json:"username,omitempty"`
+
+	// PasswordFile or PasswordEnv contain the password
+	// of basic authentication.
+	PasswordFile string `json:"password_file,omitempty"`
+	PasswordEnv  string `json:"password_env,omitempty"`
+
+	// TokenFile or TokenEnv contain the bearer token.
+	TokenFile string `json:"token_file,omitempty"`
+	TokenEnv  string `json:"token_env,omitempty"`
+
+	// TokenURL is where oauth2 gets tokens with the
+	// client credentials grant.
+	TokenURL string `json:"token_url,omitempty"`
+
+	// ClientID is the oauth2 client.
+	ClientID string `json:"client_id,omitempty"`
+
+	// ClientSecretFile or ClientSecretEnv contain
+	// the secret of the oauth2 client.
+	ClientSecretFile string `json:"client_secret_file,omitempty"`
+	ClientSecretEnv  string `json:"client_secret_env,omitempty"`
+
+	// Scopes are requested with oauth2 tokens.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// mu guards the cached oauth2 token.
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// Login is a request made before checking an endpoint whose
+// cookies are sent with the checks. The cookies are reused
+// until they expire or the endpoint responds 401.
+type Login struct {
+	// URL is the URL of the login request.
+	URL string `json:"url"`
+
+	// Method is the method of the login request.
+	// Default is POST.
+	Method string `json:"method,omitempty"`
+
+	// Form is sent URL-encoded as the request body.
+	Form map[string]string `json:"form,omitempty"`
+
+	// PasswordField is the key of Form to which the
+	// password read from PasswordFile or PasswordEnv
+	// is added.
+	PasswordField string `json:"password_field,omitempty"`
+	PasswordFile  string `json:"password_file,omitempty"`
+	PasswordEnv   string `json:"password_env,omitempty"`
+
+	// mu guards the cookies of the last login.
+	mu  sync.Mutex
+	jar *cookiejar.Jar
+}
+
+// tokenRefreshMargin is how long before their expiry oauth2
+// tokens are refreshed, at most half their lifetime.
+const tokenRefreshMargin = time.Minute
+
+// Validate implements checkup.Validator.
+func (a *Auth) Validate() error {
+	var errs types.Errors
+	switch a.Type {
+	case AuthBasic:
+		if a.Username == "" {
+			errs = append(errs, types.NewValidationError("username", "must not be empty"))
+		}
+		errs = append(errs, checkutil.ValidateSecret("password_file", a.PasswordFile, "password_env", a.PasswordEnv)...)
+	case AuthBearer:
+		errs = append(errs, checkutil.ValidateSecret("token_file", a.TokenFile, "token_env", a.TokenEnv)...)
+	case AuthOAuth2:
+		if u, err := url.Parse(a.TokenURL); a.TokenURL == "" {
+			errs = append(errs, types.NewValidationError("token_url", "must not be empty"))
+		} else if err != nil {
+			errs = append(errs, types.NewValidationError("token_url", "%v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, types.NewValidationError("token_url", "scheme must be http or https"))
+		}
+		if a.ClientID == "" {
+			errs = append(errs, types.NewValidationError("client_id", "must not be empty"))
+		}
+		errs = append(errs, checkutil.ValidateSecret("client_secret_file", a.ClientSecretFile, "client_secret_env", a.ClientSecretEnv)...)
+	case "":
+		errs = append(errs, types.NewValidationError("type", "missing auth type"))
+	default:
+		errs = append(errs, types.NewValidationError("type", "unknown auth type %q, expected basic, bearer or oauth2", a.Type))
+	}
+	return errs.Err()
+}
+
+// authorization returns the Authorization header value of a,
+// getting a new oauth2 token with client if needed.
+func (a *Auth) authorization(ctx context.Context, client *http.Client) (string, error) {
+	switch a.Type {
+	case AuthBasic:
+		password, err := checkutil.ReadSecret("password", a.PasswordFile, a.PasswordEnv)
+		if err != nil {
+			return "", err
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.Username+":"+password)), nil
+	case AuthBearer:
+		token, err := checkutil.ReadSecret("token", a.TokenFile, a.TokenEnv)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	case AuthOAuth2:
+		token, err := a.oauth2Token(ctx, client)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("unknown auth type %q", a.Type)
+}
+
+// oauth2Token returns the cached token, or gets a new one with
+// the client credentials grant if it is about to expire.
+func (a *Auth) oauth2Token(ctx context.Context, client *http.Client) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && (a.refreshAt.IsZero() || time.Now().Before(a.refreshAt)) {
+		return a.token, nil
+	}
+
+	secret, err := checkutil.ReadSecret("client secret", a.ClientSecretFile, a.ClientSecretEnv)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("oauth2: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(secret))
+
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("oauth2: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("oauth2: decoding token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		message := fmt.Sprintf("oauth2: token response status %s", resp.Status)
+		if token.Error != "" {
+			message += ": " + strings.TrimSpace(token.Error+" "+token.ErrorDescription)
+		}
+		return "", fmt.Errorf("%s", message)
+	}
+
+	a.token, a.refreshAt = token.AccessToken, time.Time{}
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		margin := tokenRefreshMargin
+		if margin > lifetime/2 {
+			margin = lifetime / 2
+		}
+		a.refreshAt = start.Add(lifetime - margin)
+	}
+	return a.token, nil
+}
+
+// reset drops the cached token of a.
+func (a *Auth) reset() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
+
+// Validate implements checkup.Validator.
+func (l *Login) Validate() error {
+	var errs types.Errors
+	if u, err := url.Parse(l.URL); l.URL == "" {
+		errs = append(errs, types.NewValidationError("url", "must not be empty"))
+	} else if err != nil {
+		errs = append(errs, types.NewValidationError("url", "%v", err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, types.NewValidationError("url", "scheme must be http or https"))
+	}
+	if strings.ContainsAny(l.Method, " \t\r\n") {
+		errs = append(errs, types.NewValidationError("method", "invalid method %q", l.Method))
+	}
+	if l.PasswordField != "" {
+		errs = append(errs, checkutil.ValidateSecret("password_file", l.PasswordFile, "password_env", l.PasswordEnv)...)
+	} else if l.PasswordFile != "" || l.PasswordEnv != "" {
+		errs = append(errs, types.NewValidationError("password_field", "must be set with password_file or password_env"))
+	}
+	return errs.Err()
+}
+
+// cookies returns the cookies of the last login to send to u,
+// logging in with client first if there are none.
+func (l *Login) cookies(ctx context.Context, client *http.Client, u *url.URL) ([]*http.Cookie, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.jar != nil {
+		if cookies := l.jar.Cookies(u); len(cookies) > 0 {
+			return cookies, nil
+		}
+	}
+
+	form := url.Values{}
+	for key, value := range l.Form {
+		form.Set(key, value)
+	}
+	if l.PasswordField != "" {
+		password, err := checkutil.ReadSecret("login password", l.PasswordFile, l.PasswordEnv)
+		if err != nil {
+			return nil, err
+		}
+		form.Set(l.PasswordField, password)
+	}
+	method := l.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), l.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("login: response status %s", resp.Status)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(resp.Request.URL, resp.Cookies())
+	cookies := jar.Cookies(u)
+	if len(cookies) == 0 {
+		return nil, fmt.Errorf("login: no cookies for %s", u)
+	}
+	l.jar = jar
+	return cookies, nil
+}
+
+// reset drops the cookies of the last login.
+func (l *Login) reset() {
+	l.mu.Lock()
+	l.jar = nil
+	l.mu.Unlock()
+}
+
+// authenticate adds the credentials configured in c to req.
+func (c *Checker) authenticate(ctx context.Context, req *http.Request) error {
+	if c.Login != nil {
+		cookies, err := c.Login.cookies(ctx, c.Client, req.URL)
+		if err != nil {
+			return err
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+	}
+	if c.Auth != nil {
+		authorization, err := c.Auth.authorization(ctx, c.Client)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", authorization)
+	}
+	return nil
+}
+
+// resetAuth drops cached credentials which the endpoint
+// did not accept, so that new ones are used next time.
+func (c *Checker) resetAuth() {
+	if c.Login != nil {
+		c.Login.reset()
+	}
+	if c.Auth != nil {
+		c.Auth.reset()
+	}
+}
@@ -0,0 +1,233 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckerAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkup")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Cannot write password file: %v", err)
+	}
+	os.Setenv("CHECKUP_TEST_TOKEN", "t0ken")
+	defer os.Unsetenv("CHECKUP_TEST_TOKEN")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); ok && user == "checkup" && password == "s3cret" {
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer t0ken" {
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	for i, test := range []struct {
+		auth    *Auth
+		healthy bool
+		err     string
+	}{
+		{&Auth{Type: AuthBasic, Username: "checkup", PasswordFile: passwordFile}, true, ""},
+		{&Auth{Type: AuthBasic, Username: "other", PasswordFile: passwordFile}, false, "response status 401 Unauthorized"},
+		{&Auth{Type: AuthBearer, TokenEnv: "CHECKUP_TEST_TOKEN"}, true, ""},
+		{&Auth{Type: AuthBearer, TokenEnv: "CHECKUP_TEST_MISSING"}, false, "reading token: environment variable CHECKUP_TEST_MISSING is not set"},
+	} {
+		hc := Checker{Name: "Test", URL: srv.URL, Auth: test.auth}
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Healthy, test.healthy; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v", i, want, got)
+		}
+		if got, want := result.Times[0].Error, test.err; got != want {
+			t.Errorf("Test %d: Expected error '%s', got '%s'", i, want, got)
+		}
+	}
+}
+
+func TestCheckerOAuth2(t *testing.T) {
+	var issued int32
+	var valid atomic.Value
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || id != "checkup" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		token := fmt.Sprintf("token-%d-%s", atomic.AddInt32(&issued, 1), r.FormValue("scope"))
+		valid.Store(token)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer %v", valid.Load()) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("CHECKUP_TEST_SECRET", "s3cret")
+	defer os.Unsetenv("CHECKUP_TEST_SECRET")
+	auth := &Auth{
+		Type:            AuthOAuth2,
+		TokenURL:        tokenServer.URL,
+		ClientID:        "checkup",
+		ClientSecretEnv: "CHECKUP_TEST_SECRET",
+		Scopes:          []string{"read", "health"},
+	}
+	hc := Checker{Name: "Test", URL: srv.URL, Auth: auth, Attempts: 2}
+
+	check := func(step string) {
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("%s: Didn't expect an error: %v", step, err)
+		}
+		if got, want := result.Healthy, true; got != want {
+			t.Errorf("%s: Expected result.Healthy=%v, got %v (%v)", step, want, got, result.Times)
+		}
+	}
+
+	check("First check")
+	check("Second check")
+	if got, want := atomic.LoadInt32(&issued), int32(1); got != want {
+		t.Errorf("Expected the token to be cached, got %d tokens", got)
+	}
+	if got, want := auth.token, "token-1-read health"; got != want {
+		t.Errorf("Expected token '%s', got '%s'", want, got)
+	}
+	if until := time.Until(auth.refreshAt); until < 58*time.Minute || until > 59*time.Minute {
+		t.Errorf("Expected refresh a minute before expiry, in %s", until)
+	}
+
+	// Refreshed before it expires
+	auth.refreshAt = time.Now().Add(-time.Second)
+	check("Refresh")
+	if got, want := atomic.LoadInt32(&issued), int32(2); got != want {
+		t.Errorf("Expected a new token, got %d tokens", got)
+	}
+
+	// Replaced once rejected
+	valid.Store("revoked")
+	result, _ := hc.Check(context.Background())
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v with a revoked token, got %v", want, got)
+	}
+	check("After revocation")
+
+	os.Setenv("CHECKUP_TEST_SECRET", "wrong")
+	auth.reset()
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Times[0].Error, "oauth2: token response status 401 Unauthorized: invalid_client"; got != want {
+		t.Errorf("Expected error '%s', got '%s'", want, got)
+	}
+}
+
+func TestCheckerLogin(t *testing.T) {
+	var logins int32
+	var session atomic.Value
+	session.Store("")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("user") != "checkup" || r.FormValue("pass") != "s3cret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		id := fmt.Sprint(atomic.AddInt32(&logins, 1))
+		session.Store(id)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: id, Path: "/"})
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if err != nil || cookie.Value != session.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	os.Setenv("CHECKUP_TEST_PASSWORD", "s3cret")
+	defer os.Unsetenv("CHECKUP_TEST_PASSWORD")
+	hc := Checker{Name: "Test", URL: srv.URL + "/", Attempts: 2, Login: &Login{
+		URL:           srv.URL + "/login",
+		Form:          map[string]string{"user": "checkup"},
+		PasswordField: "pass",
+		PasswordEnv:   "CHECKUP_TEST_PASSWORD",
+	}}
+
+	for i := 0; i < 2; i++ {
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Didn't expect an error: %v", err)
+		}
+		if got, want := result.Healthy, true; got != want {
+			t.Errorf("Check %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+	}
+	if got, want := atomic.LoadInt32(&logins), int32(1); got != want {
+		t.Errorf("Expected the cookie to be reused, got %d logins", got)
+	}
+
+	// Logged out by the server
+	session.Store("expired")
+	hc.Check(context.Background())
+	result, _ := hc.Check(context.Background())
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v after logging in again, got %v (%v)", want, got, result.Times)
+	}
+
+	hc.Login.reset()
+	hc.Login.Form["user"] = "other"
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Times[0].Error, "login: response status 403 Forbidden"; got != want {
+		t.Errorf("Expected error '%s', got '%s'", want, got)
+	}
+}
+
+func TestAuthValidate(t *testing.T) {
+	for i, test := range []struct {
+		hc   Checker
+		want string
+	}{
+		{Checker{Auth: &Auth{Type: "digest"}}, `auth.type: unknown auth type "digest", expected basic, bearer or oauth2`},
+		{Checker{Auth: &Auth{Type: AuthBasic, PasswordFile: "a", PasswordEnv: "B"}}, "auth.username: must not be empty; auth.password_env: cannot be combined with password_file"},
+		{Checker{Auth: &Auth{Type: AuthBearer}}, "auth.token_file: token_file or token_env must be set"},
+		{Checker{Auth: &Auth{Type: AuthOAuth2, TokenURL: "ftp://x", ClientSecretEnv: "S"}}, "auth.token_url: scheme must be http or https; auth.client_id: must not be empty"},
+		{Checker{Login: &Login{PasswordFile: "p"}}, "login.url: must not be empty; login.password_field: must be set with password_file or password_env"},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL = "Test", "http://localhost"
+
+		err := hc.Validate()
+		if err == nil {
+			t.Errorf("Test %d: Expected an error", i)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.want, got)
+		}
+	}
+}
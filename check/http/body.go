@@ -0,0 +1,214 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// DefaultMaxBodyBytes is how many bytes of a response body
+// are read when no MaxBodyBytes is configured.
+const DefaultMaxBodyBytes = 10 << 20
+
+// acceptEncoding is the Accept-Encoding of requests
+// with Compression.
+const acceptEncoding = "gzip, deflate, br"
+
+// SizeRange is an inclusive range of sizes in bytes. Zero
+// bounds are not checked.
+type SizeRange struct {
+	Min int64 `json:"min,omitempty"`
+	Max int64 `json:"max,omitempty"`
+}
+
+// responseBody is what was read of a response body.
+type responseBody struct {
+	// encoding is the Content-Encoding of the body.
+	encoding string
+
+	// size and decodedSize are the bytes read before
+	// and after decoding.
+	size, decodedSize int64
+
+	// truncated is whether the body is longer than
+	// what was read.
+	truncated bool
+
+	// contains and notContains match MustContain and
+	// MustNotContain while the body is read.
+	contains, notContains *substring
+
+	// data is the body read, if it had to be kept.
+	data *bytes.Buffer
+}
+
+// details returns the details of b for the result.
+func (b *responseBody) details() map[string]string {
+	details := map[string]string{
+		"response_body_bytes":    fmt.Sprint(b.size),
+		"response_decoded_bytes": fmt.Sprint(b.decodedSize),
+	}
+	if b.encoding != "" {
+		details["response_content_encoding"] = b.encoding
+	}
+	if b.truncated {
+		details["response_body_truncated"] = "true"
+	}
+	return details
+}
+
+// checkSize checks the decoded size of b is within r.
+func (b *responseBody) checkSize(r SizeRange) error {
+	if r.Min > 0 && b.decodedSize < r.Min {
+		return fmt.Errorf("response body is %d bytes, expected at least %d", b.decodedSize, r.Min)
+	}
+	if r.Max > 0 && b.truncated {
+		return fmt.Errorf("response body is more than %d bytes, expected at most %d", b.decodedSize, r.Max)
+	}
+	if r.Max > 0 && b.decodedSize > r.Max {
+		return fmt.Errorf("response body is %d bytes, expected at most %d", b.decodedSize, r.Max)
+	}
+	return nil
+}
+
+// readBody reads up to limit decoded bytes of the body of resp.
+// MustContain and MustNotContain are matched while reading, the
+// body is only kept in memory if keep is set.
+func (c *Checker) readBody(resp *http.Response, limit int64, keep bool) (*responseBody, error) {
+	b := &responseBody{encoding: resp.Header.Get("Content-Encoding")}
+	if resp.Body == nil {
+		return b, nil
+	}
+
+	var writers []io.Writer
+	if c.MustContain != "" {
+		b.contains = &substring{needle: []byte(c.MustContain)}
+		writers = append(writers, b.contains)
+	}
+	if c.MustNotContain != "" {
+		b.notContains = &substring{needle: []byte(c.MustNotContain)}
+		writers = append(writers, b.notContains)
+	}
+	if keep {
+		b.data = new(bytes.Buffer)
+		writers = append(writers, b.data)
+	}
+
+	wire := &countingReader{r: resp.Body}
+	defer func() { b.size = wire.n }()
+	decoded, err := decodeBody(wire, b.encoding)
+	if err != nil {
+		return b, err
+	}
+
+	b.decodedSize, err = io.Copy(io.MultiWriter(writers...), io.LimitReader(decoded, limit))
+	if err != nil {
+		return b, err
+	}
+	if b.decodedSize == limit {
+		var next [1]byte
+		if n, _ := io.ReadFull(decoded, next[:]); n > 0 {
+			b.truncated = true
+		}
+	}
+	return b, nil
+}
+
+// ReadBody reads up to limit bytes of the body of resp, decoded
+// from its Content-Encoding. truncated is set if the body is
+// longer than limit.
+func ReadBody(resp *http.Response, limit int64) (data []byte, truncated bool, err error) {
+	b, err := (&Checker{}).readBody(resp, limit, true)
+	if b.data != nil {
+		data = b.data.Bytes()
+	}
+	return data, b.truncated, err
+}
+
+// decodeBody returns a reader decoding r, which is encoded
+// with the Content-Encoding encoding.
+func decodeBody(r io.Reader, encoding string) (io.Reader, error) {
+	codings := strings.Split(encoding, ",")
+	// Codings are listed in the order they were applied
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(r)
+			if err == io.EOF {
+				// Empty bodies, e.g. of HEAD requests
+				return strings.NewReader(""), nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", coding, err)
+			}
+			r = zr
+		case "deflate":
+			r = newDeflateReader(r)
+		case "br":
+			r = brotli.NewReader(r)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", coding)
+		}
+	}
+	return r, nil
+}
+
+// newDeflateReader returns a reader decoding the deflate
+// coding, which should be zlib but is raw DEFLATE for
+// some servers.
+func newDeflateReader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(2)
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr
+		}
+	}
+	return flate.NewReader(br)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// substring reports whether needle occurs in what is written
+// to it, keeping only the end of the previous write which may
+// start a match.
+type substring struct {
+	needle []byte
+	tail   []byte
+	found  bool
+}
+
+func (s *substring) Write(p []byte) (int, error) {
+	if s.found {
+		return len(p), nil
+	}
+	data := append(s.tail, p...)
+	if bytes.Contains(data, s.needle) {
+		s.found, s.tail = true, nil
+		return len(p), nil
+	}
+	if keep := len(s.needle) - 1; len(data) > keep {
+		data = data[len(data)-keep:]
+	}
+	s.tail = append([]byte(nil), data...)
+	return len(p), nil
+}
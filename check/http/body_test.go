@@ -0,0 +1,208 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCheckerBody(t *testing.T) {
+	page := strings.Repeat("<p>checkup</p>", 1000) + "<footer>end</footer>"
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Query().Get("encoding")
+		if encoding == "" || !strings.Contains(r.Header.Get("Accept-Encoding"), strings.TrimPrefix(encoding, "raw-")) {
+			fmt.Fprint(w, page)
+			return
+		}
+		w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+		if encoding == "unknown" {
+			fmt.Fprint(w, page)
+			return
+		}
+		enc := encoders[encoding](w)
+		fmt.Fprint(enc, page)
+		enc.Close()
+	}))
+	defer srv.Close()
+
+	for i, test := range []struct {
+		hc      Checker
+		err     string
+		details map[string]string
+	}{
+		{
+			hc:      Checker{URL: srv.URL, MustContain: "<footer>end</footer>", MustNotContain: "error"},
+			details: map[string]string{"response_body_bytes": fmt.Sprint(len(page)), "response_decoded_bytes": fmt.Sprint(len(page))},
+		},
+		{
+			hc:      Checker{URL: srv.URL + "?encoding=gzip", Compression: true, MustContain: "<footer>end</footer>", MustMatch: "checkup</p><footer>"},
+			details: map[string]string{"response_content_encoding": "gzip", "response_decoded_bytes": fmt.Sprint(len(page))},
+		},
+		{
+			hc:      Checker{URL: srv.URL + "?encoding=deflate", Compression: true, MustContain: "<footer>end</footer>"},
+			details: map[string]string{"response_content_encoding": "deflate", "response_decoded_bytes": fmt.Sprint(len(page))},
+		},
+		{
+			hc:      Checker{URL: srv.URL + "?encoding=raw-deflate", Compression: true, MustContain: "<footer>end</footer>"},
+			details: map[string]string{"response_content_encoding": "deflate", "response_decoded_bytes": fmt.Sprint(len(page))},
+		},
+		{
+			hc:      Checker{URL: srv.URL + "?encoding=br", Compression: true, BodySize: &SizeRange{Min: 1000, Max: 20000}},
+			details: map[string]string{"response_content_encoding": "br", "response_decoded_bytes": fmt.Sprint(len(page))},
+		},
+		{
+			hc:      Checker{URL: srv.URL + "?encoding=gzip", MustContain: "<footer>end</footer>"},
+			details: map[string]string{"response_content_encoding": "", "response_decoded_bytes": fmt.Sprint(len(page))},
+		},
+		{
+			hc:      Checker{URL: srv.URL, MaxBodyBytes: 1000, MustContain: "<footer>end</footer>"},
+			err:     "response does not contain '<footer>end</footer>'",
+			details: map[string]string{"response_decoded_bytes": "1000", "response_body_truncated": "true"},
+		},
+		{
+			hc:  Checker{URL: srv.URL, MaxBodyBytes: 1000, BodySize: &SizeRange{Max: 1000}},
+			err: "response body is more than 1000 bytes, expected at most 1000",
+		},
+		{
+			hc:  Checker{URL: srv.URL, BodySize: &SizeRange{Max: 1000}},
+			err: fmt.Sprintf("response body is %d bytes, expected at most 1000", len(page)),
+		},
+		{
+			hc:  Checker{URL: srv.URL, BodySize: &SizeRange{Min: 20000}},
+			err: fmt.Sprintf("response body is %d bytes, expected at least 20000", len(page)),
+		},
+		{
+			hc:  Checker{URL: srv.URL, MustNotContain: "<footer>"},
+			err: "response contains '<footer>'",
+		},
+		{
+			hc:  Checker{URL: srv.URL + "?encoding=unknown", Headers: http.Header{"Accept-Encoding": {"unknown"}}},
+			err: `reading response body: unsupported content encoding "unknown"`,
+		},
+	} {
+		hc := test.hc
+		hc.Name = "Test"
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Times[0].Error, test.err; got != want {
+			t.Errorf("Test %d: Expected error '%s', got '%s'", i, want, got)
+		}
+		for key, want := range test.details {
+			if got := result.Details[key]; got != want {
+				t.Errorf("Test %d: Expected details %s=%s, got %s", i, key, want, got)
+			}
+		}
+	}
+}
+
+func TestSubstring(t *testing.T) {
+	for i, test := range []struct {
+		needle string
+		writes []string
+		found  bool
+	}{
+		{"checkup", []string{"che", "ck", "up"}, true},
+		{"checkup", []string{"c", "h", "e", "c", "k", "u", "p"}, true},
+		{"checkup", []string{"checku", "checku", "p"}, true},
+		{"checkup", []string{"check", "", "-up"}, false},
+		{"x", []string{"abc", "dxe"}, true},
+		{"xy", []string{"abc", "xz", "y"}, false},
+	} {
+		s := &substring{needle: []byte(test.needle)}
+		for _, w := range test.writes {
+			s.Write([]byte(w))
+		}
+		if got, want := s.found, test.found; got != want {
+			t.Errorf("Test %d: Expected found=%v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprint(gz, "checkup")
+	gz.Close()
+
+	// Codings are undone in reverse order
+	var twice bytes.Buffer
+	br := brotli.NewWriter(&twice)
+	gz = gzip.NewWriter(br)
+	fmt.Fprint(gz, "checkup")
+	gz.Close()
+	br.Close()
+
+	for i, test := range []struct {
+		body     []byte
+		encoding string
+		want     string
+	}{
+		{[]byte("checkup"), "", "checkup"},
+		{[]byte("checkup"), "identity", "checkup"},
+		{buf.Bytes(), "GZIP", "checkup"},
+		{twice.Bytes(), "gzip, br", "checkup"},
+		{nil, "gzip", ""},
+	} {
+		r, err := decodeBody(bytes.NewReader(test.body), test.encoding)
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+			continue
+		}
+		var got bytes.Buffer
+		if _, err := io.Copy(&got, r); err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got.String() != test.want {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.want, got.String())
+		}
+	}
+}
+
+func TestBodyValidate(t *testing.T) {
+	for i, test := range []struct {
+		hc   Checker
+		want string
+	}{
+		{Checker{MaxBodyBytes: -1}, "max_body_bytes: must not be negative"},
+		{Checker{BodySize: &SizeRange{Min: 10, Max: 5}}, "body_size.max: must not be less than min"},
+		{Checker{MaxBodyBytes: 100, BodySize: &SizeRange{Max: 101}}, "body_size.max: must not exceed max_body_bytes (100)"},
+		{Checker{BodySize: &SizeRange{Min: DefaultMaxBodyBytes + 1}}, fmt.Sprintf("body_size.min: must not exceed max_body_bytes (%d)", DefaultMaxBodyBytes)},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL = "Test", "http://localhost"
+
+		err := hc.Validate()
+		if err == nil {
+			t.Errorf("Test %d: Expected an error", i)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.want, got)
+		}
+	}
+}
@@ -1,15 +1,27 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"golang.org/x/net/http2"
+
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/check/internal/checkutil"
 	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
 	"github.com/feifeigood/checkup/prometheus/metric"
 	"github.com/feifeigood/checkup/types"
@@ -18,6 +30,27 @@ import (
 // Type should match the package name
 const Type = "http"
 
+// DefaultTimeout is the maximum time an attempt may take
+// when no Timeout is configured.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultMaxRedirects is how many redirects are followed
+// when no MaxRedirects is configured.
+const DefaultMaxRedirects = 10
+
+// Values of Protocol
+const (
+	// ProtocolHTTP1 only offers HTTP/1.1.
+	ProtocolHTTP1 = "http1"
+
+	// ProtocolHTTP2 requires HTTP/2 negotiated with TLS ALPN.
+	ProtocolHTTP2 = "http2"
+
+	// ProtocolH2C requires HTTP/2 over cleartext, with
+	// prior knowledge rather than an upgrade.
+	ProtocolH2C = "h2c"
+)
+
 // Checker implements a Checker for HTTP endpoints.
 type Checker struct {
 	// Name is the name of the endpoint.
@@ -26,20 +59,108 @@ type Checker struct {
 	// URL is the URL of the endpoint.
 	URL string `json:"endpoint_url"`
 
-	// UpStatus is the HTTP status code expected by
-	// a healthy endpoint. Default is http.StatusOK.
-	UpStatus int `json:"up_status,omitempty"`
+	// Method is the HTTP method of the request.
+	// Default is GET.
+	Method string `json:"method,omitempty"`
+
+	// Body is sent as the request body.
+	Body string `json:"body,omitempty"`
+
+	// BodyFile is the path of a file whose contents are
+	// sent as the request body. It is read on every check.
+	BodyFile string `json:"body_file,omitempty"`
+
+	// Form is sent URL-encoded as the request body.
+	Form map[string]string `json:"form,omitempty"`
+
+	// JSONBody is sent as the request body with the
+	// application/json content type.
+	JSONBody json.RawMessage `json:"json_body,omitempty"`
+
+	// ContentType is the content type of the request
+	// body, overriding the one implied by Form or JSONBody.
+	ContentType string `json:"content_type,omitempty"`
+
+	// UpStatus is the set of HTTP status codes of
+	// a healthy endpoint, e.g. ["2xx", 301, 404].
+	// Default is DefaultUpStatus.
+	UpStatus StatusSet `json:"up_status,omitempty"`
+
+	// FollowRedirects makes the checker follow redirects
+	// and check the final response. Each request is
+	// recorded as a step of the attempt.
+	FollowRedirects bool `json:"follow_redirects,omitempty"`
+
+	// MaxRedirects is how many redirects are followed
+	// before the endpoint is considered down.
+	// Default is DefaultMaxRedirects.
+	MaxRedirects int `json:"max_redirects,omitempty"`
+
+	// FinalURL is the URL that followed redirects must
+	// end at for the endpoint to be considered up.
+	FinalURL string `json:"final_url,omitempty"`
+
+	// ExpectRedirects is the number of redirects that
+	// must be followed for the endpoint to be considered up.
+	ExpectRedirects *int `json:"expect_redirects,omitempty"`
+
+	// NoDowngrade considers the endpoint down if it
+	// redirects from https to http. The http URL is
+	// not requested.
+	NoDowngrade bool `json:"no_downgrade,omitempty"`
+
+	// Protocol is the HTTP protocol to use, one of http1,
+	// http2 and h2c. If set, a response over another
+	// protocol marks the endpoint down. By default,
+	// HTTP/1.1 is used.
+	Protocol string `json:"protocol,omitempty"`
 
 	// Proxy is the proxy url used for ProxyClient
 	Proxy string `json:"proxy,omitempty"`
 
+	// TLSCAFile is the Certificate Authority used
+	// to validate the server TLS certificate.
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+
+	// TLSCertFile and TLSKeyFile are the PEM encoded
+	// client certificate and key presented to servers
+	// requiring mutual TLS.
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+
+	// TLSServerName overrides the name used to verify
+	// the server certificate and sent as SNI.
+	TLSServerName string `json:"tls_server_name,omitempty"`
+
+	// TLSMinVersion is the minimum TLS version accepted,
+	// one of 1.0, 1.1, 1.2 and 1.3. Default is the
+	// minimum of crypto/tls.
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+
+	// TLSSkipVerify controls whether to skip server TLS
+	// certificate validation or not.
+	TLSSkipVerify bool `json:"tls_skip_verify,omitempty"`
+
 	// Headers contains headers to added to the request
 	// that is sent for the check
 	Headers http.Header `json:"headers,omitempty"`
 
+	// Auth authenticates the requests, setting their
+	// Authorization header.
+	Auth *Auth `json:"auth,omitempty"`
+
+	// Login is a request made before the checks
+	// whose cookies are sent with them.
+	Login *Login `json:"login,omitempty"`
+
 	// Every override every subcommand interval If set.
 	Every types.Duration `json:"every,omitempty"`
 
+	// Timeout is the maximum time to wait for a single
+	// attempt, including reading the response body.
+	// Default is DefaultTimeout.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
 	// ThresholdRTT is the maximum round trip time to
 	// allow for a healthy endpoint. If non-zero and a
 	// request takes longer than ThresholdRTT, the
@@ -48,23 +169,68 @@ type Checker struct {
 	// latency.
 	ThresholdRTT time.Duration `json:"threshold_rtt,omitempty"`
 
+	// PhaseThresholds are the maximum median durations
+	// of phases of the requests, by name in Phases, to
+	// allow for a healthy endpoint. E.g. first_byte
+	// limits the time the server takes to respond.
+	PhaseThresholds map[string]types.Duration `json:"phase_thresholds,omitempty"`
+
+	// MaxBodyBytes is how many bytes of the decoded
+	// response body are read at most. The body checks
+	// only see that much of a longer body. Default is
+	// DefaultMaxBodyBytes.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+
+	// Compression requests a compressed response with
+	// gzip, deflate or br. Compressed responses are
+	// decoded whether requested or not.
+	Compression bool `json:"compression,omitempty"`
+
+	// BodySize is the range of sizes of the decoded
+	// response body, in bytes, for the endpoint to be
+	// considered up, e.g. to detect empty pages.
+	BodySize *SizeRange `json:"body_size,omitempty"`
+
 	// MustContain is a string that the response body
-	// must contain in order to be considered up.
-	// NOTE: If set, the entire response body will
-	// be consumed, which has the potential of using
-	// lots of memory and slowing down checks if the
-	// response body is large.
+	// must contain in order to be considered up. It is
+	// searched for while the body is read, which does
+	// not keep the body in memory.
 	MustContain string `json:"must_contain,omitempty"`
 
 	// MustNotContain is a string that the response
 	// body must NOT contain in order to be considered
 	// up. If both MustContain and MustNotContain are
-	// set, they are and-ed together. NOTE: If set,
-	// the entire response body will be consumed, which
-	// has the potential of using lots of memory and
-	// slowing down checks if the response body is large.
+	// set, they are and-ed together. Like MustContain,
+	// it does not keep the body in memory.
 	MustNotContain string `json:"must_not_contain,omitempty"`
 
+	// MustMatch is a regular expression that the
+	// response body must match in order to be
+	// considered up. NOTE: If set, up to MaxBodyBytes
+	// of the response body are kept in memory.
+	MustMatch string `json:"must_match,omitempty"`
+
+	// MustNotMatch is a regular expression that the
+	// response body must NOT match in order to be
+	// considered up. NOTE: If set, up to MaxBodyBytes
+	// of the response body are kept in memory.
+	MustNotMatch string `json:"must_not_match,omitempty"`
+
+	// HeaderAssertions are checked against the response
+	// headers, e.g. that Cache-Control is present.
+	HeaderAssertions []HeaderAssertion `json:"header_assertions,omitempty"`
+
+	// JSONAssertions are checked against the response
+	// body, which must be JSON, e.g. `$.db.status == "UP"`.
+	// See JSONAssertion for the syntax. NOTE: If set, up
+	// to MaxBodyBytes of the response body are kept in memory.
+	JSONAssertions []JSONAssertion `json:"json_assertions,omitempty"`
+
+	// JSONAssertionsDegraded makes failed JSONAssertions
+	// mark the endpoint degraded instead of down. A body
+	// that is not JSON still marks it down.
+	JSONAssertionsDegraded bool `json:"json_assertions_degraded,omitempty"`
+
 	// Attempts is how many requests the client will
 	// make to the endpoint in a single check.
 	Attempts int `json:"attempts,omitempty"`
@@ -76,14 +242,61 @@ type Checker struct {
 	AttemptSpacing time.Duration `json:"attempt_spacing,omitempty"`
 
 	// Client is the http.Client with which to make
-	// requests. If not set, DefaultHTTPClient is
-	// used.
+	// requests. If not set, DefaultHTTPClient is used,
+	// or a client built once from Proxy and the TLS
+	// options if any is set.
 	Client *http.Client `json:"-"`
 
 	//
 	metrics []metric.Metric
 }
 
+// report is what the attempts of a check learn for its result.
+// It is kept by the check rather than the Checker, whose checks
+// may overlap.
+type report struct {
+	// response holds what the last response was received
+	// over and the size of its body.
+	response map[string]string
+
+	// warnings are the failed assertions which degrade
+	// the endpoint, returned by checkDown.
+	warnings []string
+}
+
+// HeaderAssertion is a check on a response header. The header
+// must be present and, if set, equal Equals and match Matches.
+type HeaderAssertion struct {
+	// Name is the name of the header.
+	Name string `json:"name"`
+
+	// Absent requires the header not to be present instead.
+	Absent bool `json:"absent,omitempty"`
+
+	// Equals is the value the header must have.
+	Equals string `json:"equals,omitempty"`
+
+	// Matches is a regular expression the value of
+	// the header must match.
+	Matches string `json:"matches,omitempty"`
+}
+
+// matchers are the compiled regular expressions of a Checker.
+type matchers struct {
+	mustMatch    *regexp.Regexp
+	mustNotMatch *regexp.Regexp
+
+	// headers are by index of HeaderAssertions,
+	// nil for assertions without Matches.
+	headers []*regexp.Regexp
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
 // New creates a new Checker instance based on json config
 func New(config json.RawMessage) (*Checker, error) {
 	var checker Checker
@@ -101,30 +314,188 @@ func (c *Checker) GetEvery() time.Duration {
 	return c.Every.Duration
 }
 
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if u, err := url.Parse(c.URL); c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	} else if err != nil {
+		errs = append(errs, types.NewValidationError("endpoint_url", "%v", err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "scheme must be http or https"))
+	}
+	if strings.ContainsAny(c.Method, " \t\r\n") {
+		errs = append(errs, types.NewValidationError("method", "invalid method %q", c.Method))
+	}
+	var bodies []string
+	for field, set := range map[string]bool{
+		"body":      c.Body != "",
+		"body_file": c.BodyFile != "",
+		"form":      len(c.Form) > 0,
+		"json_body": len(c.JSONBody) > 0,
+	} {
+		if set {
+			bodies = append(bodies, field)
+		}
+	}
+	if len(bodies) > 1 {
+		sort.Strings(bodies)
+		errs = append(errs, types.NewValidationError(bodies[1], "cannot be combined with %s", bodies[0]))
+	}
+	for _, r := range c.UpStatus {
+		if err := r.validate(); err != nil {
+			errs = append(errs, types.NewValidationError("up_status", "%v", err))
+		}
+	}
+	for field, expr := range map[string]string{
+		"must_match":     c.MustMatch,
+		"must_not_match": c.MustNotMatch,
+	} {
+		if _, err := regexp.Compile(expr); err != nil {
+			errs = append(errs, types.NewValidationError(field, "%v", err))
+		}
+	}
+	for i, assertion := range c.HeaderAssertions {
+		path := fmt.Sprintf("header_assertions[%d]", i)
+		if assertion.Name == "" {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, "name"), "must not be empty"))
+		}
+		if assertion.Absent && (assertion.Equals != "" || assertion.Matches != "") {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, "absent"), "cannot be combined with equals or matches"))
+		}
+		if _, err := regexp.Compile(assertion.Matches); err != nil {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, "matches"), "%v", err))
+		}
+	}
+	for i := range c.JSONAssertions {
+		if err := c.JSONAssertions[i].Validate(); err != nil {
+			errs = append(errs, types.NewValidationError(fmt.Sprintf("json_assertions[%d]", i), "%v", err))
+		}
+	}
+	if c.MaxBodyBytes < 0 {
+		errs = append(errs, types.NewValidationError("max_body_bytes", "must not be negative"))
+	}
+	if c.BodySize != nil {
+		for field, size := range map[string]int64{"min": c.BodySize.Min, "max": c.BodySize.Max} {
+			if size < 0 {
+				errs = append(errs, types.NewValidationError(types.JoinPath("body_size", field), "must not be negative"))
+			} else if size > c.maxBodyBytes() {
+				errs = append(errs, types.NewValidationError(types.JoinPath("body_size", field), "must not exceed max_body_bytes (%d)", c.maxBodyBytes()))
+			}
+		}
+		if c.BodySize.Max > 0 && c.BodySize.Max < c.BodySize.Min {
+			errs = append(errs, types.NewValidationError(types.JoinPath("body_size", "max"), "must not be less than min"))
+		}
+	}
+	if c.MaxRedirects < 0 {
+		errs = append(errs, types.NewValidationError("max_redirects", "must not be negative"))
+	}
+	if c.ExpectRedirects != nil && *c.ExpectRedirects < 0 {
+		errs = append(errs, types.NewValidationError("expect_redirects", "must not be negative"))
+	}
+	if !c.FollowRedirects {
+		for field, set := range map[string]bool{
+			"max_redirects":    c.MaxRedirects != 0,
+			"final_url":        c.FinalURL != "",
+			"expect_redirects": c.ExpectRedirects != nil,
+			"no_downgrade":     c.NoDowngrade,
+		} {
+			if set {
+				errs = append(errs, types.NewValidationError(field, "requires follow_redirects"))
+			}
+		}
+	}
+	for name, d := range c.PhaseThresholds {
+		if !containsString(Phases, name) {
+			errs = append(errs, types.NewValidationError(types.JoinPath("phase_thresholds", name), "unknown phase, expected one of %s", strings.Join(Phases, ", ")))
+		} else if d.Duration < 0 {
+			errs = append(errs, types.NewValidationError(types.JoinPath("phase_thresholds", name), "must not be negative"))
+		}
+	}
+	if c.Proxy != "" {
+		if _, err := url.Parse(c.Proxy); err != nil {
+			errs = append(errs, types.NewValidationError("proxy", "%v", err))
+		}
+	}
+	switch c.Protocol {
+	case "", ProtocolHTTP1:
+	case ProtocolHTTP2:
+		if strings.HasPrefix(c.URL, "http:") {
+			errs = append(errs, types.NewValidationError("protocol", "http2 requires an https endpoint_url, use h2c for http"))
+		}
+	case ProtocolH2C:
+		if strings.HasPrefix(c.URL, "https:") {
+			errs = append(errs, types.NewValidationError("protocol", "h2c requires an http endpoint_url, use http2 for https"))
+		}
+		if c.Proxy != "" {
+			errs = append(errs, types.NewValidationError("protocol", "h2c cannot be combined with proxy"))
+		}
+	default:
+		errs = append(errs, types.NewValidationError("protocol", "unknown protocol %q, expected http1, http2 or h2c", c.Protocol))
+	}
+	if c.Auth != nil {
+		errs = append(errs, types.PrefixPath("auth", c.Auth.Validate())...)
+	}
+	if c.Login != nil {
+		errs = append(errs, types.PrefixPath("login", c.Login.Validate())...)
+	}
+	if c.TLSCertFile != "" && c.TLSKeyFile == "" {
+		errs = append(errs, types.NewValidationError("tls_key_file", "must be set with tls_cert_file"))
+	}
+	if c.TLSKeyFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, types.NewValidationError("tls_cert_file", "must be set with tls_key_file"))
+	}
+	if _, ok := tlsVersions[c.TLSMinVersion]; c.TLSMinVersion != "" && !ok {
+		errs = append(errs, types.NewValidationError("tls_min_version", "unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", c.TLSMinVersion))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":           c.Every.Duration,
+		"timeout":         c.Timeout.Duration,
+		"threshold_rtt":   c.ThresholdRTT,
+		"attempt_spacing": c.AttemptSpacing,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
 // Check performs checks using c according to its configuration.
 // An error is only returned if there is a configuration error.
-func (c *Checker) Check() (types.Result, error) {
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
 	if c.Attempts < 1 {
 		c.Attempts = 1
 	}
-	if c.Client == nil {
-		c.Client = DefaultHTTPClient
-	}
 
 	result := types.NewResult()
 	result.Type = c.Type()
 	result.Title = c.Name
 	result.Endpoint = c.URL
 
-	if c.Proxy != "" {
-		client, err := newProxyClient(c.Proxy)
+	if c.Client == nil {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return result, err
+		}
+		client, err := newClient(c.Proxy, tlsConfig, c.Protocol)
 		if err != nil {
 			return result, err
 		}
 		c.Client = client
 	}
 
-	req, err := http.NewRequest("GET", c.URL, nil)
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), c.URL, nil)
 	if err != nil {
 		return result, err
 	}
@@ -139,74 +510,337 @@ func (c *Checker) Check() (types.Result, error) {
 		}
 	}
 
+	if c.Compression && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
 	// Add customized User-Agent
 	if req.Header.Get("User-Agent") == "" {
 		req.Header.Add("User-Agent", fmt.Sprintf("checkup/%s", "0.0.1"))
 	}
 
-	result.Times = c.doChecks(req)
+	m, err := c.compile()
+	if err != nil {
+		return result, err
+	}
+
+	body, contentType, err := c.requestBody()
+	if err != nil {
+		return result, err
+	}
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	result.Details = map[string]string{"request_method": req.Method}
+	if body != nil {
+		result.Details["request_content_type"] = req.Header.Get("Content-Type")
+		result.Details["request_body_bytes"] = strconv.Itoa(len(body))
+	}
+
+	var r report
+	result.Times = c.doChecks(ctx, req, body, m, &r)
 
-	return c.conclude(result), nil
+	return c.conclude(result, &r), nil
 }
 
-// doChecks executes req using c.Client and returns each attempt.
-func (c *Checker) doChecks(req *http.Request) types.Attempts {
+// compile compiles the regular expressions of c.
+func (c *Checker) compile() (*matchers, error) {
+	var (
+		m   matchers
+		err error
+	)
+	if c.MustMatch != "" {
+		if m.mustMatch, err = regexp.Compile(c.MustMatch); err != nil {
+			return nil, fmt.Errorf("must_match: %w", err)
+		}
+	}
+	if c.MustNotMatch != "" {
+		if m.mustNotMatch, err = regexp.Compile(c.MustNotMatch); err != nil {
+			return nil, fmt.Errorf("must_not_match: %w", err)
+		}
+	}
+	m.headers = make([]*regexp.Regexp, len(c.HeaderAssertions))
+	for i, assertion := range c.HeaderAssertions {
+		if assertion.Matches == "" {
+			continue
+		}
+		if m.headers[i], err = regexp.Compile(assertion.Matches); err != nil {
+			return nil, fmt.Errorf("header_assertions[%d].matches: %w", i, err)
+		}
+	}
+	return &m, nil
+}
+
+// requestBody returns the request body configured in c,
+// nil if there is none, and the content type it implies.
+func (c *Checker) requestBody() ([]byte, string, error) {
+	contentType := c.ContentType
+	setDefault := func(t string) {
+		if contentType == "" {
+			contentType = t
+		}
+	}
+
+	switch {
+	case c.Body != "":
+		return []byte(c.Body), contentType, nil
+	case c.BodyFile != "":
+		body, err := ioutil.ReadFile(c.BodyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading body_file: %w", err)
+		}
+		return body, contentType, nil
+	case len(c.Form) > 0:
+		form := url.Values{}
+		for key, value := range c.Form {
+			form.Set(key, value)
+		}
+		setDefault("application/x-www-form-urlencoded")
+		return []byte(form.Encode()), contentType, nil
+	case len(c.JSONBody) > 0:
+		setDefault("application/json")
+		return []byte(c.JSONBody), contentType, nil
+	}
+	return nil, contentType, nil
+}
+
+// doChecks executes req with body using c.Client and returns
+// each attempt, reporting the responses in r. The body is sent
+// anew by every attempt.
+func (c *Checker) doChecks(ctx context.Context, req *http.Request, body []byte, m *matchers, r *report) types.Attempts {
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
 	checks := make(types.Attempts, c.Attempts)
 	for i := 0; i < c.Attempts; i++ {
+		checks[i] = c.doCheck(ctx, withBody(req, body), timeout, m, r)
+		if c.AttemptSpacing > 0 {
+			select {
+			case <-time.After(c.AttemptSpacing):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return checks
+}
+
+// withBody returns a copy of req sending body, if not nil.
+func withBody(req *http.Request, body []byte) *http.Request {
+	req = req.Clone(req.Context())
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.ContentLength = int64(len(body))
+	}
+	return req
+}
+
+// doCheck executes a single attempt of req bounded by timeout,
+// reporting the response in r. The phases of the attempt are
+// timed until the response has been read.
+func (c *Checker) doCheck(ctx context.Context, req *http.Request, timeout time.Duration, m *matchers, r *report) (attempt types.Attempt) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.authenticate(ctx, req); err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	var t tracer
+	ctx = httptrace.WithClientTrace(ctx, t.clientTrace())
+	defer func() {
+		attempt.Timings = t.done()
+	}()
+
+	start := time.Now()
+	resp, err := c.do(req.WithContext(ctx), &attempt)
+	attempt.RTT = time.Since(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	r.response = negotiated(resp)
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.resetAuth()
+	}
+	if err = c.checkRedirects(attempt.Steps); err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	warnings, err := c.checkDown(resp, m, r)
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	for _, warning := range warnings {
+		if !containsString(r.warnings, warning) {
+			r.warnings = append(r.warnings, warning)
+		}
+	}
+	return attempt
+}
+
+// do executes req using c.Client, following redirects if
+// configured, in which case every request is recorded as a
+// step of attempt. It returns the final response.
+func (c *Checker) do(req *http.Request, attempt *types.Attempt) (*http.Response, error) {
+	maxRedirects := c.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+
+	for redirects := 0; ; redirects++ {
 		start := time.Now()
 		resp, err := c.Client.Do(req)
-		checks[i].RTT = time.Since(start)
+		if !c.FollowRedirects {
+			return resp, err
+		}
+
+		step := types.Step{Name: req.URL.String(), RTT: time.Since(start)}
 		if err != nil {
-			checks[i].Error = err.Error()
-			continue
+			step.Error = err.Error()
+		} else {
+			step.Code = resp.StatusCode
 		}
-		err = c.checkDown(resp)
+		attempt.Steps = append(attempt.Steps, step)
 		if err != nil {
-			checks[i].Error = err.Error()
+			return nil, err
+		}
+
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			return resp, nil
 		}
 		resp.Body.Close()
-		if c.AttemptSpacing > 0 {
-			time.Sleep(c.AttemptSpacing)
+		if redirects == maxRedirects {
+			return nil, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		next, err := req.URL.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect location '%s': %v", location, err)
+		}
+		if c.NoDowngrade && req.URL.Scheme == "https" && next.Scheme == "http" {
+			return nil, fmt.Errorf("redirect downgrades from %s to %s", req.URL, next)
+		}
+		if req, err = redirectRequest(req, next, resp.StatusCode); err != nil {
+			return nil, err
 		}
 	}
-	return checks
+}
+
+// isRedirect returns whether code is a redirect status code
+// that is followed.
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectRequest returns the request following the redirect
+// of req to u with code, like http.Client does: 307 and 308
+// keep the method and body, the others turn into a GET.
+// Credentials are not sent to another host.
+func redirectRequest(req *http.Request, u *url.URL, code int) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	next.URL = u
+	next.Host = ""
+	if u.Host == req.URL.Host {
+		next.Host = req.Host
+	} else {
+		for _, key := range []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"} {
+			next.Header.Del(key)
+		}
+	}
+
+	keepBody := code == http.StatusTemporaryRedirect || code == http.StatusPermanentRedirect
+	if !keepBody {
+		if req.Method != http.MethodHead {
+			next.Method = http.MethodGet
+		}
+		next.Body, next.GetBody, next.ContentLength = nil, nil, 0
+		next.Header.Del("Content-Type")
+		return next, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
+
+// checkRedirects checks the redirects followed in steps against
+// the configuration of c. It returns a non-nil error if down.
+func (c *Checker) checkRedirects(steps []types.Step) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	if c.ExpectRedirects != nil && len(steps)-1 != *c.ExpectRedirects {
+		return fmt.Errorf("followed %d redirects, expected %d", len(steps)-1, *c.ExpectRedirects)
+	}
+	if final := steps[len(steps)-1].Name; c.FinalURL != "" && final != c.FinalURL {
+		return fmt.Errorf("final URL is '%s', expected '%s'", final, c.FinalURL)
+	}
+	return nil
 }
 
 // conclude takes the data in result from the attempts and
 // computes remaining values needed to fill out the result.
-// It detects degraded (high-latency) responses and makes
-// the conclusion about the result's status.
-func (c *Checker) conclude(result types.Result) types.Result {
+// It detects degraded (high-latency, slow phases or failing assertions)
+// responses and makes the conclusion about the result's status.
+func (c *Checker) conclude(result types.Result, r *report) types.Result {
 	result.ThresholdRTT = c.ThresholdRTT
 
-	// Check errors (down)
-	for i := range result.Times {
-		if result.Times[i].Error != "" {
-			result.Down = true
+	for key, value := range r.response {
+		if result.Details == nil {
+			result.Details = make(map[string]string)
+		}
+		result.Details[key] = value
+	}
+
+	phases := medianPhases(result.Times)
+	if phases != nil {
+		for _, name := range Phases {
 			m, _ := metric.New(
 				"checkup_http",
 				map[string]string{
 					"title":    result.Title,
 					"endpoint": result.Endpoint,
+					"phase":    name,
 				}, map[string]interface{}{
-					"healthy": 0,
+					"phase_seconds": phases[name].Seconds(),
 				}, time.Now(), metric.Gauge,
 			)
 			c.metrics = append(c.metrics, m)
+		}
+	}
+
+	// Check errors (down)
+	for i := range result.Times {
+		if result.Times[i].Error != "" {
+			result.Down = true
 			return result
 		}
 	}
 
-	m, _ := metric.New(
-		"checkup_http",
-		map[string]string{
-			"title":    result.Title,
-			"endpoint": result.Endpoint,
-		}, map[string]interface{}{
-			"healthy": 1,
-		}, time.Now(), metric.Gauge,
-	)
-	c.metrics = append(c.metrics, m)
+	// Check failed assertions (degraded)
+	if len(r.warnings) > 0 {
+		result.Notice = strings.Join(r.warnings, "; ")
+		result.Degraded = true
+		return result
+	}
 
 	// Check round trip time (degraded)
 	if c.ThresholdRTT > 0 {
@@ -218,101 +852,319 @@ func (c *Checker) conclude(result types.Result) types.Result {
 		}
 	}
 
+	// Check phases (degraded)
+	for _, name := range Phases {
+		threshold := c.PhaseThresholds[name].Duration
+		if threshold > 0 && phases[name] > threshold {
+			result.Notice = fmt.Sprintf("median %s time exceeded threshold (%s)", name, threshold)
+			result.Degraded = true
+			return result
+		}
+	}
+
 	result.Healthy = true
 	return result
 }
 
 // checkDown checks whether the endpoint is down based on resp and
-// the configuration of c. It returns a non-nil error if down.
-// Note that it does not check for degraded response.
-func (c *Checker) checkDown(resp *http.Response) error {
+// the configuration of c, reporting the body in r. It returns a
+// non-nil error if down, and the failed assertions which degrade
+// the endpoint otherwise.
+func (c *Checker) checkDown(resp *http.Response, m *matchers, r *report) ([]string, error) {
+	// Read response body, which also times the transfer
+	keep := m.mustMatch != nil || m.mustNotMatch != nil || len(c.JSONAssertions) > 0
+	body, bodyErr := c.readBody(resp, c.maxBodyBytes(), keep)
+	if r.response == nil {
+		r.response = make(map[string]string)
+	}
+	for key, value := range body.details() {
+		r.response[key] = value
+	}
+
+	// Check protocol
+	if want := protocolMajor[c.Protocol]; want != 0 && resp.ProtoMajor != want {
+		return nil, fmt.Errorf("response protocol %s, expected HTTP/%d", resp.Proto, want)
+	}
+
 	// Check status code
-	var validStatus map[int]bool
-	if c.UpStatus > 0 {
-		// Explicit match against expected UpStatus
-		validStatus = map[int]bool{
-			c.UpStatus: true,
+	upStatus := c.UpStatus
+	if len(upStatus) == 0 {
+		upStatus = DefaultUpStatus
+	}
+	if !upStatus.Contains(resp.StatusCode) {
+		return nil, fmt.Errorf("response status %s", resp.Status)
+	}
+
+	// Check response headers
+	for i, assertion := range c.HeaderAssertions {
+		if err := checkHeader(resp.Header, assertion, m.headers[i]); err != nil {
+			return nil, err
 		}
-	} else {
-		// Treat 200-204 as successful
-		validStatus = map[int]bool{
-			http.StatusOK:                   true,
-			http.StatusCreated:              true,
-			http.StatusAccepted:             true,
-			http.StatusNonAuthoritativeInfo: true,
-			http.StatusNoContent:            true,
+	}
+
+	// Check response body
+	if bodyErr != nil {
+		return nil, fmt.Errorf("reading response body: %w", bodyErr)
+	}
+	if c.BodySize != nil {
+		if err := body.checkSize(*c.BodySize); err != nil {
+			return nil, err
 		}
 	}
-	if !validStatus[resp.StatusCode] {
-		return fmt.Errorf("response status %s", resp.Status)
+	if body.contains != nil && !body.contains.found {
+		return nil, fmt.Errorf("response does not contain '%s'", c.MustContain)
+	}
+	if body.notContains != nil && body.notContains.found {
+		return nil, fmt.Errorf("response contains '%s'", c.MustNotContain)
+	}
+	if m.mustMatch != nil && !m.mustMatch.Match(body.data.Bytes()) {
+		return nil, fmt.Errorf("response does not match '%s'", c.MustMatch)
+	}
+	if m.mustNotMatch != nil && m.mustNotMatch.Match(body.data.Bytes()) {
+		return nil, fmt.Errorf("response matches '%s'", c.MustNotMatch)
+	}
+	if len(c.JSONAssertions) > 0 {
+		return c.checkJSON(body.data.Bytes())
 	}
 
-	// Check response body
-	if c.MustContain == "" && c.MustNotContain == "" {
+	return nil, nil
+}
+
+// checkHeader checks assertion, whose Matches is compiled
+// to re, against header.
+func checkHeader(header http.Header, assertion HeaderAssertion, re *regexp.Regexp) error {
+	values, present := header[http.CanonicalHeaderKey(assertion.Name)]
+	if assertion.Absent {
+		if present {
+			return fmt.Errorf("response header %s is present", assertion.Name)
+		}
 		return nil
 	}
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("reading response body: %w", err)
+	if !present {
+		return fmt.Errorf("response header %s is missing", assertion.Name)
 	}
-	body := string(bodyBytes)
-	if c.MustContain != "" && !strings.Contains(body, c.MustContain) {
-		return fmt.Errorf("response does not contain '%s'", c.MustContain)
+	value := strings.Join(values, ", ")
+	if assertion.Equals != "" && value != assertion.Equals {
+		return fmt.Errorf("response header %s is '%s', expected '%s'", assertion.Name, value, assertion.Equals)
 	}
-	if c.MustNotContain != "" && strings.Contains(body, c.MustNotContain) {
-		return fmt.Errorf("response contains '%s'", c.MustNotContain)
+	if re != nil && !re.MatchString(value) {
+		return fmt.Errorf("response header %s '%s' does not match '%s'", assertion.Name, value, assertion.Matches)
 	}
-
 	return nil
 }
 
+// checkJSON checks the JSONAssertions of c against body. A failed
+// assertion is returned as the error, or with the warnings if they
+// degrade.
+func (c *Checker) checkJSON(body []byte) (warnings []string, err error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("response is not JSON: %v", err)
+	}
+	for _, assertion := range c.JSONAssertions {
+		err := assertion.Check(doc)
+		if err == nil {
+			continue
+		}
+		if !c.JSONAssertionsDegraded {
+			return nil, err
+		}
+		warnings = append(warnings, err.Error())
+	}
+	return warnings, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 // DefaultHTTPClient is used when no other http.Client
 // is specified on a Checker.
+// Requests are bounded by the deadline of the Checker
+// rather than by timeouts on the client.
 var DefaultHTTPClient = &http.Client{
 	Transport: &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
-		Dial: (&net.Dialer{
-			Timeout:   10 * time.Second,
+		DialContext: (&net.Dialer{
 			KeepAlive: 0,
-		}).Dial,
-		TLSHandshakeTimeout:   5 * time.Second,
+		}).DialContext,
 		ExpectContinueTimeout: 1 * time.Second,
 		MaxIdleConnsPerHost:   1,
 		DisableCompression:    true,
 		DisableKeepAlives:     true,
-		ResponseHeaderTimeout: 5 * time.Second,
 	},
 	CheckRedirect: func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	},
-	Timeout: 10 * time.Second,
 }
 
-func newProxyClient(proxy string) (*http.Client, error) {
-	proxyURL, err := url.Parse(proxy)
+// maxBodyBytes returns how many bytes of response bodies are read.
+func (c *Checker) maxBodyBytes() int64 {
+	if c.MaxBodyBytes > 0 {
+		return c.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// protocolMajor is the HTTP major version of each Protocol.
+var protocolMajor = map[string]int{
+	ProtocolHTTP1: 1,
+	ProtocolHTTP2: 2,
+	ProtocolH2C:   2,
+}
+
+// newClient returns a client like DefaultHTTPClient using proxy,
+// tlsConfig and protocol, or DefaultHTTPClient if none is set.
+func newClient(proxy string, tlsConfig *tls.Config, protocol string) (*http.Client, error) {
+	if proxy == "" && tlsConfig == nil && protocol == "" {
+		return DefaultHTTPClient, nil
+	}
+	client := &http.Client{
+		CheckRedirect: DefaultHTTPClient.CheckRedirect,
+	}
+
+	if protocol == ProtocolH2C {
+		client.Transport = &h2cTransport{
+			transport: &http2.Transport{AllowHTTP: true, DisableCompression: true},
+		}
+		return client, nil
+	}
+
+	transport := DefaultHTTPClient.Transport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	switch protocol {
+	case ProtocolHTTP1:
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	case ProtocolHTTP2:
+		transport.ForceAttemptHTTP2 = true
+	}
+	client.Transport = transport
+	return client, nil
+}
+
+// h2cTransport makes every request over a new HTTP/2 connection
+// without TLS. Like DefaultHTTPClient, it does not reuse connections
+// so that every attempt is timed connecting. Dialing is bounded by
+// the context of the request, i.e. the Timeout of the attempt.
+type h2cTransport struct {
+	transport *http2.Transport
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	conn, err := (&net.Dialer{}).DialContext(req.Context(), "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	cc, err := t.transport.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+	resp.Body = &connBody{ReadCloser: resp.Body, conn: cc}
+	return resp, nil
+}
+
+// connBody is a response body closing the connection
+// it was received over when closed.
+type connBody struct {
+	io.ReadCloser
+	conn io.Closer
+}
+
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
+
+// negotiated returns the protocol resp was received over and,
+// for TLS connections, the ALPN result, TLS version and cipher.
+func negotiated(resp *http.Response) map[string]string {
+	details := map[string]string{"protocol": resp.Proto}
+	if resp.TLS == nil {
+		return details
+	}
+	details["alpn"] = resp.TLS.NegotiatedProtocol
+	if details["alpn"] == "" {
+		details["alpn"] = "none"
+	}
+	for name, version := range tlsVersions {
+		if version == resp.TLS.Version {
+			details["tls_version"] = "TLS " + name
+		}
+	}
+	details["tls_cipher"] = tls.CipherSuiteName(resp.TLS.CipherSuite)
+	return details
+}
+
+// tlsVersions are the values of TLSMinVersion.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConfig returns the TLS config based on configuration,
+// nil if no TLS option is set.
+func (c *Checker) tlsConfig() (*tls.Config, error) {
+	if c.TLSCAFile == "" && c.TLSCertFile == "" && c.TLSKeyFile == "" &&
+		c.TLSServerName == "" && c.TLSMinVersion == "" && !c.TLSSkipVerify {
+		return nil, nil
+	}
 
-	return &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-			Dial: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 0,
-			}).Dial,
-			TLSHandshakeTimeout:   5 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			MaxIdleConnsPerHost:   1,
-			DisableCompression:    true,
-			DisableKeepAlives:     true,
-			ResponseHeaderTimeout: 5 * time.Second,
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-		Timeout: 10 * time.Second,
-	}, nil
+	tlsConfig := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+	if c.TLSMinVersion != "" {
+		version, ok := tlsVersions[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls_min_version %q", c.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if c.TLSCAFile != "" {
+		pool, err := checkutil.LoadCAFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := checkutil.LoadKeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
 }
 
 func (c *Checker) Collect(collector checkup_prometheus_client.Collector) {
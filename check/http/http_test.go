@@ -1,11 +1,30 @@
 package http
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/feifeigood/checkup/types"
 )
 
 func TestChecker(t *testing.T) {
@@ -17,7 +36,7 @@ func TestChecker(t *testing.T) {
 	hc := Checker{Name: "Test", URL: endpt, Attempts: 2}
 
 	// Try an up server
-	result, err := hc.Check()
+	result, err := hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -46,8 +65,8 @@ func TestChecker(t *testing.T) {
 
 	// Try various different down criteria
 
-	hc.UpStatus = 201
-	result, err = hc.Check()
+	hc.UpStatus = StatusSet{{201, 201}}
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -55,9 +74,9 @@ func TestChecker(t *testing.T) {
 		t.Errorf("Expected result.Down=%v, got %v", want, got)
 	}
 
-	hc.UpStatus = 200
+	hc.UpStatus = StatusSet{{200, 200}}
 	hc.ThresholdRTT = 1 * time.Nanosecond
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -67,7 +86,7 @@ func TestChecker(t *testing.T) {
 
 	hc.ThresholdRTT = 0
 	hc.MustContain = "up"
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -76,7 +95,7 @@ func TestChecker(t *testing.T) {
 	}
 
 	hc.MustContain = "online"
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -86,7 +105,7 @@ func TestChecker(t *testing.T) {
 
 	hc.MustContain = ""
 	hc.MustNotContain = "down"
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -95,7 +114,7 @@ func TestChecker(t *testing.T) {
 	}
 
 	hc.MustNotContain = "I"
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -110,7 +129,7 @@ func TestChecker(t *testing.T) {
 	hc.MustNotContain = ""
 	hc.MustContain = "Echo"
 	hc.ThresholdRTT = 0
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -125,7 +144,7 @@ func TestChecker(t *testing.T) {
 	hc.MustContain = "@http.check.local"
 	hc.MustNotContain = ""
 	hc.ThresholdRTT = 0
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
@@ -136,7 +155,7 @@ func TestChecker(t *testing.T) {
 
 	// Try when the server is not even online
 	srv.Listener.Close()
-	result, err = hc.Check()
+	result, err = hc.Check(context.Background())
 	if err != nil {
 		t.Errorf("Didn't expect an error: %v", err)
 	}
@@ -147,3 +166,576 @@ func TestChecker(t *testing.T) {
 		t.Errorf("Expected result.Down=%v, got %v", want, got)
 	}
 }
+
+func TestCheckerTimeout(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	hc := Checker{Name: "Test", URL: srv.URL, Attempts: 1, Timeout: types.Duration{Duration: 50 * time.Millisecond}}
+
+	start := time.Now()
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected check to honor timeout, took %s", elapsed)
+	}
+
+	// Cancelling the context aborts the check
+	hc.Timeout = types.Duration{}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start = time.Now()
+	result, err = hc.Check(ctx)
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected check to be aborted, took %s", elapsed)
+	}
+}
+
+func TestCheckerRequestBody(t *testing.T) {
+	type request struct {
+		method, contentType, body string
+	}
+	requests := make(chan request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.Method, r.Header.Get("Content-Type"), string(body)}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "checkup")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	bodyFile := filepath.Join(dir, "body.xml")
+	if err := ioutil.WriteFile(bodyFile, []byte("<ping/>"), 0600); err != nil {
+		t.Fatalf("Cannot write body file: %v", err)
+	}
+
+	for i, test := range []struct {
+		hc   Checker
+		want request
+	}{
+		{Checker{Method: "post", Body: "ping"}, request{"POST", "", "ping"}},
+		{Checker{Method: "PUT", BodyFile: bodyFile, ContentType: "application/xml"}, request{"PUT", "application/xml", "<ping/>"}},
+		{Checker{Method: "POST", Form: map[string]string{"user": "checkup", "q": "a b"}}, request{"POST", "application/x-www-form-urlencoded", "q=a+b&user=checkup"}},
+		{Checker{Method: "POST", JSONBody: json.RawMessage(`{"query":"up"}`)}, request{"POST", "application/json", `{"query":"up"}`}},
+		{Checker{Method: "POST", JSONBody: json.RawMessage(`{}`), Headers: http.Header{"Content-Type": {"application/vnd.api+json"}}}, request{"POST", "application/vnd.api+json", `{}`}},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL, hc.Attempts = "Test", srv.URL, 2
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Healthy, true; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+		// Every attempt sends the whole body
+		for j := 0; j < hc.Attempts; j++ {
+			if got := <-requests; got != test.want {
+				t.Errorf("Test %d: Expected attempt %d to send %+v, got %+v", i, j, test.want, got)
+			}
+		}
+		if got, want := result.Details["request_method"], test.want.method; got != want {
+			t.Errorf("Test %d: Expected request_method '%s', got '%s'", i, want, got)
+		}
+		if got, want := result.Details["request_body_bytes"], fmt.Sprint(len(test.want.body)); got != want {
+			t.Errorf("Test %d: Expected request_body_bytes '%s', got '%s'", i, want, got)
+		}
+	}
+
+	hc := Checker{Name: "Test", URL: srv.URL, BodyFile: filepath.Join(dir, "missing")}
+	if _, err := hc.Check(context.Background()); err == nil {
+		t.Errorf("Expected an error for a missing body_file")
+	}
+}
+
+func TestCheckerJSONAssertions(t *testing.T) {
+	body := `{"status":"UP","db":{"status":"DOWN"}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	var hc Checker
+	err := json.Unmarshal([]byte(`{"json_assertions": ["$.status == \"UP\"", "$.db.status == \"UP\""]}`), &hc)
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	hc.Name, hc.URL, hc.Attempts = "Test", srv.URL, 2
+
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if got, want := result.Times[0].Error, `$.db.status: expected == "UP", got "DOWN"`; got != want {
+		t.Errorf("Expected error '%s', got '%s'", want, got)
+	}
+
+	// Degrade instead
+	hc.JSONAssertionsDegraded = true
+	result, err = hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Degraded, true; got != want {
+		t.Errorf("Expected result.Degraded=%v, got %v", want, got)
+	}
+	if got, want := result.Notice, `$.db.status: expected == "UP", got "DOWN"`; got != want {
+		t.Errorf("Expected notice '%s', got '%s'", want, got)
+	}
+
+	// Healthy once the assertions pass
+	body = `{"status":"UP","db":{"status":"UP"}}`
+	result, err = hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%s)", want, got, result.Notice)
+	}
+
+	// A body that is not JSON is down even when degrading
+	body = "<html>"
+	result, err = hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+}
+
+func TestCheckerResponseAssertions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("X-Served-By", "cache-fra-1")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "version: 1.4.2")
+	}))
+	defer srv.Close()
+
+	for i, test := range []struct {
+		hc   Checker
+		want string
+	}{
+		{Checker{}, "response status 404 Not Found"},
+		{Checker{UpStatus: StatusSet{{200, 299}, {404, 404}}}, ""},
+		{Checker{UpStatus: StatusSet{{400, 499}}, MustMatch: `version: 1\.\d+`}, ""},
+		{Checker{UpStatus: StatusSet{{400, 499}}, MustMatch: `version: 2\.`}, `response does not match 'version: 2\.'`},
+		{Checker{UpStatus: StatusSet{{400, 499}}, MustNotMatch: `\d+\.\d+\.2`}, `response matches '\d+\.\d+\.2'`},
+		{Checker{UpStatus: StatusSet{{400, 499}}, HeaderAssertions: []HeaderAssertion{
+			{Name: "cache-control"},
+			{Name: "X-Served-By", Matches: "^cache-"},
+			{Name: "X-Debug", Absent: true},
+		}}, ""},
+		{Checker{UpStatus: StatusSet{{400, 499}}, HeaderAssertions: []HeaderAssertion{{Name: "Age"}}}, "response header Age is missing"},
+		{Checker{UpStatus: StatusSet{{400, 499}}, HeaderAssertions: []HeaderAssertion{{Name: "Cache-Control", Absent: true}}}, "response header Cache-Control is present"},
+		{Checker{UpStatus: StatusSet{{400, 499}}, HeaderAssertions: []HeaderAssertion{{Name: "Cache-Control", Equals: "no-cache"}}}, "response header Cache-Control is 'public, max-age=60', expected 'no-cache'"},
+		{Checker{UpStatus: StatusSet{{400, 499}}, HeaderAssertions: []HeaderAssertion{{Name: "X-Served-By", Matches: "^edge-"}}}, "response header X-Served-By 'cache-fra-1' does not match '^edge-'"},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL = "Test", srv.URL
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+			continue
+		}
+		if got, want := result.Times[0].Error, test.want; got != want {
+			t.Errorf("Test %d: Expected error '%s', got '%s'", i, want, got)
+		}
+	}
+
+	hc := Checker{Name: "Test", URL: srv.URL, MustMatch: "("}
+	if _, err := hc.Check(context.Background()); err == nil {
+		t.Errorf("Expected an error for an invalid must_match")
+	}
+}
+
+func TestCheckerRedirects(t *testing.T) {
+	methods := make(chan string, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login/", http.StatusFound)
+	})
+	mux.HandleFunc("/login/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "login")
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		methods <- r.Method + " " + string(body)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	one, two := 1, 2
+	for i, test := range []struct {
+		hc    Checker
+		want  string
+		steps []int
+	}{
+		{Checker{}, "response status 301 Moved Permanently", nil},
+		{Checker{FollowRedirects: true, FinalURL: srv.URL + "/login/", ExpectRedirects: &two}, "", []int{301, 302, 200}},
+		{Checker{FollowRedirects: true, ExpectRedirects: &one}, "followed 2 redirects, expected 1", []int{301, 302, 200}},
+		{Checker{FollowRedirects: true, FinalURL: srv.URL + "/home"}, "final URL is '" + srv.URL + "/login/', expected '" + srv.URL + "/home'", []int{301, 302, 200}},
+		{Checker{FollowRedirects: true, MaxRedirects: 1}, "stopped after 1 redirects", []int{301, 302}},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL = "Test", srv.URL
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+			continue
+		}
+		if got, want := result.Times[0].Error, test.want; got != want {
+			t.Errorf("Test %d: Expected error '%s', got '%s'", i, want, got)
+		}
+		var steps []int
+		for _, step := range result.Times[0].Steps {
+			steps = append(steps, step.Code)
+		}
+		if got, want := fmt.Sprint(steps), fmt.Sprint(test.steps); got != want {
+			t.Errorf("Test %d: Expected steps %s, got %s", i, want, got)
+		}
+	}
+
+	// 307 keeps the method and body
+	hc := Checker{Name: "Test", URL: srv.URL + "/submit", Method: "POST", Body: "data", FollowRedirects: true}
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+	if got, want := <-methods, "POST data"; got != want {
+		t.Errorf("Expected redirected request '%s', got '%s'", want, got)
+	}
+
+	// A downgrade is not followed
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL+"/login/", http.StatusFound)
+	}))
+	defer secure.Close()
+	client := secure.Client()
+	client.CheckRedirect = DefaultHTTPClient.CheckRedirect
+
+	hc = Checker{Name: "Test", URL: secure.URL, Client: client, FollowRedirects: true}
+	result, err = hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+
+	hc.NoDowngrade = true
+	result, err = hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Times[0].Error, "redirect downgrades from "+secure.URL+" to "+srv.URL+"/login/"; got != want {
+		t.Errorf("Expected error '%s', got '%s'", want, got)
+	}
+}
+
+func TestCheckerTimings(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, "slow")
+	}))
+	defer srv.Close()
+
+	// Connect anew like DefaultHTTPClient
+	client := srv.Client()
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+
+	hc := Checker{Name: "Test", URL: srv.URL, Client: client, Attempts: 3}
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%s)", want, got, result.Notice)
+	}
+	for i, attempt := range result.Times {
+		timings := attempt.Timings
+		if timings == nil {
+			t.Fatalf("Attempt %d: Expected timings", i)
+		}
+		if timings.Connect <= 0 || timings.TLS <= 0 {
+			t.Errorf("Attempt %d: Expected connect and TLS to be timed, got %+v", i, *timings)
+		}
+		if timings.FirstByte < 20*time.Millisecond {
+			t.Errorf("Attempt %d: Expected first byte after at least 20ms, got %s", i, timings.FirstByte)
+		}
+		if timings.DNS != 0 {
+			t.Errorf("Attempt %d: Expected no DNS lookup of an IP, got %s", i, timings.DNS)
+		}
+	}
+
+	var phases []string
+	for _, m := range hc.metrics {
+		if m.Name() == "checkup_http" {
+			phases = append(phases, m.Tags()["phase"])
+		}
+	}
+	if got, want := strings.Join(phases, ","), strings.Join(Phases, ","); got != want {
+		t.Errorf("Expected metrics for phases %s, got %s", want, got)
+	}
+
+	hc.PhaseThresholds = map[string]types.Duration{"first_byte": {Duration: 5 * time.Millisecond}}
+	result, err = hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Degraded, true; got != want {
+		t.Errorf("Expected result.Degraded=%v, got %v", want, got)
+	}
+	if got, want := result.Notice, "median first_byte time exceeded threshold (5ms)"; got != want {
+		t.Errorf("Expected notice '%s', got '%s'", want, got)
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and its
+// key to dir and returns their paths and the certificate.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "checkup"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("Cannot parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Cannot marshal key: %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatalf("Cannot write %s: %v", file, err)
+		}
+	}
+	return certFile, keyFile, cert
+}
+
+func TestCheckerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkup")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatalf("Cannot write CA file: %v", err)
+	}
+
+	for i, test := range []struct {
+		hc      Checker
+		healthy bool
+	}{
+		{Checker{TLSCAFile: caFile}, false},
+		{Checker{TLSSkipVerify: true}, false},
+		{Checker{TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile, MustContain: "checkup"}, true},
+		{Checker{TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile, TLSServerName: "example.com", TLSMinVersion: "1.2"}, true},
+		{Checker{TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile, TLSServerName: "example.org"}, false},
+		{Checker{TLSCertFile: certFile, TLSKeyFile: keyFile}, false},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL, hc.Attempts = "Test", srv.URL, 2
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Healthy, test.healthy; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+
+		// The client is built once and kept
+		client := hc.Client
+		if client == DefaultHTTPClient {
+			t.Errorf("Test %d: Expected a client with the TLS options", i)
+		}
+		if _, err := hc.Check(context.Background()); err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if hc.Client != client {
+			t.Errorf("Test %d: Expected the client to be reused", i)
+		}
+	}
+
+	hc := Checker{Name: "Test", URL: srv.URL, TLSCertFile: filepath.Join(dir, "missing.pem"), TLSKeyFile: keyFile}
+	if _, err := hc.Check(context.Background()); err == nil {
+		t.Errorf("Expected an error for a missing tls_cert_file")
+	}
+}
+
+func TestCheckerProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	tlsSrv := httptest.NewUnstartedServer(handler)
+	tlsSrv.EnableHTTP2 = true
+	tlsSrv.StartTLS()
+	defer tlsSrv.Close()
+	h2cSrv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cSrv.Close()
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	for i, test := range []struct {
+		hc      Checker
+		details map[string]string
+		err     string
+	}{
+		{
+			hc:      Checker{URL: tlsSrv.URL, Protocol: ProtocolHTTP2, MustContain: "HTTP/2.0"},
+			details: map[string]string{"protocol": "HTTP/2.0", "alpn": "h2", "tls_version": "TLS 1.3", "tls_cipher": "TLS_AES_128_GCM_SHA256"},
+		},
+		{
+			hc:      Checker{URL: tlsSrv.URL, Protocol: ProtocolHTTP1, MustContain: "HTTP/1.1"},
+			details: map[string]string{"protocol": "HTTP/1.1", "alpn": "none"},
+		},
+		{
+			hc:      Checker{URL: h2cSrv.URL, Protocol: ProtocolH2C, MustContain: "HTTP/2.0"},
+			details: map[string]string{"protocol": "HTTP/2.0"},
+		},
+		{
+			hc:      Checker{URL: tlsSrv.URL},
+			details: map[string]string{"protocol": "HTTP/1.1", "alpn": "none"},
+		},
+		{
+			hc:  Checker{URL: srv.URL, Protocol: ProtocolH2C},
+			err: "unexpected EOF",
+		},
+	} {
+		hc := test.hc
+		hc.Name, hc.TLSSkipVerify = "Test", strings.HasPrefix(hc.URL, "https:")
+		hc.Attempts = 2
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if test.err != "" {
+			if got := result.Times[0].Error; !result.Down || !strings.Contains(got, test.err) {
+				t.Errorf("Test %d: Expected down with error containing '%s', got '%s'", i, test.err, got)
+			}
+			continue
+		}
+		if got, want := result.Healthy, true; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+		for key, want := range test.details {
+			if got := result.Details[key]; got != want {
+				t.Errorf("Test %d: Expected details %s=%s, got %s", i, key, want, got)
+			}
+		}
+		// Connections are not reused
+		for j, attempt := range result.Times {
+			if attempt.Timings == nil || attempt.Timings.Connect <= 0 {
+				t.Errorf("Test %d: Expected attempt %d to be timed connecting, got %+v", i, j, attempt.Timings)
+			}
+		}
+	}
+
+	// The server does not speak the expected protocol
+	hc := Checker{Name: "Test", URL: tlsSrv.URL, Protocol: ProtocolHTTP1, TLSSkipVerify: true}
+	if _, err := hc.checkDown(&http.Response{Proto: "HTTP/2.0", ProtoMajor: 2, StatusCode: 200, Body: http.NoBody}, &matchers{}, &report{}); err == nil || err.Error() != "response protocol HTTP/2.0, expected HTTP/1" {
+		t.Errorf("Expected a protocol mismatch, got %v", err)
+	}
+}
+
+func TestCheckerProtocolValidate(t *testing.T) {
+	for i, test := range []struct {
+		hc   Checker
+		want string
+	}{
+		{Checker{URL: "https://localhost", Protocol: "spdy"}, `protocol: unknown protocol "spdy", expected http1, http2 or h2c`},
+		{Checker{URL: "http://localhost", Protocol: ProtocolHTTP2}, "protocol: http2 requires an https endpoint_url, use h2c for http"},
+		{Checker{URL: "https://localhost", Protocol: ProtocolH2C, Proxy: "http://proxy"}, "protocol: h2c requires an http endpoint_url, use http2 for https; protocol: h2c cannot be combined with proxy"},
+	} {
+		hc := test.hc
+		hc.Name = "Test"
+
+		err := hc.Validate()
+		if err == nil {
+			t.Errorf("Test %d: Expected an error", i)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operators supported by a JSONAssertion.
+var jsonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// JSONAssertion is a check on a value of a JSON document.
+// It is written as a path, optionally piped to length,
+// an operator and a JSON value, e.g.:
+//
+//	$.db.status == "UP"
+//	$.queue.depth < 1000
+//	$.items | length > 0
+//	$.nodes[0]["last seen"] != null
+//
+// == and != compare any values, the other operators compare
+// numbers only.
+type JSONAssertion struct {
+	// Path is the path of the value, e.g. $.db.status.
+	Path string
+
+	// Length compares the length of the array, object or
+	// string at Path instead of its value.
+	Length bool
+
+	// Operator is one of ==, !=, <, <=, > and >=.
+	Operator string
+
+	// Value is the JSON value to compare with.
+	Value interface{}
+
+	path []interface{}
+}
+
+// ParseJSONAssertion parses an assertion like `$.db.status == "UP"`.
+func ParseJSONAssertion(expr string) (JSONAssertion, error) {
+	var a JSONAssertion
+
+	trimmed := strings.TrimSpace(expr)
+	path, rest, err := parseJSONPath(trimmed)
+	if err != nil {
+		return a, fmt.Errorf("invalid assertion %q: %v", expr, err)
+	}
+	a.path = path
+	a.Path = trimmed[:len(trimmed)-len(rest)]
+
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "|") {
+		rest = strings.TrimSpace(rest[1:])
+		if !strings.HasPrefix(rest, "length") {
+			return a, fmt.Errorf("invalid assertion %q: only length can follow |", expr)
+		}
+		a.Length = true
+		rest = strings.TrimSpace(rest[len("length"):])
+	}
+
+	for _, op := range jsonOperators {
+		if strings.HasPrefix(rest, op) {
+			a.Operator = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if a.Operator == "" {
+		return a, fmt.Errorf("invalid assertion %q: expected one of %s after the path", expr, strings.Join(jsonOperators, " "))
+	}
+
+	if err := json.Unmarshal([]byte(rest), &a.Value); err != nil {
+		return a, fmt.Errorf("invalid assertion %q: value is not JSON: %v", expr, err)
+	}
+	if err := a.Validate(); err != nil {
+		return a, fmt.Errorf("invalid assertion %q: %v", expr, err)
+	}
+
+	return a, nil
+}
+
+// Validate checks the path, operator and value of a, which may
+// have been built as a literal. Numbers in Value of any Go type
+// are converted to float64, as encoding/json decodes them.
+func (a *JSONAssertion) Validate() error {
+	if a.path == nil {
+		path, rest, err := parseJSONPath(strings.TrimSpace(a.Path))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return fmt.Errorf("unexpected %q after path", rest)
+		}
+		a.path = path
+	}
+	if !containsString(jsonOperators, a.Operator) {
+		return fmt.Errorf("unknown operator %q, expected one of %s", a.Operator, strings.Join(jsonOperators, " "))
+	}
+
+	a.Value = jsonNumbers(a.Value)
+	if _, ok := a.Value.(float64); !ok && a.Operator != "==" && a.Operator != "!=" {
+		return fmt.Errorf("%s needs a number", a.Operator)
+	}
+	if _, ok := a.Value.(float64); !ok && a.Length {
+		return fmt.Errorf("length is compared with a number")
+	}
+	return nil
+}
+
+// jsonNumbers returns v with its numbers converted to float64.
+func jsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i := range v {
+			converted[i] = jsonNumbers(v[i])
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key := range v {
+			converted[key] = jsonNumbers(v[key])
+		}
+		return converted
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	return v
+}
+
+// parseJSONPath parses the path at the start of s, returning its
+// elements, string keys or int indices, and the rest of s.
+func parseJSONPath(s string) ([]interface{}, string, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, s, fmt.Errorf("path must start with $")
+	}
+	s = s[1:]
+
+	var path []interface{}
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			end := 1
+			for end < len(s) && isKeyChar(s[end]) {
+				end++
+			}
+			if end == 1 {
+				return nil, s, fmt.Errorf("missing key after '.'")
+			}
+			path = append(path, s[1:end])
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if strings.HasPrefix(s, `["`) {
+				// Quoted keys may contain ']'
+				key, err := strconv.QuotedPrefix(s[1:])
+				if err != nil {
+					return nil, s, fmt.Errorf("invalid quoted key: %v", err)
+				}
+				end = 1 + len(key)
+				if end >= len(s) || s[end] != ']' {
+					return nil, s, fmt.Errorf("missing ']'")
+				}
+				unquoted, _ := strconv.Unquote(key)
+				path = append(path, unquoted)
+			} else {
+				if end < 0 {
+					return nil, s, fmt.Errorf("missing ']'")
+				}
+				index, err := strconv.Atoi(strings.TrimSpace(s[1:end]))
+				if err != nil {
+					return nil, s, fmt.Errorf("invalid index %q", s[1:end])
+				}
+				path = append(path, index)
+			}
+			s = s[end+1:]
+		default:
+			return path, s, nil
+		}
+	}
+	return path, s, nil
+}
+
+func isKeyChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// UnmarshalJSON parses a from a JSON string.
+func (a *JSONAssertion) UnmarshalJSON(b []byte) error {
+	var expr string
+	if err := json.Unmarshal(b, &expr); err != nil {
+		return err
+	}
+	parsed, err := ParseJSONAssertion(expr)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalJSON renders a as a JSON string.
+func (a JSONAssertion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// String returns a as written in the configuration.
+func (a JSONAssertion) String() string {
+	s := a.Path
+	if a.Length {
+		s += " | length"
+	}
+	value, _ := json.Marshal(a.Value)
+	return s + " " + a.Operator + " " + string(value)
+}
+
+// LookupJSONPath returns the value at path in doc, a document
+// decoded by encoding/json into an interface{}.
+func LookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	elems, rest, err := parseJSONPath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("unexpected %q after path", rest)
+	}
+	return lookup(doc, elems)
+}
+
+// ErrNotFound is returned by LookupJSONPath if the path is
+// not in the document.
+var ErrNotFound = errors.New("not found")
+
+func lookup(doc interface{}, path []interface{}) (interface{}, error) {
+	value := doc
+	for _, elem := range path {
+		switch elem := elem.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, ErrNotFound
+			}
+			if value, ok = object[elem]; !ok {
+				return nil, ErrNotFound
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok {
+				return nil, ErrNotFound
+			}
+			if elem < 0 {
+				elem += len(array)
+			}
+			if elem < 0 || elem >= len(array) {
+				return nil, ErrNotFound
+			}
+			value = array[elem]
+		}
+	}
+	return value, nil
+}
+
+// Check evaluates a against doc, a document decoded by
+// encoding/json into an interface{}. It returns an error
+// naming the path, expected and actual value if it fails.
+func (a JSONAssertion) Check(doc interface{}) error {
+	name := a.Path
+	if a.Length {
+		name += " | length"
+	}
+
+	// a may have been built as a literal, validating the copy
+	// converts its Value without changing the caller's
+	if err := a.Validate(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	actual, err := lookup(doc, a.path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	if a.Length {
+		switch v := actual.(type) {
+		case []interface{}:
+			actual = float64(len(v))
+		case map[string]interface{}:
+			actual = float64(len(v))
+		case string:
+			actual = float64(len([]rune(v)))
+		default:
+			return fmt.Errorf("%s: %s has no length", name, render(actual))
+		}
+	}
+
+	var ok bool
+	switch a.Operator {
+	case "==":
+		ok = reflect.DeepEqual(actual, a.Value)
+	case "!=":
+		ok = !reflect.DeepEqual(actual, a.Value)
+	default:
+		number, isNumber := actual.(float64)
+		if !isNumber {
+			return fmt.Errorf("%s: expected a number %s %s, got %s", name, a.Operator, render(a.Value), render(actual))
+		}
+		expected := a.Value.(float64)
+		switch a.Operator {
+		case "<":
+			ok = number < expected
+		case "<=":
+			ok = number <= expected
+		case ">":
+			ok = number > expected
+		case ">=":
+			ok = number >= expected
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%s: expected %s %s, got %s", name, a.Operator, render(a.Value), render(actual))
+	}
+	return nil
+}
+
+// render returns v as JSON for error messages.
+func render(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
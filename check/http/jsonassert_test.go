@@ -0,0 +1,126 @@
+package http
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONAssertion(t *testing.T) {
+	var doc interface{}
+	err := json.Unmarshal([]byte(`{
+		"status": "UP",
+		"db": {"status": "DOWN", "pool": {"active": 3}},
+		"queue": {"depth": 1200},
+		"items": [{"id": 1}, {"id": 2}],
+		"empty": [],
+		"tags": {"last seen": "now"},
+		"ok": true,
+		"missing": null
+	}`), &doc)
+	if err != nil {
+		t.Fatalf("Cannot parse document: %v", err)
+	}
+
+	for i, test := range []struct {
+		expr string
+		err  string
+	}{
+		{`$.status == "UP"`, ""},
+		{`$.db.status == "UP"`, `$.db.status: expected == "UP", got "DOWN"`},
+		{`$.db.pool.active >= 3`, ""},
+		{`$.queue.depth < 1000`, `$.queue.depth: expected < 1000, got 1200`},
+		{`$.items | length > 0`, ""},
+		{`$.empty|length > 0`, `$.empty | length: expected > 0, got 0`},
+		{`$.items[1].id == 2`, ""},
+		{`$.items[-1].id != 2`, `$.items[-1].id: expected != 2, got 2`},
+		{`$["tags"]["last seen"] == "now"`, ""},
+		{`$.ok == true`, ""},
+		{`$.missing == null`, ""},
+		{`$.db == {"status": "DOWN", "pool": {"active": 3}}`, ""},
+		{`$.nothing == 1`, `$.nothing: not found`},
+		{`$.items[5].id == 1`, `$.items[5].id: not found`},
+		{`$.status > 1`, `$.status: expected a number > 1, got "UP"`},
+		{`$.ok | length == 1`, `$.ok | length: true has no length`},
+	} {
+		assertion, err := ParseJSONAssertion(test.expr)
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error parsing %s: %v", i, test.expr, err)
+			continue
+		}
+		err = assertion.Check(doc)
+		if test.err == "" && err != nil {
+			t.Errorf("Test %d: Expected %s to pass, got %v", i, test.expr, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Test %d: Expected error '%s', got %v", i, test.err, err)
+		}
+	}
+
+	for i, expr := range []string{
+		`status == "UP"`,
+		`$.status`,
+		`$.status = "UP"`,
+		`$.status == UP`,
+		`$.status < "UP"`,
+		`$.items | count > 0`,
+		`$.items | length == "1"`,
+		`$.items[x] == 1`,
+		`$. == 1`,
+	} {
+		if _, err := ParseJSONAssertion(expr); err == nil {
+			t.Errorf("Test %d: Expected an error parsing %s", i, expr)
+		}
+	}
+}
+
+func TestJSONAssertionLiteral(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"queue": {"depth": 12}, "ids": [1, 2]}`), &doc); err != nil {
+		t.Fatalf("Cannot parse document: %v", err)
+	}
+
+	for i, test := range []struct {
+		assertion JSONAssertion
+		err       string
+	}{
+		{JSONAssertion{Path: "$.queue.depth", Operator: "==", Value: 12}, ""},
+		{JSONAssertion{Path: "$.queue.depth", Operator: "<", Value: int64(10)}, "$.queue.depth: expected < 10, got 12"},
+		{JSONAssertion{Path: "$.queue.depth", Operator: "<=", Value: uint8(12)}, ""},
+		{JSONAssertion{Path: "$.ids", Operator: "==", Value: []interface{}{1, json.Number("2")}}, ""},
+		{JSONAssertion{Path: "$.ids", Length: true, Operator: ">", Value: float32(1)}, ""},
+		{JSONAssertion{Path: "$.queue.depth", Operator: ">", Value: "10"}, "$.queue.depth: > needs a number"},
+		{JSONAssertion{Path: "$.queue.depth", Operator: "=", Value: 12}, `$.queue.depth: unknown operator "=", expected one of == != <= >= < >`},
+	} {
+		err := test.assertion.Check(doc)
+		if test.err == "" && err != nil {
+			t.Errorf("Test %d: Expected %s to pass, got %v", i, test.assertion, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Test %d: Expected error '%s', got %v", i, test.err, err)
+		}
+	}
+}
+
+func TestJSONAssertionJSON(t *testing.T) {
+	var assertions []JSONAssertion
+	err := json.Unmarshal([]byte(`["$.items | length >= 2", "$.db.status == \"UP\""]`), &assertions)
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	b, err := json.Marshal(assertions)
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	var exprs []string
+	if err := json.Unmarshal(b, &exprs); err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	if got, want := strings.Join(exprs, ", "), `$.items | length >= 2, $.db.status == "UP"`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if err := json.Unmarshal([]byte(`["$.db.status"]`), &assertions); err == nil {
+		t.Errorf("Expected an error for an assertion without operator")
+	}
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultUpStatus is the set of status codes of a healthy
+// endpoint when no UpStatus is configured.
+var DefaultUpStatus = StatusSet{{200, 204}}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min, Max int
+}
+
+// StatusSet is a set of HTTP status codes. It is configured
+// as a code, a class like "2xx", a range like "200-204" or
+// a list of those, e.g. ["2xx", 301, 404].
+type StatusSet []StatusRange
+
+// Contains returns whether code is in s.
+func (s StatusSet) Contains(code int) bool {
+	for _, r := range s {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns s in its configuration format.
+func (s StatusSet) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// String returns r as a code, a class or a range.
+func (r StatusRange) String() string {
+	switch {
+	case r.Min == r.Max:
+		return strconv.Itoa(r.Min)
+	case r.Min%100 == 0 && r.Max == r.Min+99:
+		return fmt.Sprintf("%dxx", r.Min/100)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// UnmarshalJSON parses s from a code, a string or a list of them.
+func (s *StatusSet) UnmarshalJSON(b []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(b, &list); err != nil {
+		list = []json.RawMessage{b}
+	}
+
+	set := make(StatusSet, 0, len(list))
+	for _, raw := range list {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		var (
+			r   StatusRange
+			err error
+		)
+		switch v := value.(type) {
+		case float64:
+			r = StatusRange{int(v), int(v)}
+			if float64(r.Min) != v {
+				err = fmt.Errorf("invalid status code %v", v)
+			}
+		case string:
+			r, err = parseStatusRange(v)
+		default:
+			err = fmt.Errorf("invalid status %s, expected a code or a string like \"2xx\" or \"200-299\"", raw)
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.validate(); err != nil {
+			return err
+		}
+		set = append(set, r)
+	}
+	*s = set
+	return nil
+}
+
+// MarshalJSON renders s as a list of codes and strings.
+func (s StatusSet) MarshalJSON() ([]byte, error) {
+	values := make([]interface{}, len(s))
+	for i, r := range s {
+		if r.Min == r.Max {
+			values[i] = r.Min
+		} else {
+			values[i] = r.String()
+		}
+	}
+	return json.Marshal(values)
+}
+
+// parseStatusRange parses a code, a class or a range.
+func parseStatusRange(s string) (StatusRange, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		class, err := strconv.Atoi(s[:1])
+		if err != nil {
+			return StatusRange{}, fmt.Errorf("invalid status class %q", s)
+		}
+		return StatusRange{class * 100, class*100 + 99}, nil
+	}
+	if i := strings.IndexByte(s, '-'); i > 0 {
+		min, err1 := strconv.Atoi(strings.TrimSpace(s[:i]))
+		max, err2 := strconv.Atoi(strings.TrimSpace(s[i+1:]))
+		if err1 != nil || err2 != nil {
+			return StatusRange{}, fmt.Errorf("invalid status range %q", s)
+		}
+		return StatusRange{min, max}, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status %q", s)
+	}
+	return StatusRange{code, code}, nil
+}
+
+func (r StatusRange) validate() error {
+	if r.Min < 100 || r.Max > 599 {
+		return fmt.Errorf("%s is not an HTTP status code", r)
+	}
+	if r.Min > r.Max {
+		return fmt.Errorf("invalid status range %s", r)
+	}
+	return nil
+}
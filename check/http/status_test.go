@@ -0,0 +1,43 @@
+package http
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStatusSet(t *testing.T) {
+	var set StatusSet
+	if err := json.Unmarshal([]byte(`["2xx", 301, "404", "500-503"]`), &set); err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	if got, want := set.String(), "2xx, 301, 404, 500-503"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	for code, want := range map[int]bool{200: true, 299: true, 300: false, 301: true, 404: true, 403: false, 502: true, 504: false} {
+		if got := set.Contains(code); got != want {
+			t.Errorf("Expected Contains(%d)=%v, got %v", code, want, got)
+		}
+	}
+
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	if got, want := string(b), `["2xx",301,404,"500-503"]`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// A single code as before
+	if err := json.Unmarshal([]byte(`201`), &set); err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	if got, want := set.String(), "201"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	for _, config := range []string{`"abc"`, `99`, `"6xx"`, `"300-200"`, `[true]`, `200.5`} {
+		if err := json.Unmarshal([]byte(config), &set); err == nil {
+			t.Errorf("Expected an error for %s", config)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+// Phases are the names of the phases of types.Timings, used
+// as PhaseThresholds keys and metric labels.
+var Phases = []string{"dns", "connect", "tls", "first_byte", "transfer"}
+
+// phaseDuration returns the duration of the phase name in t.
+func phaseDuration(t *types.Timings, name string) time.Duration {
+	switch name {
+	case "dns":
+		return t.DNS
+	case "connect":
+		return t.Connect
+	case "tls":
+		return t.TLS
+	case "first_byte":
+		return t.FirstByte
+	case "transfer":
+		return t.Transfer
+	}
+	return 0
+}
+
+// medianPhases returns the median duration of every phase
+// over the attempts with timings, nil if there are none.
+func medianPhases(attempts types.Attempts) map[string]time.Duration {
+	var timings []*types.Timings
+	for _, attempt := range attempts {
+		if attempt.Timings != nil {
+			timings = append(timings, attempt.Timings)
+		}
+	}
+	if len(timings) == 0 {
+		return nil
+	}
+
+	medians := make(map[string]time.Duration, len(Phases))
+	for _, name := range Phases {
+		durations := make([]time.Duration, len(timings))
+		for i, t := range timings {
+			durations[i] = phaseDuration(t, name)
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		half := len(durations) / 2
+		if len(durations)%2 == 0 {
+			medians[name] = (durations[half-1] + durations[half]) / 2
+		} else {
+			medians[name] = durations[half]
+		}
+	}
+	return medians
+}
+
+// tracer measures the phases of requests with httptrace. The
+// phases of redirected requests add up.
+type tracer struct {
+	mu      sync.Mutex
+	timings types.Timings
+
+	dnsStart, connectStart, tlsStart time.Time
+	wroteRequest, firstByte          time.Time
+}
+
+// clientTrace returns the hooks recording into t. They may
+// be called concurrently, e.g. while dialing several addresses.
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	record := func(f func(now time.Time)) {
+		now := time.Now()
+		t.mu.Lock()
+		f(now)
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func(now time.Time) { t.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func(now time.Time) { t.timings.DNS += now.Sub(t.dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			record(func(now time.Time) {
+				if t.connectStart.IsZero() {
+					t.connectStart = now
+				}
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				return
+			}
+			record(func(now time.Time) {
+				t.timings.Connect += now.Sub(t.connectStart)
+				t.connectStart = time.Time{}
+			})
+		},
+		TLSHandshakeStart: func() {
+			record(func(now time.Time) { t.tlsStart = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func(now time.Time) { t.timings.TLS += now.Sub(t.tlsStart) })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			record(func(now time.Time) { t.wroteRequest = now })
+		},
+		GotFirstResponseByte: func() {
+			record(func(now time.Time) {
+				t.firstByte = now
+				t.timings.FirstByte += now.Sub(t.wroteRequest)
+			})
+		},
+	}
+}
+
+// done records that the final response was read and
+// returns the timings.
+func (t *tracer) done() *types.Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.firstByte.IsZero() {
+		t.timings.Transfer = time.Since(t.firstByte)
+	}
+	timings := t.timings
+	return &timings
+}
@@ -0,0 +1,594 @@
+package httpflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/feifeigood/checkup"
+	checkhttp "github.com/feifeigood/checkup/check/http"
+	"github.com/feifeigood/checkup/types"
+)
+
+// Type is the name the checker is registered under
+const Type = "http_flow"
+
+// DefaultTimeout is the maximum time all steps of an attempt
+// may take when no Timeout is configured.
+const DefaultTimeout = 30 * time.Second
+
+// Checker implements a Checker running a sequence of HTTP
+// requests, e.g. logging in and fetching a page that needs
+// the session. Every attempt runs all steps in order with
+// a new cookie jar and stops at the first failing step.
+type Checker struct {
+	// Name is the name of the endpoint.
+	Name string `json:"endpoint_name"`
+
+	// URL is the URL of the endpoint. Relative step
+	// URLs are resolved against it.
+	URL string `json:"endpoint_url,omitempty"`
+
+	// Variables are the initial variables of the
+	// templates of the steps.
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Headers are added to the requests of all steps.
+	Headers http.Header `json:"headers,omitempty"`
+
+	// Steps are the requests made in order.
+	Steps []Step `json:"steps"`
+
+	// Every override every subcommand interval If set.
+	Every types.Duration `json:"every,omitempty"`
+
+	// Timeout is the maximum time to wait for all steps
+	// of a single attempt. Default is DefaultTimeout.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
+	// ThresholdRTT is the maximum time all steps of an
+	// attempt may take for a healthy endpoint. If non-zero
+	// and the median exceeds it, the endpoint will be
+	// considered degraded.
+	ThresholdRTT types.Duration `json:"threshold_rtt,omitempty"`
+
+	// Attempts is how many times the steps are run
+	// in a single check.
+	Attempts int `json:"attempts,omitempty"`
+
+	// AttemptSpacing spaces out each attempt in a check
+	// by this duration. By default, no waiting occurs
+	// between attempts.
+	AttemptSpacing types.Duration `json:"attempt_spacing,omitempty"`
+
+	// MaxBodyBytes is how many bytes of each response
+	// body are read, decoded. A step checking or capturing
+	// from a longer body fails. Default is DefaultMaxBodyBytes
+	// of the http checker.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+
+	// Client is the http.Client whose transport makes the
+	// requests. If not set, that of DefaultHTTPClient of
+	// the http checker is used. Redirects are not followed.
+	Client *http.Client `json:"-"`
+}
+
+// Step is a request of a Checker. Its URL, headers and body are
+// text/template templates executed with the variables, e.g.
+// {{.cart_id}}.
+type Step struct {
+	// Name identifies the step in results.
+	// Default is the method and URL.
+	Name string `json:"name,omitempty"`
+
+	// Method is the HTTP method of the request.
+	// Default is GET.
+	Method string `json:"method,omitempty"`
+
+	// URL is the URL of the request, absolute
+	// or relative to the endpoint URL.
+	URL string `json:"url"`
+
+	// Headers are added to the request.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is sent as the request body.
+	Body string `json:"body,omitempty"`
+
+	// UpStatus is the set of HTTP status codes of a
+	// successful step. Default is DefaultUpStatus of
+	// the http checker.
+	UpStatus checkhttp.StatusSet `json:"up_status,omitempty"`
+
+	// MustContain is a string the response body must
+	// contain for the step to succeed.
+	MustContain string `json:"must_contain,omitempty"`
+
+	// JSONAssertions are checked against the response
+	// body, which must be JSON.
+	JSONAssertions []checkhttp.JSONAssertion `json:"json_assertions,omitempty"`
+
+	// Capture sets variables from the response
+	// for the following steps.
+	Capture []Capture `json:"capture,omitempty"`
+}
+
+// Capture sets the variable Name from a response, taking the
+// value at JSONPath in the body, of Header, or matched by Regex
+// in the body, its first group if it has one.
+type Capture struct {
+	Name     string `json:"name"`
+	JSONPath string `json:"json_path,omitempty"`
+	Header   string `json:"header,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+}
+
+// compiledStep is a Step with its templates and
+// regular expressions compiled.
+type compiledStep struct {
+	*Step
+	url, body *template.Template
+	headers   map[string]*template.Template
+	captures  []*regexp.Regexp
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
+// New creates a new Checker instance based on json config
+func New(config json.RawMessage) (*Checker, error) {
+	var checker Checker
+	err := json.Unmarshal(config, &checker)
+	return &checker, err
+}
+
+// Type returns the checker type
+func (c *Checker) Type() string {
+	return Type
+}
+
+// GetEvery returns the checker specified check interval to override every subcommand
+func (c *Checker) GetEvery() time.Duration {
+	return c.Every.Duration
+}
+
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil {
+			errs = append(errs, types.NewValidationError("endpoint_url", "%v", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, types.NewValidationError("endpoint_url", "scheme must be http or https"))
+		}
+	}
+	if len(c.Steps) == 0 {
+		errs = append(errs, types.NewValidationError("steps", "no steps configured"))
+	}
+	for i := range c.Steps {
+		errs = append(errs, types.PrefixPath(fmt.Sprintf("steps[%d]", i), c.Steps[i].validate(c.URL == ""))...)
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	if c.MaxBodyBytes < 0 {
+		errs = append(errs, types.NewValidationError("max_body_bytes", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":           c.Every.Duration,
+		"timeout":         c.Timeout.Duration,
+		"threshold_rtt":   c.ThresholdRTT.Duration,
+		"attempt_spacing": c.AttemptSpacing.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
+// validate returns the problems of s, whose URL must be
+// absolute if absolute is set.
+func (s *Step) validate(absolute bool) error {
+	var errs types.Errors
+	if s.URL == "" {
+		errs = append(errs, types.NewValidationError("url", "must not be empty"))
+	} else if absolute && !strings.Contains(s.URL, "://") {
+		errs = append(errs, types.NewValidationError("url", "must be absolute without endpoint_url"))
+	}
+	if strings.ContainsAny(s.Method, " \t\r\n") {
+		errs = append(errs, types.NewValidationError("method", "invalid method %q", s.Method))
+	}
+	if _, err := s.compile(); err != nil {
+		errs = append(errs, types.PrefixPath("", err)...)
+	}
+	for i := range s.JSONAssertions {
+		if err := s.JSONAssertions[i].Validate(); err != nil {
+			errs = append(errs, types.NewValidationError(fmt.Sprintf("json_assertions[%d]", i), "%v", err))
+		}
+	}
+	for i, capture := range s.Capture {
+		path := fmt.Sprintf("capture[%d]", i)
+		if capture.Name == "" {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, "name"), "must not be empty"))
+		}
+		sources := 0
+		for _, source := range []string{capture.JSONPath, capture.Header, capture.Regex} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			errs = append(errs, types.NewValidationError(path, "exactly one of json_path, header and regex must be set"))
+		}
+	}
+	return errs.Err()
+}
+
+// compile compiles the templates and regular expressions of s.
+// Errors are ValidationErrors relative to s.
+func (s *Step) compile() (*compiledStep, error) {
+	var errs types.Errors
+	parse := func(field, text string) *template.Template {
+		t, err := template.New(field).Option("missingkey=error").Parse(text)
+		if err != nil {
+			errs = append(errs, types.NewValidationError(field, "%v", err))
+		}
+		return t
+	}
+
+	compiled := &compiledStep{Step: s, headers: make(map[string]*template.Template)}
+	compiled.url = parse("url", s.URL)
+	compiled.body = parse("body", s.Body)
+	for key, value := range s.Headers {
+		compiled.headers[key] = parse(types.JoinPath("headers", key), value)
+	}
+
+	compiled.captures = make([]*regexp.Regexp, len(s.Capture))
+	for i, capture := range s.Capture {
+		if capture.JSONPath != "" {
+			// Looking up in no document only fails if the path is invalid
+			// or, for paths other than $, not found
+			if _, err := checkhttp.LookupJSONPath(nil, capture.JSONPath); err != nil && !errors.Is(err, checkhttp.ErrNotFound) {
+				errs = append(errs, types.NewValidationError(fmt.Sprintf("capture[%d].json_path", i), "%v", err))
+			}
+		}
+		if capture.Regex == "" {
+			continue
+		}
+		re, err := regexp.Compile(capture.Regex)
+		if err != nil {
+			errs = append(errs, types.NewValidationError(fmt.Sprintf("capture[%d].regex", i), "%v", err))
+		}
+		compiled.captures[i] = re
+	}
+	return compiled, errs.Err()
+}
+
+// Check performs checks using c according to its configuration.
+// An error is only returned if there is a configuration error.
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
+	if c.Attempts < 1 {
+		c.Attempts = 1
+	}
+	if c.Client == nil {
+		c.Client = checkhttp.DefaultHTTPClient
+	}
+
+	result := types.NewResult()
+	result.Type = c.Type()
+	result.Title = c.Name
+	result.Endpoint = c.URL
+	if result.Endpoint == "" && len(c.Steps) > 0 {
+		result.Endpoint = c.Steps[0].URL
+	}
+
+	var base *url.URL
+	if c.URL != "" {
+		var err error
+		if base, err = url.Parse(c.URL); err != nil {
+			return result, err
+		}
+	}
+	steps := make([]*compiledStep, len(c.Steps))
+	for i := range c.Steps {
+		var err error
+		if steps[i], err = c.Steps[i].compile(); err != nil {
+			return result, types.PrefixPath(fmt.Sprintf("steps[%d]", i), err)
+		}
+	}
+
+	result.Times = c.doChecks(ctx, base, steps)
+
+	return c.conclude(result), nil
+}
+
+// doChecks runs steps Attempts times and returns each attempt.
+func (c *Checker) doChecks(ctx context.Context, base *url.URL, steps []*compiledStep) types.Attempts {
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	checks := make(types.Attempts, c.Attempts)
+	for i := 0; i < c.Attempts; i++ {
+		checks[i] = c.doCheck(ctx, base, steps, timeout)
+		if c.AttemptSpacing.Duration > 0 {
+			select {
+			case <-time.After(c.AttemptSpacing.Duration):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return checks
+}
+
+// doCheck runs steps in order bounded by timeout, recording
+// each as a step of the attempt, until one fails.
+func (c *Checker) doCheck(ctx context.Context, base *url.URL, steps []*compiledStep, timeout time.Duration) types.Attempt {
+	var attempt types.Attempt
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Transport: c.Client.Transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Jar: jar,
+	}
+	vars := make(map[string]string, len(c.Variables))
+	for key, value := range c.Variables {
+		vars[key] = value
+	}
+
+	start := time.Now()
+	for i, step := range steps {
+		s, err := c.doStep(ctx, client, base, step, vars)
+		attempt.Steps = append(attempt.Steps, s)
+		if err != nil {
+			attempt.Error = fmt.Sprintf("step %d (%s): %v", i+1, s.Name, err)
+			break
+		}
+	}
+	attempt.RTT = time.Since(start)
+	return attempt
+}
+
+// doStep makes the request of step with vars using client and
+// checks its response, adding the captured variables to vars.
+func (c *Checker) doStep(ctx context.Context, client *http.Client, base *url.URL, step *compiledStep, vars map[string]string) (types.Step, error) {
+	s := types.Step{Name: step.Name}
+	fail := func(err error) (types.Step, error) {
+		s.Error = err.Error()
+		return s, err
+	}
+
+	req, err := step.request(base, vars)
+	if err != nil {
+		return fail(err)
+	}
+	if s.Name == "" {
+		s.Name = req.Method + " " + req.URL.String()
+	}
+	for key, header := range c.Headers {
+		if req.Header.Get(key) == "" {
+			req.Header.Set(key, strings.Join(header, ", "))
+		}
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", fmt.Sprintf("checkup/%s", "0.0.1"))
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	s.RTT = time.Since(start)
+	if err != nil {
+		return fail(err)
+	}
+	defer resp.Body.Close()
+	s.Code = resp.StatusCode
+
+	limit := c.MaxBodyBytes
+	if limit <= 0 {
+		limit = checkhttp.DefaultMaxBodyBytes
+	}
+	body, truncated, err := checkhttp.ReadBody(resp, limit)
+	s.RTT = time.Since(start)
+	if err != nil {
+		return fail(fmt.Errorf("reading response body: %w", err))
+	}
+	if truncated && step.readsBody() {
+		return fail(fmt.Errorf("response body is more than %d bytes", limit))
+	}
+	if err := step.checkDown(resp, body); err != nil {
+		return fail(err)
+	}
+	if err := step.capture(resp, body, vars); err != nil {
+		return fail(err)
+	}
+	return s, nil
+}
+
+// request builds the request of s with vars, resolving its URL
+// against base.
+func (s *compiledStep) request(base *url.URL, vars map[string]string) (*http.Request, error) {
+	execute := func(t *template.Template) (string, error) {
+		var b strings.Builder
+		if err := t.Execute(&b, vars); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+
+	rawURL, err := execute(s.url)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	body, err := execute(s.body)
+	if err != nil {
+		return nil, err
+	}
+
+	method := s.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, t := range s.headers {
+		value, err := execute(t)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(key, value)
+		if strings.EqualFold(key, "host") {
+			req.Host = value
+		}
+	}
+	return req, nil
+}
+
+// readsBody returns whether s checks or captures from
+// the response body.
+func (s *compiledStep) readsBody() bool {
+	if s.MustContain != "" || len(s.JSONAssertions) > 0 {
+		return true
+	}
+	for _, capture := range s.Capture {
+		if capture.JSONPath != "" || capture.Regex != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDown checks whether the step failed based on resp and
+// body. It returns a non-nil error if it did.
+func (s *compiledStep) checkDown(resp *http.Response, body []byte) error {
+	upStatus := s.UpStatus
+	if len(upStatus) == 0 {
+		upStatus = checkhttp.DefaultUpStatus
+	}
+	if !upStatus.Contains(resp.StatusCode) {
+		return fmt.Errorf("response status %s", resp.Status)
+	}
+	if s.MustContain != "" && !bytes.Contains(body, []byte(s.MustContain)) {
+		return fmt.Errorf("response does not contain '%s'", s.MustContain)
+	}
+	if len(s.JSONAssertions) == 0 {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("response is not JSON: %v", err)
+	}
+	for _, assertion := range s.JSONAssertions {
+		if err := assertion.Check(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// capture sets the variables captured from resp and body in vars.
+func (s *compiledStep) capture(resp *http.Response, body []byte, vars map[string]string) error {
+	var doc interface{}
+	for i, capture := range s.Capture {
+		switch {
+		case capture.JSONPath != "":
+			if doc == nil {
+				if err := json.Unmarshal(body, &doc); err != nil {
+					return fmt.Errorf("capture %s: response is not JSON: %v", capture.Name, err)
+				}
+			}
+			value, err := checkhttp.LookupJSONPath(doc, capture.JSONPath)
+			if err != nil {
+				return fmt.Errorf("capture %s: %s %v", capture.Name, capture.JSONPath, err)
+			}
+			if str, ok := value.(string); ok {
+				vars[capture.Name] = str
+			} else {
+				b, _ := json.Marshal(value)
+				vars[capture.Name] = string(b)
+			}
+		case capture.Header != "":
+			value := resp.Header.Get(capture.Header)
+			if value == "" {
+				return fmt.Errorf("capture %s: response header %s is missing", capture.Name, capture.Header)
+			}
+			vars[capture.Name] = value
+		case capture.Regex != "":
+			match := s.captures[i].FindSubmatch(body)
+			if match == nil {
+				return fmt.Errorf("capture %s: response does not match '%s'", capture.Name, capture.Regex)
+			}
+			if len(match) > 1 {
+				vars[capture.Name] = string(match[1])
+			} else {
+				vars[capture.Name] = string(match[0])
+			}
+		}
+	}
+	return nil
+}
+
+// conclude takes the data in result from the attempts and
+// computes remaining values needed to fill out the result.
+// It detects degraded (high-latency) responses and makes
+// the conclusion about the result's status.
+func (c *Checker) conclude(result types.Result) types.Result {
+	result.ThresholdRTT = c.ThresholdRTT.Duration
+
+	// Check errors (down)
+	for i := range result.Times {
+		if result.Times[i].Error != "" {
+			result.Down = true
+			return result
+		}
+	}
+
+	// Check round trip time (degraded)
+	if c.ThresholdRTT.Duration > 0 {
+		stats := result.ComputeStats()
+		if stats.Median > c.ThresholdRTT.Duration {
+			result.Notice = fmt.Sprintf("median round trip time exceeded threshold (%s)", c.ThresholdRTT)
+			result.Degraded = true
+			return result
+		}
+	}
+
+	result.Healthy = true
+	return result
+}
@@ -0,0 +1,207 @@
+package httpflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newShop serves a login, carts and logout, requiring the
+// session cookie and token of the login for the carts.
+func newShop() *httptest.Server {
+	mux := http.NewServeMux()
+	loggedIn := func(r *http.Request) bool {
+		cookie, err := r.Cookie("session")
+		return err == nil && cookie.Value == "s1" && r.Header.Get("Authorization") == "Bearer t1"
+	}
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("user") != "checkup" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		fmt.Fprint(w, `{"token": "t1"}`)
+	})
+	mux.HandleFunc("/carts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !loggedIn(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Location", "/carts/42")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": 42, "created": "cart-42"}`)
+	})
+	mux.HandleFunc("/carts/42", func(w http.ResponseWriter, r *http.Request) {
+		if !loggedIn(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"id": 42, "items": []}`)
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return httptest.NewServer(mux)
+}
+
+const shopFlow = `{
+	"endpoint_name": "Shop",
+	"variables": {"user": "checkup"},
+	"steps": [
+		{
+			"name": "log in",
+			"method": "POST",
+			"url": "/login",
+			"headers": {"Content-Type": "application/x-www-form-urlencoded"},
+			"body": "user={{.user}}",
+			"capture": [{"name": "token", "json_path": "$.token"}]
+		},
+		{
+			"name": "create cart",
+			"method": "POST",
+			"url": "/carts",
+			"headers": {"Authorization": "Bearer {{.token}}"},
+			"up_status": 201,
+			"capture": [
+				{"name": "cart_url", "header": "Location"},
+				{"name": "cart_id", "json_path": "$.id"},
+				{"name": "cart_name", "regex": "\"(cart-\\d+)\""}
+			]
+		},
+		{
+			"name": "fetch cart",
+			"url": "{{.cart_url}}",
+			"headers": {"Authorization": "Bearer {{.token}}", "X-Cart": "{{.cart_name}}"},
+			"json_assertions": ["$.id == 42", "$.items | length == 0"]
+		},
+		{"method": "POST", "url": "/logout"}
+	]
+}`
+
+func TestChecker(t *testing.T) {
+	srv := newShop()
+	defer srv.Close()
+
+	hc, err := New(json.RawMessage(shopFlow))
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	hc.URL = srv.URL
+	hc.Attempts = 2
+	if err := hc.Validate(); err != nil {
+		t.Errorf("Didn't expect a validation error: %v", err)
+	}
+
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Fatalf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+	if got, want := result.Type, "http_flow"; got != want {
+		t.Errorf("Expected result.Type=%s, got %s", want, got)
+	}
+	for i, attempt := range result.Times {
+		var steps []string
+		for _, step := range attempt.Steps {
+			steps = append(steps, fmt.Sprintf("%s=%d", step.Name, step.Code))
+			if step.RTT <= 0 {
+				t.Errorf("Attempt %d: Expected step %s to be timed", i, step.Name)
+			}
+		}
+		want := "log in=200,create cart=201,fetch cart=200,POST " + srv.URL + "/logout=204"
+		if got := strings.Join(steps, ","); got != want {
+			t.Errorf("Attempt %d: Expected steps %s, got %s", i, want, got)
+		}
+	}
+
+	// Stops at the failing step
+	hc.Steps[2].JSONAssertions = hc.Steps[2].JSONAssertions[:1]
+	hc.Steps[2].JSONAssertions[0].Value = float64(43)
+	result, err = hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if got, want := result.Times[0].Error, "step 3 (fetch cart): $.id: expected == 43, got 42"; got != want {
+		t.Errorf("Expected error '%s', got '%s'", want, got)
+	}
+	if got, want := len(result.Times[0].Steps), 3; got != want {
+		t.Errorf("Expected %d steps, got %d", want, got)
+	}
+
+	// Variables must be captured before they are used
+	hc.Steps = hc.Steps[1:]
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Times[0].Error, `step 1 (create cart): template: headers.Authorization:1:9: executing "headers.Authorization" at <.token>: map has no entry for key "token"`; got != want {
+		t.Errorf("Expected error '%s', got '%s'", want, got)
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	hc, err := New(json.RawMessage(`{
+		"endpoint_name": "Shop",
+		"steps": [
+			{"url": "/login", "body": "{{.user"},
+			{"url": "http://localhost/", "capture": [{"name": "id"}, {"name": "x", "header": "X", "regex": "("}, {"name": "y", "json_path": "y"}]}
+		],
+		"max_body_bytes": -1
+	}`))
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+
+	want := []string{
+		"steps[0].url: must be absolute without endpoint_url",
+		`steps[0].body: template: body:1: unclosed action`,
+		"steps[1].capture[1].regex: error parsing regexp: missing closing ): `(`",
+		"steps[1].capture[2].json_path: path must start with $",
+		"steps[1].capture[0]: exactly one of json_path, header and regex must be set",
+		"steps[1].capture[1]: exactly one of json_path, header and regex must be set",
+		"max_body_bytes: must not be negative",
+	}
+	if got := strings.Split(hc.Validate().Error(), "; "); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if _, err := hc.Check(context.Background()); err == nil {
+		t.Errorf("Expected an error checking an invalid step")
+	}
+}
+
+func TestCheckerMaxBodyBytes(t *testing.T) {
+	srv := newShop()
+	defer srv.Close()
+
+	hc, err := New(json.RawMessage(`{
+		"endpoint_name": "Shop",
+		"max_body_bytes": 8,
+		"steps": [{"name": "log in", "method": "POST", "url": "/login?user=checkup"}]
+	}`))
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	hc.URL = srv.URL
+
+	// The body is longer but not read by the step
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+
+	hc.Steps[0].Capture = []Capture{{Name: "token", JSONPath: "$.token"}}
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Times[0].Error, "step 1 (log in): response body is more than 8 bytes"; got != want {
+		t.Errorf("Expected error '%s', got '%s'", want, got)
+	}
+}
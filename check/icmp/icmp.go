@@ -1,10 +1,12 @@
 package icmp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/feifeigood/checkup"
 	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
 	"github.com/feifeigood/checkup/prometheus/metric"
 	"github.com/feifeigood/checkup/types"
@@ -68,6 +70,12 @@ type Checker struct {
 	stats   *Statistics
 }
 
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
 // New creates a new Checker instance based on json config
 func New(config json.RawMessage) (*Checker, error) {
 	var checker Checker
@@ -85,9 +93,37 @@ func (c *Checker) GetEvery() time.Duration {
 	return c.Every.Duration
 }
 
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	}
+	if c.Count < 0 {
+		errs = append(errs, types.NewValidationError("count", "must not be negative"))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":         c.Every.Duration,
+		"timeout":       c.Timeout.Duration,
+		"interval":      c.Interval.Duration,
+		"threshold_rtt": c.ThresholdRTT,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
 // Check performs checks using c according to its configuration.
 // An error is only returned if there is a configuration error.
-func (c *Checker) Check() (types.Result, error) {
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
 	if c.Attempts < 1 {
 		c.Attempts = 1
 	}
@@ -108,25 +144,30 @@ func (c *Checker) Check() (types.Result, error) {
 	result.Type = c.Type()
 	result.Title = c.Name
 	result.Endpoint = c.URL
-	result.Times = c.doChecks()
+	result.Times = c.doChecks(ctx)
 
 	return c.conclude(result), nil
 }
 
 // doChecks executes and returns each attempt.
-func (c *Checker) doChecks() types.Attempts {
+func (c *Checker) doChecks(ctx context.Context) types.Attempts {
 	checks := make(types.Attempts, c.Attempts)
 
-	pinger, _ := NewPinger(c.URL)
-	pinger.SetPrivileged(c.Privileged)
-	pinger.Count = c.Count
-	pinger.Timeout = c.Timeout.Duration
-	pinger.Interval = c.Interval.Duration
-
 	for i := 0; i < c.Attempts; i++ {
 		start := time.Now()
 
-		err := pinger.Run()
+		pinger, err := NewPinger(c.URL)
+		if err != nil {
+			checks[i].RTT = time.Since(start)
+			checks[i].Error = err.Error()
+			continue
+		}
+		pinger.SetPrivileged(c.Privileged)
+		pinger.Count = c.Count
+		pinger.Timeout = c.Timeout.Duration
+		pinger.Interval = c.Interval.Duration
+
+		err = pinger.RunContext(ctx)
 
 		checks[i].RTT = time.Since(start)
 		if err != nil {
@@ -160,29 +201,8 @@ func (c *Checker) checkDown(stats *Statistics) error {
 func (c *Checker) conclude(result types.Result) types.Result {
 	result.ThresholdRTT = c.ThresholdRTT
 
-	if c.stats == nil {
-		m, _ := metric.New(
-			"checkup_icmp",
-			map[string]string{
-				"title":    result.Title,
-				"endpoint": result.Endpoint,
-			}, map[string]interface{}{
-				"healthy": 0,
-			}, time.Now(), metric.Gauge,
-		)
-		c.metrics = append(c.metrics, m)
-	} else {
+	if c.stats != nil {
 		m, _ := metric.New(
-			"checkup_icmp",
-			map[string]string{
-				"title":    result.Title,
-				"endpoint": result.Endpoint,
-			}, map[string]interface{}{
-				"healthy": 1,
-			}, time.Now(), metric.Gauge,
-		)
-		c.metrics = append(c.metrics, m)
-		m1, _ := metric.New(
 			"checkup_icmp",
 			map[string]string{
 				"title":    result.Title,
@@ -191,7 +211,7 @@ func (c *Checker) conclude(result types.Result) types.Result {
 				"packet_loss": c.stats.PacketLoss,
 			}, time.Now(), metric.Gauge,
 		)
-		c.metrics = append(c.metrics, m1)
+		c.metrics = append(c.metrics, m)
 	}
 	c.stats = nil
 
@@ -2,6 +2,7 @@ package icmp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math"
@@ -232,10 +233,15 @@ func (p *Pinger) Privileged() bool {
 // done. If Count or Interval are not specified, it will run continuously until
 // it is interrupted.
 func (p *Pinger) Run() error {
-	return p.run()
+	return p.run(context.Background())
 }
 
-func (p *Pinger) run() error {
+// RunContext is like Run but also stops the pinger once ctx is done.
+func (p *Pinger) RunContext(ctx context.Context) error {
+	return p.run(ctx)
+}
+
+func (p *Pinger) run(ctx context.Context) error {
 	var conn *icmp.PacketConn
 	var err error
 	if p.ipv4 {
@@ -278,6 +284,10 @@ func (p *Pinger) run() error {
 			close(p.done)
 			wg.Wait()
 			return nil
+		case <-ctx.Done():
+			close(p.done)
+			wg.Wait()
+			return ctx.Err()
 		case <-interval.C:
 			if p.Count > 0 && p.PacketsSent >= p.Count {
 				continue
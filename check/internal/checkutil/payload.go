@@ -0,0 +1,31 @@
+package checkutil
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Decode decodes s, which is encoded with encoding: text,
+// the default, hex, ignoring whitespace, or base64.
+func Decode(s, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "text":
+		return []byte(s), nil
+	case "hex":
+		return hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	case "base64":
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unknown encoding %q, expected text, hex or base64", encoding)
+}
+
+// Snippet quotes the beginning of b for error messages.
+func Snippet(b []byte) string {
+	const max = 64
+	if len(b) > max {
+		return fmt.Sprintf("%q...", b[:max])
+	}
+	return fmt.Sprintf("%q", b)
+}
@@ -0,0 +1,42 @@
+// Package checkutil holds the helpers shared by checkers, like
+// reading secrets and loading TLS configuration.
+package checkutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+// ReadSecret reads the secret from file, trimmed of surrounding
+// whitespace, or else from the environment variable env. name
+// describes the secret in errors.
+func ReadSecret(name, file, env string) (string, error) {
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", name, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	secret, ok := os.LookupEnv(env)
+	if !ok {
+		return "", fmt.Errorf("reading %s: environment variable %s is not set", name, env)
+	}
+	return secret, nil
+}
+
+// ValidateSecret checks that one of the file and env fields
+// of a secret is set.
+func ValidateSecret(fileField, file, envField, env string) types.Errors {
+	switch {
+	case file == "" && env == "":
+		return types.Errors{types.NewValidationError(fileField, "%s or %s must be set", fileField, envField)}
+	case file != "" && env != "":
+		return types.Errors{types.NewValidationError(envField, "cannot be combined with %s", fileField)}
+	}
+	return nil
+}
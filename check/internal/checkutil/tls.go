@@ -0,0 +1,41 @@
+package checkutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// VersionNames are the names of the TLS versions, for the
+// details of results.
+var VersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// LoadCAFile returns a pool of the PEM certificates in file,
+// the tls_ca_file of a checker.
+func LoadCAFile(file string) (*x509.CertPool, error) {
+	rootPEM, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading tls_ca_file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(rootPEM) {
+		return nil, fmt.Errorf("tls_ca_file %s has no PEM certificates", file)
+	}
+	return pool, nil
+}
+
+// LoadKeyPair loads the client certificate of a checker from
+// its tls_cert_file and tls_key_file.
+func LoadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("loading tls_cert_file and tls_key_file: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// imapClient speaks IMAP4rev1 (RFC 3501) with a server.
+type imapClient struct {
+	textConn
+	tag  int
+	caps []string
+}
+
+func newIMAPClient(conn net.Conn, hello string) client {
+	return &imapClient{textConn: newTextConn(conn)}
+}
+
+// cmd sends a tagged command and returns the untagged
+// responses received until its completion, which must be OK.
+func (c *imapClient) cmd(format string, args ...interface{}) ([]string, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if err := c.text.PrintfLine(tag+" "+format, args...); err != nil {
+		return nil, err
+	}
+
+	var untagged []string
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(line, "* "):
+			untagged = append(untagged, line[2:])
+		case strings.HasPrefix(line, tag+" "):
+			status := line[len(tag)+1:]
+			if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+				return nil, fmt.Errorf("%s", status)
+			}
+			return untagged, nil
+		default:
+			return nil, fmt.Errorf("unexpected response %q", line)
+		}
+	}
+}
+
+// greeting reads the greeting, which is OK or PREAUTH.
+func (c *imapClient) greeting() (string, error) {
+	line, err := c.text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	upper := strings.ToUpper(line)
+	if !strings.HasPrefix(upper, "* OK") && !strings.HasPrefix(upper, "* PREAUTH") {
+		return "", fmt.Errorf("unexpected greeting %q", line)
+	}
+	return line[2:], nil
+}
+
+func (c *imapClient) capabilities() ([]string, error) {
+	untagged, err := c.cmd("CAPABILITY")
+	if err != nil {
+		return nil, err
+	}
+	c.caps = nil
+	for _, response := range untagged {
+		fields := strings.Fields(response)
+		if len(fields) > 0 && strings.EqualFold(fields[0], "CAPABILITY") {
+			c.caps = append(c.caps, fields[1:]...)
+		}
+	}
+	return c.caps, nil
+}
+
+func (c *imapClient) startTLS(config *tls.Config) error {
+	if !advertises(c.caps, "STARTTLS") {
+		return fmt.Errorf("STARTTLS is not advertised")
+	}
+	if _, err := c.cmd("STARTTLS"); err != nil {
+		return err
+	}
+	return c.upgrade(config)
+}
+
+func (c *imapClient) login(username, password string) error {
+	if advertises(c.caps, "LOGINDISABLED") {
+		return fmt.Errorf("LOGIN is disabled")
+	}
+	_, err := c.cmd("LOGIN %s %s", quote(username), quote(password))
+	return err
+}
+
+// mailbox selects INBOX and returns its number of messages.
+func (c *imapClient) mailbox() (string, error) {
+	untagged, err := c.cmd("SELECT INBOX")
+	if err != nil {
+		return "", err
+	}
+	for _, response := range untagged {
+		fields := strings.Fields(response)
+		if len(fields) == 2 && strings.EqualFold(fields[1], "EXISTS") {
+			return fields[0] + " messages", nil
+		}
+	}
+	return "", fmt.Errorf("no EXISTS response to SELECT INBOX")
+}
+
+func (c *imapClient) quit() error {
+	_, err := c.cmd("LOGOUT")
+	return err
+}
+
+// quote returns s as an IMAP quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
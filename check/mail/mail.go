@@ -0,0 +1,612 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/check/internal/checkutil"
+	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
+	"github.com/feifeigood/checkup/prometheus/metric"
+	"github.com/feifeigood/checkup/types"
+)
+
+// Type should match the package name
+const Type = "mail"
+
+// DefaultTimeout is the maximum time an attempt may take
+// when no Timeout is configured.
+const DefaultTimeout = 10 * time.Second
+
+// Protocols spoken by the checker.
+const (
+	ProtocolSMTP = "smtp"
+	ProtocolIMAP = "imap"
+	ProtocolPOP3 = "pop3"
+)
+
+// Checker implements a Checker for SMTP, IMAP and POP3 servers.
+type Checker struct {
+	// Name is the name of the endpoint.
+	Name string `json:"endpoint_name"`
+
+	// URL is the host:port of the endpoint.
+	URL string `json:"endpoint_url"`
+
+	// Protocol is the protocol of the endpoint, one of
+	// smtp, imap and pop3.
+	Protocol string `json:"protocol"`
+
+	// TLSEnabled connects over TLS, e.g. on ports 465,
+	// 993 and 995.
+	TLSEnabled bool `json:"tls,omitempty"`
+
+	// StartTLS upgrades the connection to TLS after the
+	// greeting with STARTTLS, or STLS for POP3.
+	StartTLS bool `json:"starttls,omitempty"`
+
+	// TLSSkipVerify controls whether to skip server TLS
+	// certificate validation or not.
+	TLSSkipVerify bool `json:"tls_skip_verify,omitempty"`
+
+	// TLSCAFile is the Certificate Authority used
+	// to validate the server TLS certificate.
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+
+	// TLSServerName is the name the server certificate
+	// is verified against. By default, it is the host
+	// of URL.
+	TLSServerName string `json:"tls_server_name,omitempty"`
+
+	// Hello is the name the checker introduces itself
+	// with to SMTP servers. Default is localhost.
+	Hello string `json:"hello,omitempty"`
+
+	// Capabilities must be advertised by the endpoint,
+	// e.g. PIPELINING, AUTH or SIZE for SMTP. A capability
+	// with parameters, like AUTH PLAIN LOGIN, is matched
+	// by its name alone.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// Username and Password are logged in with, using
+	// AUTH PLAIN for SMTP, LOGIN for IMAP and USER and
+	// PASS for POP3. IMAP and POP3 mailboxes are then
+	// checked with SELECT INBOX and STAT.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// PasswordFile or PasswordEnv contain the password,
+	// instead of Password, to keep it out of the
+	// configuration.
+	PasswordFile string `json:"password_file,omitempty"`
+	PasswordEnv  string `json:"password_env,omitempty"`
+
+	// ThresholdLogin is the maximum time logging in may
+	// take. If non-zero and the median login time of the
+	// attempts exceeds it, the endpoint is degraded.
+	ThresholdLogin types.Duration `json:"threshold_login,omitempty"`
+
+	// Timeout is the maximum time an attempt, from
+	// connecting to logging out, may take. Default is
+	// DefaultTimeout.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
+	// ThresholdRTT is the maximum round trip time to
+	// allow for a healthy endpoint. If non-zero and a
+	// request takes longer than ThresholdRTT, the
+	// endpoint will be considered unhealthy. Note that
+	// this duration includes any in-between network
+	// latency.
+	ThresholdRTT types.Duration `json:"threshold_rtt,omitempty"`
+
+	// Attempts is how many requests the client will
+	// make to the endpoint in a single check.
+	Attempts int `json:"attempts,omitempty"`
+
+	// Every override every subcommand interval If set.
+	Every types.Duration `json:"every,omitempty"`
+
+	//
+	metrics []metric.Metric
+}
+
+// session is what was learnt about the endpoint during
+// an attempt.
+type session struct {
+	greeting     string
+	capabilities []string
+	tls          *tls.ConnectionState
+	mailbox      string
+}
+
+// client speaks one of the protocols with a server.
+type client interface {
+	// greeting reads the greeting of the server.
+	greeting() (string, error)
+
+	// capabilities returns the capabilities advertised
+	// by the server.
+	capabilities() ([]string, error)
+
+	// startTLS upgrades the connection to TLS with config.
+	startTLS(config *tls.Config) error
+
+	// login authenticates with username and password.
+	login(username, password string) error
+
+	// quit ends the session.
+	quit() error
+
+	// tlsState returns the TLS connection state, nil if
+	// the connection is not over TLS.
+	tlsState() *tls.ConnectionState
+}
+
+// mailboxClient is a client of a protocol with mailboxes,
+// IMAP and POP3.
+type mailboxClient interface {
+	// mailbox checks the mailbox once logged in and
+	// describes it, e.g. its number of messages.
+	mailbox() (string, error)
+}
+
+// newClients creates a client for every protocol.
+var newClients = map[string]func(conn net.Conn, hello string) client{
+	ProtocolSMTP: newSMTPClient,
+	ProtocolIMAP: newIMAPClient,
+	ProtocolPOP3: newPOP3Client,
+}
+
+// Type returns the checker package name
+func (c *Checker) Type() string {
+	return Type
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
+// New creates a new Checker instance based on json config
+func New(config json.RawMessage) (*Checker, error) {
+	var checker Checker
+	err := json.Unmarshal(config, &checker)
+	checker.metrics = []metric.Metric{}
+	return &checker, err
+}
+
+// GetEvery returns the checker specified check interval to override every subcommand
+func (c *Checker) GetEvery() time.Duration {
+	return c.Every.Duration
+}
+
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	} else if _, _, err := net.SplitHostPort(c.URL); err != nil {
+		errs = append(errs, types.NewValidationError("endpoint_url", "%v", err))
+	}
+	if _, ok := newClients[c.Protocol]; !ok {
+		errs = append(errs, types.NewValidationError("protocol", "unknown protocol %q, expected smtp, imap or pop3", c.Protocol))
+	}
+	if c.TLSEnabled && c.StartTLS {
+		errs = append(errs, types.NewValidationError("starttls", "cannot be combined with tls"))
+	}
+	if !c.TLSEnabled && !c.StartTLS {
+		for field, set := range map[string]bool{
+			"tls_skip_verify": c.TLSSkipVerify,
+			"tls_ca_file":     c.TLSCAFile != "",
+			"tls_server_name": c.TLSServerName != "",
+			"username":        c.Username != "",
+		} {
+			if set {
+				errs = append(errs, types.NewValidationError(field, "requires tls or starttls"))
+			}
+		}
+	}
+	if c.Hello != "" && c.Protocol != ProtocolSMTP {
+		errs = append(errs, types.NewValidationError("hello", "requires protocol smtp"))
+	}
+	for i, capability := range c.Capabilities {
+		if strings.TrimSpace(capability) == "" {
+			errs = append(errs, types.NewValidationError(fmt.Sprintf("capabilities[%d]", i), "must not be empty"))
+		}
+	}
+	var password string
+	for _, field := range []struct{ name, value string }{
+		{"password", c.Password},
+		{"password_file", c.PasswordFile},
+		{"password_env", c.PasswordEnv},
+	} {
+		switch {
+		case field.value == "":
+		case password == "":
+			password = field.name
+		default:
+			errs = append(errs, types.NewValidationError(field.name, "cannot be combined with %s", password))
+		}
+	}
+	if password != "" && c.Username == "" {
+		errs = append(errs, types.NewValidationError("username", "must be set with %s", password))
+	}
+	if c.ThresholdLogin.Duration != 0 && c.Username == "" {
+		errs = append(errs, types.NewValidationError("threshold_login", "requires username"))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":           c.Every.Duration,
+		"timeout":         c.Timeout.Duration,
+		"threshold_login": c.ThresholdLogin.Duration,
+		"threshold_rtt":   c.ThresholdRTT.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
+// Check performs checks using c according to its configuration.
+// An error is only returned if there is a configuration error.
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
+	if c.Attempts < 1 {
+		c.Attempts = 1
+	}
+
+	result := types.NewResult()
+	result.Type = c.Type()
+	result.Title = c.Name
+	result.Endpoint = c.URL
+
+	newClient, ok := newClients[c.Protocol]
+	if !ok {
+		return result, fmt.Errorf("unknown protocol %q", c.Protocol)
+	}
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return result, err
+	}
+	var last *session
+	result.Times, last = c.doChecks(ctx, newClient, tlsConfig)
+
+	return c.conclude(result, last), nil
+}
+
+// tlsConfig returns the TLS config based on configuration.
+func (c *Checker) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+	if host, _, err := net.SplitHostPort(c.URL); err == nil && tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	if c.TLSCAFile != "" {
+		pool, err := checkutil.LoadCAFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// doChecks executes and returns each attempt, and the last
+// session which got past the greeting.
+func (c *Checker) doChecks(ctx context.Context, newClient func(net.Conn, string) client, tlsConfig *tls.Config) (types.Attempts, *session) {
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var last *session
+	checks := make(types.Attempts, c.Attempts)
+	for i := 0; i < c.Attempts; i++ {
+		start := time.Now()
+
+		s, err := c.doCheck(ctx, newClient, tlsConfig, timeout, &checks[i])
+
+		checks[i].RTT = time.Since(start)
+		if s != nil {
+			last = s
+		}
+		if err != nil {
+			checks[i].Error = err.Error()
+			continue
+		}
+	}
+	return checks, last
+}
+
+// doCheck connects to the endpoint and goes through a session
+// within timeout, recording every stage as a step of attempt.
+// The session is returned once it got past the greeting.
+func (c *Checker) doCheck(ctx context.Context, newClient func(net.Conn, string) client, tlsConfig *tls.Config, timeout time.Duration, attempt *types.Attempt) (*session, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// step runs fn as the step name of the attempt.
+	step := func(name string, fn func() error) error {
+		start := time.Now()
+		err := fn()
+		s := types.Step{Name: name, RTT: time.Since(start)}
+		if err != nil {
+			s.Error = err.Error()
+			err = fmt.Errorf("%s: %w", name, err)
+		}
+		attempt.Steps = append(attempt.Steps, s)
+		return err
+	}
+
+	var conn net.Conn
+	err := step("connect", func() error {
+		var err error
+		conn, err = c.dial(ctx, tlsConfig)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	cl := newClient(conn, c.Hello)
+
+	s := session{tls: cl.tlsState()}
+	err = step("greeting", func() error {
+		var err error
+		s.greeting, err = cl.greeting()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = step("capabilities", func() error {
+		var err error
+		s.capabilities, err = cl.capabilities()
+		return err
+	})
+	if err != nil {
+		return &s, err
+	}
+
+	if c.StartTLS {
+		err = step("starttls", func() error {
+			if err := cl.startTLS(tlsConfig); err != nil {
+				return err
+			}
+			// Capabilities may change once the connection
+			// is secure
+			var err error
+			s.capabilities, err = cl.capabilities()
+			return err
+		})
+		if err != nil {
+			return &s, err
+		}
+		s.tls = cl.tlsState()
+	}
+
+	for _, capability := range c.Capabilities {
+		if !advertises(s.capabilities, capability) {
+			return &s, fmt.Errorf("capability %s is not advertised", capability)
+		}
+	}
+
+	if c.Username != "" {
+		err = step("login", func() error {
+			password, err := c.password()
+			if err != nil {
+				return err
+			}
+			return cl.login(c.Username, password)
+		})
+		if err != nil {
+			return &s, err
+		}
+	}
+	if mc, ok := cl.(mailboxClient); ok && c.Username != "" {
+		err = step("mailbox", func() error {
+			var err error
+			s.mailbox, err = mc.mailbox()
+			return err
+		})
+		if err != nil {
+			return &s, err
+		}
+	}
+
+	// The server is up even if it does not say goodbye
+	cl.quit()
+	return &s, nil
+}
+
+// password returns the password to log in with, read from
+// PasswordFile or PasswordEnv if set.
+func (c *Checker) password() (string, error) {
+	if c.PasswordFile == "" && c.PasswordEnv == "" {
+		return c.Password, nil
+	}
+	return checkutil.ReadSecret("password", c.PasswordFile, c.PasswordEnv)
+}
+
+// dial connects to c.URL, performing a TLS handshake if
+// enabled. The connection is usable until ctx is done.
+func (c *Checker) dial(ctx context.Context, tlsConfig *tls.Config) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unblock reads and writes when ctx is done, at the
+	// latest when the attempt ends
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now())
+	}()
+	if !c.TLSEnabled {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// advertises reports whether capability is one of the
+// advertised capabilities, ignoring case and parameters.
+func advertises(capabilities []string, capability string) bool {
+	for _, advertised := range capabilities {
+		if strings.EqualFold(advertised, capability) {
+			return true
+		}
+		if len(advertised) > len(capability) && strings.EqualFold(advertised[:len(capability)], capability) && advertised[len(capability)] == ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// textConn is a line oriented connection shared by the
+// clients, which may be upgraded to TLS.
+type textConn struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+func newTextConn(conn net.Conn) textConn {
+	return textConn{conn: conn, text: textproto.NewConn(conn)}
+}
+
+// upgrade performs a TLS handshake over the connection with
+// config, keeping its deadline.
+func (c *textConn) upgrade(config *tls.Config) error {
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn, c.text = tlsConn, textproto.NewConn(tlsConn)
+	return nil
+}
+
+func (c *textConn) tlsState() *tls.ConnectionState {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// details returns the details of the result from s.
+func (s *session) details() map[string]string {
+	details := map[string]string{
+		"greeting":     s.greeting,
+		"capabilities": strings.Join(s.capabilities, ", "),
+	}
+	if s.mailbox != "" {
+		details["mailbox"] = s.mailbox
+	}
+	if s.tls == nil {
+		return details
+	}
+	details["tls_version"] = checkutil.VersionNames[s.tls.Version]
+	details["tls_cipher"] = tls.CipherSuiteName(s.tls.CipherSuite)
+	if len(s.tls.PeerCertificates) > 0 {
+		leaf := s.tls.PeerCertificates[0]
+		details["certificate_subject"] = leaf.Subject.CommonName
+		details["certificate_issuer"] = leaf.Issuer.CommonName
+		details["certificate_not_after"] = leaf.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return details
+}
+
+// conclude takes the data in result from the attempts and
+// computes remaining values needed to fill out the result.
+// It detects degraded (high-latency or slow login) responses
+// and makes the conclusion about the result's status. Details
+// of the result are taken from s, if set.
+func (c *Checker) conclude(result types.Result, s *session) types.Result {
+	result.ThresholdRTT = c.ThresholdRTT.Duration
+
+	if s != nil {
+		result.Details = s.details()
+	}
+
+	// Check errors (down)
+	for i := range result.Times {
+		if result.Times[i].Error != "" {
+			result.Down = true
+			return result
+		}
+	}
+
+	// Check login time (degraded)
+	if c.ThresholdLogin.Duration > 0 {
+		if median := medianStep(result.Times, "login"); median > c.ThresholdLogin.Duration {
+			result.Notice = fmt.Sprintf("median login time exceeded threshold (%s)", c.ThresholdLogin)
+			result.Degraded = true
+			return result
+		}
+	}
+
+	// Check round trip time (degraded)
+	if c.ThresholdRTT.Duration > 0 {
+		stats := result.ComputeStats()
+		if stats.Median > c.ThresholdRTT.Duration {
+			result.Notice = fmt.Sprintf("median round trip time exceeded threshold (%s)", c.ThresholdRTT)
+			result.Degraded = true
+			return result
+		}
+	}
+
+	result.Healthy = true
+	return result
+}
+
+// medianStep returns the median duration of the steps named
+// name of attempts.
+func medianStep(attempts types.Attempts, name string) time.Duration {
+	var rtts []time.Duration
+	for _, attempt := range attempts {
+		for _, step := range attempt.Steps {
+			if step.Name == name {
+				rtts = append(rtts, step.RTT)
+			}
+		}
+	}
+	if len(rtts) == 0 {
+		return 0
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	half := len(rtts) / 2
+	if len(rtts)%2 == 0 {
+		return (rtts[half-1] + rtts[half]) / 2
+	}
+	return rtts[half]
+}
+
+func (c *Checker) Collect(collector checkup_prometheus_client.Collector) {
+	if c.metrics != nil && len(c.metrics) > 0 {
+		collector.Add(c.metrics)
+	}
+	c.metrics = []metric.Metric{}
+}
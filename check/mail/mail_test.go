@@ -0,0 +1,468 @@
+package mail
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCert returns a self-signed certificate for 127.0.0.1.
+func newCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "checkup"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// standIn is an in-process stand-in for a mail server which
+// accepts the username user with the password s3cret.
+type standIn struct {
+	greeting    string
+	reply       func(s *standIn, c *standInConn, line string) bool
+	implicitTLS bool
+	loginDelay  time.Duration
+	tlsConfig   *tls.Config
+}
+
+// standInConn is a connection to a stand-in.
+type standInConn struct {
+	conn   net.Conn
+	text   *textproto.Conn
+	secure bool
+}
+
+func (c *standInConn) send(lines ...string) {
+	for _, line := range lines {
+		c.text.PrintfLine("%s", line)
+	}
+}
+
+func (c *standInConn) upgrade(config *tls.Config) {
+	c.conn = tls.Server(c.conn, config)
+	c.text = textproto.NewConn(c.conn)
+	c.secure = true
+}
+
+// serve accepts connections on a local port, greeting them
+// and replying to every line until reply returns false.
+func (s *standIn) serve(t *testing.T) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{newCert(t)}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				c := &standInConn{conn: conn, text: textproto.NewConn(conn)}
+				if s.implicitTLS {
+					c.upgrade(s.tlsConfig)
+				}
+				c.send(s.greeting)
+				for {
+					line, err := c.text.ReadLine()
+					if err != nil || !s.reply(s, c, line) {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func smtpReply(s *standIn, c *standInConn, line string) bool {
+	switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+	case "EHLO":
+		if c.secure {
+			c.send("250-mail.example.com", "250-AUTH LOGIN PLAIN", "250 PIPELINING")
+		} else {
+			c.send("250-mail.example.com", "250-STARTTLS", "250 PIPELINING")
+		}
+	case "STARTTLS":
+		c.send("220 2.0.0 Ready to start TLS")
+		c.upgrade(s.tlsConfig)
+	case "AUTH":
+		time.Sleep(s.loginDelay)
+		if line == "AUTH PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00user\x00s3cret")) {
+			c.send("235 2.7.0 Authentication successful")
+		} else {
+			c.send("535 5.7.8 Authentication credentials invalid")
+		}
+	case "QUIT":
+		c.send("221 2.0.0 Bye")
+		return false
+	default:
+		c.send("502 5.5.2 Error: command not recognized")
+	}
+	return true
+}
+
+func imapReply(s *standIn, c *standInConn, line string) bool {
+	fields := strings.Fields(line + " .")
+	tag := fields[0]
+	switch strings.ToUpper(fields[1]) {
+	case "CAPABILITY":
+		if c.secure {
+			c.send("* CAPABILITY IMAP4rev1 AUTH=PLAIN")
+		} else {
+			c.send("* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED")
+		}
+		c.send(tag + " OK CAPABILITY completed")
+	case "STARTTLS":
+		c.send(tag + " OK Begin TLS negotiation now")
+		c.upgrade(s.tlsConfig)
+	case "LOGIN":
+		time.Sleep(s.loginDelay)
+		if line == tag+` LOGIN "user" "s3cret"` {
+			c.send(tag + " OK LOGIN completed")
+		} else {
+			c.send(tag + " NO [AUTHENTICATIONFAILED] Invalid credentials")
+		}
+	case "SELECT":
+		c.send("* 3 EXISTS", "* 0 RECENT", tag+" OK [READ-WRITE] SELECT completed")
+	case "LOGOUT":
+		c.send("* BYE Logging out", tag+" OK LOGOUT completed")
+		return false
+	default:
+		c.send(tag + " BAD Unknown command")
+	}
+	return true
+}
+
+func pop3Reply(s *standIn, c *standInConn, line string) bool {
+	switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+	case "CAPA":
+		c.send("+OK Capability list follows", "USER")
+		if !c.secure {
+			c.send("STLS")
+		}
+		c.send(".")
+	case "STLS":
+		c.send("+OK Begin TLS negotiation")
+		c.upgrade(s.tlsConfig)
+	case "USER":
+		c.send("+OK")
+	case "PASS":
+		time.Sleep(s.loginDelay)
+		if line == "PASS s3cret" {
+			c.send("+OK Logged in")
+		} else {
+			c.send("-ERR invalid password")
+		}
+	case "STAT":
+		c.send("+OK 2 320")
+	case "QUIT":
+		c.send("+OK Bye")
+		return false
+	default:
+		c.send("-ERR Unknown command")
+	}
+	return true
+}
+
+func TestChecker(t *testing.T) {
+	smtp := &standIn{greeting: "220 mail.example.com ESMTP ready", reply: smtpReply}
+	imap := &standIn{greeting: "* OK IMAP4rev1 ready", reply: imapReply}
+	imaps := &standIn{greeting: "* OK IMAP4rev1 ready", reply: imapReply, implicitTLS: true}
+	pop3 := &standIn{greeting: "+OK POP3 ready", reply: pop3Reply}
+	unavailable := &standIn{greeting: "554 5.3.2 Service unavailable", reply: smtpReply}
+	addrs := make(map[*standIn]string)
+	for _, s := range []*standIn{smtp, imap, imaps, pop3, unavailable} {
+		addr, stop := s.serve(t)
+		defer stop()
+		addrs[s] = addr
+	}
+
+	dir, err := ioutil.TempDir("", "checkup")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Cannot write password file: %v", err)
+	}
+	os.Setenv("CHECKUP_TEST_MAIL_PASSWORD", "s3cret")
+	defer os.Unsetenv("CHECKUP_TEST_MAIL_PASSWORD")
+
+	login := Checker{StartTLS: true, TLSSkipVerify: true, Username: "user", Password: "s3cret"}
+	for i, test := range []struct {
+		server  *standIn
+		hc      Checker
+		steps   string
+		details map[string]string
+		err     string
+	}{
+		{
+			server: smtp,
+			hc:     Checker{Protocol: ProtocolSMTP, Capabilities: []string{"pipelining"}},
+			steps:  "connect greeting capabilities",
+			details: map[string]string{
+				"greeting":     "mail.example.com ESMTP ready",
+				"capabilities": "STARTTLS, PIPELINING",
+			},
+		},
+		{
+			server: smtp,
+			hc:     Checker{Protocol: ProtocolSMTP, Capabilities: []string{"AUTH"}},
+			steps:  "connect greeting capabilities",
+			err:    "capability AUTH is not advertised",
+		},
+		{
+			server: smtp,
+			hc:     login,
+			steps:  "connect greeting capabilities starttls login",
+			details: map[string]string{
+				"capabilities":        "AUTH LOGIN PLAIN, PIPELINING",
+				"certificate_subject": "checkup",
+				"tls_version":         "TLS 1.3",
+			},
+		},
+		{
+			server: smtp,
+			hc:     Checker{StartTLS: true, TLSSkipVerify: true, Username: "user", Password: "wrong"},
+			steps:  "connect greeting capabilities starttls login",
+			err:    "login: 535 5.7.8 Authentication credentials invalid",
+		},
+		{
+			server: smtp,
+			hc:     Checker{StartTLS: true},
+			steps:  "connect greeting capabilities starttls",
+			err:    "starttls: ",
+		},
+		{
+			server: unavailable,
+			hc:     Checker{Protocol: ProtocolSMTP},
+			steps:  "connect greeting",
+			err:    "greeting: 554 5.3.2 Service unavailable",
+		},
+		{
+			server: imap,
+			hc:     login,
+			steps:  "connect greeting capabilities starttls login mailbox",
+			details: map[string]string{
+				"greeting":     "OK IMAP4rev1 ready",
+				"capabilities": "IMAP4rev1, AUTH=PLAIN",
+				"mailbox":      "3 messages",
+			},
+		},
+		{
+			server:  imaps,
+			hc:      Checker{TLSEnabled: true, TLSSkipVerify: true, Username: "user", Password: "s3cret"},
+			steps:   "connect greeting capabilities login mailbox",
+			details: map[string]string{"certificate_subject": "checkup"},
+		},
+		{
+			server: imap,
+			hc:     Checker{Protocol: ProtocolIMAP, Capabilities: []string{"LOGINDISABLED", "STARTTLS"}},
+			steps:  "connect greeting capabilities",
+		},
+		{
+			server: imaps,
+			hc:     Checker{TLSEnabled: true, TLSSkipVerify: true, Username: "user", Password: "wrong"},
+			steps:  "connect greeting capabilities login",
+			err:    "login: NO [AUTHENTICATIONFAILED] Invalid credentials",
+		},
+		{
+			server: pop3,
+			hc:     login,
+			steps:  "connect greeting capabilities starttls login mailbox",
+			details: map[string]string{
+				"greeting":     "POP3 ready",
+				"capabilities": "USER",
+				"mailbox":      "2 messages, 320 bytes",
+			},
+		},
+		{
+			server: pop3,
+			hc:     Checker{StartTLS: true, TLSSkipVerify: true, Username: "user", Password: "wrong"},
+			steps:  "connect greeting capabilities starttls login",
+			err:    "login: -ERR invalid password",
+		},
+		{
+			server: pop3,
+			hc:     Checker{StartTLS: true, TLSSkipVerify: true, Username: "user", PasswordFile: passwordFile},
+			steps:  "connect greeting capabilities starttls login mailbox",
+		},
+		{
+			server: imaps,
+			hc:     Checker{TLSEnabled: true, TLSSkipVerify: true, Username: "user", PasswordEnv: "CHECKUP_TEST_MAIL_PASSWORD"},
+			steps:  "connect greeting capabilities login mailbox",
+		},
+		{
+			server: smtp,
+			hc:     Checker{StartTLS: true, TLSSkipVerify: true, Username: "user", PasswordEnv: "CHECKUP_TEST_MAIL_MISSING"},
+			steps:  "connect greeting capabilities starttls login",
+			err:    "login: reading password: environment variable CHECKUP_TEST_MAIL_MISSING is not set",
+		},
+	} {
+		hc := test.hc
+		hc.Name, hc.URL, hc.Attempts = "Test", addrs[test.server], 2
+		if hc.Protocol == "" {
+			switch test.server {
+			case smtp:
+				hc.Protocol = ProtocolSMTP
+			case imap, imaps:
+				hc.Protocol = ProtocolIMAP
+			case pop3:
+				hc.Protocol = ProtocolPOP3
+			}
+		}
+		hc.Timeout.Duration = time.Second
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Healthy, test.err == ""; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+		if got := result.Times[0].Error; !strings.HasPrefix(got, test.err) || (test.err == "") != (got == "") {
+			t.Errorf("Test %d: Expected error '%s', got '%s'", i, test.err, got)
+		}
+		var steps []string
+		for _, step := range result.Times[0].Steps {
+			steps = append(steps, step.Name)
+		}
+		if got, want := strings.Join(steps, " "), test.steps; got != want {
+			t.Errorf("Test %d: Expected steps '%s', got '%s'", i, want, got)
+		}
+		for key, want := range test.details {
+			if got := result.Details[key]; got != want {
+				t.Errorf("Test %d: Expected details[%s]='%s', got '%s'", i, key, want, got)
+			}
+		}
+	}
+}
+
+func TestCheckerThresholdLogin(t *testing.T) {
+	s := &standIn{greeting: "+OK POP3 ready", reply: pop3Reply, loginDelay: 50 * time.Millisecond}
+	addr, stop := s.serve(t)
+	defer stop()
+
+	hc := Checker{
+		Name:          "Test",
+		URL:           addr,
+		Protocol:      ProtocolPOP3,
+		StartTLS:      true,
+		TLSSkipVerify: true,
+		Username:      "user",
+		Password:      "s3cret",
+		Attempts:      3,
+	}
+	hc.ThresholdLogin.Duration = 10 * time.Millisecond
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Degraded, true; got != want {
+		t.Errorf("Expected result.Degraded=%v, got %v (%v)", want, got, result.Times)
+	}
+	if got, want := result.Notice, "median login time exceeded threshold (10ms)"; got != want {
+		t.Errorf("Expected notice '%s', got '%s'", want, got)
+	}
+
+	hc.ThresholdLogin.Duration = time.Second
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+}
+
+func TestCheckerCancel(t *testing.T) {
+	// A server which never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	hc := Checker{Name: "Test", URL: ln.Addr().String(), Protocol: ProtocolSMTP}
+	hc.Timeout.Duration = 10 * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := hc.Check(ctx)
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected check to be aborted, took %s", elapsed)
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	hc := Checker{
+		Name:         "Test",
+		URL:          "localhost",
+		Protocol:     "nntp",
+		Hello:        "checkup.example.com",
+		Capabilities: []string{"IDLE", " "},
+		Username:     "user",
+		Password:     "s3cret",
+		PasswordFile: "/etc/checkup/password",
+		PasswordEnv:  "CHECKUP_PASSWORD",
+	}
+	want := []string{
+		"endpoint_url: address localhost: missing port in address",
+		`protocol: unknown protocol "nntp", expected smtp, imap or pop3`,
+		"username: requires tls or starttls",
+		"hello: requires protocol smtp",
+		"capabilities[1]: must not be empty",
+		"password_file: cannot be combined with password",
+		"password_env: cannot be combined with password",
+	}
+	if got := strings.Split(hc.Validate().Error(), "; "); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
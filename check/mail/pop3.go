@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// pop3Client speaks POP3 (RFC 1939) with a server.
+type pop3Client struct {
+	textConn
+	caps []string
+}
+
+// pop3Error is a negative (-ERR) reply of the server.
+type pop3Error string
+
+func (e pop3Error) Error() string {
+	return string(e)
+}
+
+func newPOP3Client(conn net.Conn, hello string) client {
+	return &pop3Client{textConn: newTextConn(conn)}
+}
+
+// reply reads a reply and returns what follows +OK.
+func (c *pop3Client) reply() (string, error) {
+	line, err := c.text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(line, "-ERR") {
+		return "", pop3Error(line)
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return "", fmt.Errorf("unexpected reply %q", line)
+	}
+	return strings.TrimSpace(line[3:]), nil
+}
+
+// cmd sends a command and reads its reply.
+func (c *pop3Client) cmd(format string, args ...interface{}) (string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return c.reply()
+}
+
+func (c *pop3Client) greeting() (string, error) {
+	return c.reply()
+}
+
+// capabilities lists the capabilities with CAPA (RFC 2449),
+// which servers may not support.
+func (c *pop3Client) capabilities() ([]string, error) {
+	_, err := c.cmd("CAPA")
+	if _, ok := err.(pop3Error); ok {
+		c.caps = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.caps, err = c.text.ReadDotLines()
+	return c.caps, err
+}
+
+func (c *pop3Client) startTLS(config *tls.Config) error {
+	if !advertises(c.caps, "STLS") {
+		return fmt.Errorf("STLS is not advertised")
+	}
+	if _, err := c.cmd("STLS"); err != nil {
+		return err
+	}
+	return c.upgrade(config)
+}
+
+func (c *pop3Client) login(username, password string) error {
+	if _, err := c.cmd("USER %s", username); err != nil {
+		return err
+	}
+	_, err := c.cmd("PASS %s", password)
+	return err
+}
+
+// mailbox returns the number of messages and size of the
+// mailbox from STAT.
+func (c *pop3Client) mailbox() (string, error) {
+	stat, err := c.cmd("STAT")
+	if err != nil {
+		return "", err
+	}
+	var count, size int
+	if _, err := fmt.Sscanf(stat, "%d %d", &count, &size); err != nil {
+		return "", fmt.Errorf("unexpected STAT reply %q", stat)
+	}
+	return fmt.Sprintf("%d messages, %d bytes", count, size), nil
+}
+
+func (c *pop3Client) quit() error {
+	_, err := c.cmd("QUIT")
+	return err
+}
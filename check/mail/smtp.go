@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// smtpClient speaks SMTP (RFC 5321) with a server.
+type smtpClient struct {
+	textConn
+	hello      string
+	extensions []string
+}
+
+func newSMTPClient(conn net.Conn, hello string) client {
+	if hello == "" {
+		hello = "localhost"
+	}
+	return &smtpClient{textConn: newTextConn(conn), hello: hello}
+}
+
+// cmd sends a command and reads its reply, which must have
+// the code expectCode.
+func (c *smtpClient) cmd(expectCode int, format string, args ...interface{}) (string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	_, msg, err := c.text.ReadResponse(expectCode)
+	return msg, smtpError(err)
+}
+
+func (c *smtpClient) greeting() (string, error) {
+	_, msg, err := c.text.ReadResponse(220)
+	return msg, smtpError(err)
+}
+
+// capabilities returns the extensions listed in the reply
+// to EHLO, after the greeting line.
+func (c *smtpClient) capabilities() ([]string, error) {
+	msg, err := c.cmd(250, "EHLO %s", c.hello)
+	if err != nil {
+		return nil, err
+	}
+	c.extensions = strings.Split(msg, "\n")[1:]
+	return c.extensions, nil
+}
+
+func (c *smtpClient) startTLS(config *tls.Config) error {
+	if !advertises(c.extensions, "STARTTLS") {
+		return fmt.Errorf("STARTTLS is not advertised")
+	}
+	if _, err := c.cmd(220, "STARTTLS"); err != nil {
+		return err
+	}
+	return c.upgrade(config)
+}
+
+// login authenticates with AUTH PLAIN (RFC 4616).
+func (c *smtpClient) login(username, password string) error {
+	plain := false
+	for _, extension := range c.extensions {
+		fields := strings.Fields(strings.ToUpper(extension))
+		if len(fields) > 0 && fields[0] == "AUTH" {
+			plain = plain || advertises(fields[1:], "PLAIN")
+		}
+	}
+	if !plain {
+		return fmt.Errorf("AUTH PLAIN is not advertised")
+	}
+	response := base64.StdEncoding.EncodeToString([]byte("\x00" + username + "\x00" + password))
+	_, err := c.cmd(235, "AUTH PLAIN %s", response)
+	return err
+}
+
+func (c *smtpClient) quit() error {
+	_, err := c.cmd(221, "QUIT")
+	return err
+}
+
+// smtpError formats the error of an unexpected reply as it
+// was received.
+func smtpError(err error) error {
+	var e *textproto.Error
+	if errors.As(err, &e) {
+		return fmt.Errorf("%03d %s", e.Code, strings.ReplaceAll(e.Msg, "\n", " "))
+	}
+	return err
+}
@@ -0,0 +1,225 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/feifeigood/checkup/check/internal/checkutil"
+	"github.com/feifeigood/checkup/types"
+)
+
+// DefaultReadTimeout is how long a step waits for what it
+// expects when no ReadTimeout is configured.
+const DefaultReadTimeout = 5 * time.Second
+
+// maxExpectBytes is how much is read at most while waiting
+// for what a step expects.
+const maxExpectBytes = 64 << 10
+
+// Step is a step of the conversation with the endpoint. It
+// sends Send, then reads until it receives Expect or a match of
+// ExpectRegex, then upgrades the connection if StartTLS is set.
+type Step struct {
+	// Name describes the step in errors and results.
+	// By default, it is derived from the other fields.
+	Name string `json:"name,omitempty"`
+
+	// Send is written to the connection, encoded with
+	// Encoding.
+	Send string `json:"send,omitempty"`
+
+	// Encoding is the encoding of Send, one of text
+	// (default), hex and base64.
+	Encoding string `json:"encoding,omitempty"`
+
+	// Expect is what must be received.
+	Expect string `json:"expect,omitempty"`
+
+	// ExpectRegex is a regular expression which what is
+	// received must match.
+	ExpectRegex string `json:"expect_regex,omitempty"`
+
+	// StartTLS upgrades the connection to TLS, e.g. after
+	// sending a STARTTLS command and reading the reply.
+	StartTLS bool `json:"starttls,omitempty"`
+}
+
+// name returns the name of s.
+func (s Step) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	var parts []string
+	if s.Send != "" {
+		parts = append(parts, fmt.Sprintf("send %q", s.Send))
+	}
+	if s.Expect != "" {
+		parts = append(parts, fmt.Sprintf("expect %q", s.Expect))
+	}
+	if s.ExpectRegex != "" {
+		parts = append(parts, fmt.Sprintf("expect /%s/", s.ExpectRegex))
+	}
+	if s.StartTLS {
+		parts = append(parts, "starttls")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// validate returns the configuration errors of s.
+func (s Step) validate() types.Errors {
+	var errs types.Errors
+	if s.Send == "" && s.Expect == "" && s.ExpectRegex == "" && !s.StartTLS {
+		errs = append(errs, types.NewValidationError("", "one of send, expect, expect_regex and starttls must be set"))
+	}
+	if _, err := checkutil.Decode(s.Send, s.Encoding); err != nil {
+		errs = append(errs, types.NewValidationError("send", "%v", err))
+	}
+	if s.Expect != "" && s.ExpectRegex != "" {
+		errs = append(errs, types.NewValidationError("expect_regex", "cannot be combined with expect"))
+	}
+	if _, err := regexp.Compile(s.ExpectRegex); err != nil {
+		errs = append(errs, types.NewValidationError("expect_regex", "%v", err))
+	}
+	return errs
+}
+
+// compiledStep is a Step ready to be run.
+type compiledStep struct {
+	Step
+	send  []byte
+	match func(b []byte) []int
+}
+
+// compile decodes and compiles the Steps of c.
+func (c *Checker) compile() ([]*compiledStep, error) {
+	steps := make([]*compiledStep, len(c.Steps))
+	for i, step := range c.Steps {
+		s := &compiledStep{Step: step}
+		send, err := checkutil.Decode(step.Send, step.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("steps[%d].send: %w", i, err)
+		}
+		s.send = send
+		switch {
+		case step.Expect != "":
+			expect := []byte(step.Expect)
+			s.match = func(b []byte) []int {
+				if i := bytes.Index(b, expect); i >= 0 {
+					return []int{i, i + len(expect)}
+				}
+				return nil
+			}
+		case step.ExpectRegex != "":
+			re, err := regexp.Compile(step.ExpectRegex)
+			if err != nil {
+				return nil, fmt.Errorf("steps[%d].expect_regex: %w", i, err)
+			}
+			s.match = re.FindIndex
+		}
+		steps[i] = s
+	}
+	return steps, nil
+}
+
+// converse runs steps over conn, recording each as a step of
+// attempt, until one fails or ctx is done. Every step must
+// complete within readTimeout. It returns the connection, which StartTLS steps
+// replace with a TLS connection.
+func (c *Checker) converse(ctx context.Context, conn net.Conn, steps []*compiledStep, readTimeout time.Duration, attempt *types.Attempt) (net.Conn, error) {
+	// Unblock reads and writes when ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func(raw net.Conn) {
+		select {
+		case <-ctx.Done():
+			raw.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}(conn)
+
+	// pending is what was received but not expected yet
+	var pending []byte
+	for i, step := range steps {
+		start := time.Now()
+		deadline := start.Add(readTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetDeadline(deadline)
+		// Checked once the deadline is set, as it replaces
+		// the one set when ctx was done
+		if err := ctx.Err(); err != nil {
+			return conn, fmt.Errorf("step %d (%s): %v", i+1, step.name(), err)
+		}
+
+		var err error
+		conn, pending, err = c.doStep(conn, step, pending)
+		s := types.Step{Name: step.name(), RTT: time.Since(start)}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		attempt.Steps = append(attempt.Steps, s)
+		if err != nil {
+			return conn, fmt.Errorf("step %d (%s): %v", i+1, s.Name, err)
+		}
+	}
+	return conn, nil
+}
+
+// doStep runs step over conn, with pending received already.
+// It returns the connection and what was received after the
+// expected data.
+func (c *Checker) doStep(conn net.Conn, step *compiledStep, pending []byte) (net.Conn, []byte, error) {
+	if len(step.send) > 0 {
+		if _, err := conn.Write(step.send); err != nil {
+			return conn, nil, err
+		}
+	}
+
+	if step.match != nil {
+		buf := make([]byte, 4096)
+		for {
+			if loc := step.match(pending); loc != nil {
+				pending = pending[loc[1]:]
+				break
+			}
+			if len(pending) >= maxExpectBytes {
+				return conn, nil, fmt.Errorf("expected %s, got %s", step.expected(), checkutil.Snippet(pending))
+			}
+			n, err := conn.Read(buf)
+			pending = append(pending, buf[:n]...)
+			if err != nil && step.match(pending) == nil {
+				return conn, nil, fmt.Errorf("expected %s, got %s: %v", step.expected(), checkutil.Snippet(pending), err)
+			}
+		}
+	}
+
+	if step.StartTLS {
+		// Anything received before the upgrade could have
+		// been injected, so it is dropped
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return conn, nil, err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return conn, nil, fmt.Errorf("starttls: %w", err)
+		}
+		return tlsConn, nil, nil
+	}
+	return conn, pending, nil
+}
+
+// expected describes what step expects.
+func (s *compiledStep) expected() string {
+	if s.ExpectRegex != "" {
+		return fmt.Sprintf("a match of /%s/", s.ExpectRegex)
+	}
+	return fmt.Sprintf("%q", s.Expect)
+}
@@ -1,25 +1,20 @@
 package tcp
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"time"
 
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/check/internal/checkutil"
 	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
 	"github.com/feifeigood/checkup/prometheus/metric"
 	"github.com/feifeigood/checkup/types"
 )
 
-var (
-	errReadingRootCert = errors.New("error reading root certificate")
-	errParsingRootCert = errors.New("error parsing root certificate")
-)
-
 // Type should match the package name
 const Type = "tcp"
 
@@ -44,9 +39,19 @@ type Checker struct {
 	TLSCAFile string `json:"tls_ca_file,omitempty"`
 
 	// Timeout is the maximum time to wait for a
-	// TCP connection to be established.
+	// TCP connection (and TLS handshake, if enabled)
+	// to be established. Default is 1s.
 	Timeout types.Duration `json:"timeout,omitempty"`
 
+	// Steps are a conversation with the endpoint once
+	// connected, e.g. to check the banner of a service.
+	// The endpoint is down if one of them fails.
+	Steps []Step `json:"steps,omitempty"`
+
+	// ReadTimeout is the maximum time every step may
+	// take. Default is DefaultReadTimeout.
+	ReadTimeout types.Duration `json:"read_timeout,omitempty"`
+
 	// ThresholdRTT is the maximum round trip time to
 	// allow for a healthy endpoint. If non-zero and a
 	// request takes longer than ThresholdRTT, the
@@ -71,6 +76,12 @@ func (c *Checker) Type() string {
 	return Type
 }
 
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
 // New creates a new Checker instance based on json config
 func New(config json.RawMessage) (*Checker, error) {
 	var checker Checker
@@ -84,9 +95,50 @@ func (c *Checker) GetEvery() time.Duration {
 	return c.Every.Duration
 }
 
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	} else if _, _, err := net.SplitHostPort(c.URL); err != nil {
+		errs = append(errs, types.NewValidationError("endpoint_url", "%v", err))
+	}
+	startTLS := false
+	for i, step := range c.Steps {
+		path := fmt.Sprintf("steps[%d]", i)
+		errs = append(errs, types.PrefixPath(path, step.validate())...)
+		if !step.StartTLS {
+			continue
+		}
+		if c.TLSEnabled {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, "starttls"), "cannot be combined with tls"))
+		} else if startTLS {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, "starttls"), "the connection is already upgraded"))
+		}
+		startTLS = true
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":         c.Every.Duration,
+		"timeout":       c.Timeout.Duration,
+		"read_timeout":  c.ReadTimeout.Duration,
+		"threshold_rtt": c.ThresholdRTT.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
 // Check performs checks using c according to its configuration.
 // An error is only returned if there is a configuration error.
-func (c *Checker) Check() (types.Result, error) {
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
 	if c.Attempts < 1 {
 		c.Attempts = 1
 	}
@@ -95,55 +147,37 @@ func (c *Checker) Check() (types.Result, error) {
 	result.Type = c.Type()
 	result.Title = c.Name
 	result.Endpoint = c.URL
-	result.Times = c.doChecks()
+
+	steps, err := c.compile()
+	if err != nil {
+		return result, err
+	}
+	result.Times = c.doChecks(ctx, steps)
 
 	return c.conclude(result), nil
 }
 
-// doChecks executes and returns each attempt.
-func (c *Checker) doChecks() types.Attempts {
-	var err error
-	var conn net.Conn
-
+// doChecks executes and returns each attempt, conversing
+// with the endpoint according to steps once connected.
+func (c *Checker) doChecks(ctx context.Context, steps []*compiledStep) types.Attempts {
 	timeout := c.Timeout.Duration
 	if timeout == 0 {
 		timeout = time.Second
 	}
-
-	dialer := func() (net.Conn, error) {
-		return net.DialTimeout("tcp", c.URL, timeout)
-	}
-	if c.TLSEnabled {
-		dialer = func() (net.Conn, error) {
-			// Dialer with timeout
-			dialer := &net.Dialer{
-				Timeout: timeout,
-			}
-
-			// TLS config based on configuration
-			var tlsConfig tls.Config
-			tlsConfig.InsecureSkipVerify = c.TLSSkipVerify
-			if c.TLSCAFile != "" {
-				rootPEM, err := ioutil.ReadFile(c.TLSCAFile)
-				if err != nil || rootPEM == nil {
-					return nil, errReadingRootCert
-				}
-				pool := x509.NewCertPool()
-				ok := pool.AppendCertsFromPEM(rootPEM)
-				if !ok {
-					return nil, errParsingRootCert
-				}
-				tlsConfig.RootCAs = pool
-			}
-			return tls.DialWithDialer(dialer, "tcp", c.URL, &tlsConfig)
-		}
+	readTimeout := c.ReadTimeout.Duration
+	if readTimeout <= 0 {
+		readTimeout = DefaultReadTimeout
 	}
 
 	checks := make(types.Attempts, c.Attempts)
 	for i := 0; i < c.Attempts; i++ {
 		start := time.Now()
 
-		if conn, err = dialer(); err == nil {
+		conn, err := c.dial(ctx, timeout)
+		if err == nil {
+			if len(steps) > 0 {
+				conn, err = c.converse(ctx, conn, steps, readTimeout, &checks[i])
+			}
 			conn.Close()
 		}
 
@@ -156,6 +190,54 @@ func (c *Checker) doChecks() types.Attempts {
 	return checks
 }
 
+// dial connects to c.URL, performing a TLS handshake if
+// enabled. Both must complete before timeout or ctx is done.
+func (c *Checker) dial(ctx context.Context, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.URL)
+	if err != nil || !c.TLSEnabled {
+		return conn, err
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// tlsConfig returns the TLS config based on configuration.
+func (c *Checker) tlsConfig() (*tls.Config, error) {
+	var tlsConfig tls.Config
+	tlsConfig.InsecureSkipVerify = c.TLSSkipVerify
+	if host, _, err := net.SplitHostPort(c.URL); err == nil {
+		tlsConfig.ServerName = host
+	}
+	if c.TLSCAFile != "" {
+		pool, err := checkutil.LoadCAFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &tlsConfig, nil
+}
+
 // conclude takes the data in result from the attempts and
 // computes remaining values needed to fill out the result.
 // It detects degraded (high-latency) responses and makes
@@ -167,31 +249,10 @@ func (c *Checker) conclude(result types.Result) types.Result {
 	for i := range result.Times {
 		if result.Times[i].Error != "" {
 			result.Down = true
-			m, _ := metric.New(
-				"checkup_tcp",
-				map[string]string{
-					"title":    result.Title,
-					"endpoint": result.Endpoint,
-				}, map[string]interface{}{
-					"healthy": 0,
-				}, time.Now(), metric.Gauge,
-			)
-			c.metrics = append(c.metrics, m)
 			return result
 		}
 	}
 
-	m, _ := metric.New(
-		"checkup_tcp",
-		map[string]string{
-			"title":    result.Title,
-			"endpoint": result.Endpoint,
-		}, map[string]interface{}{
-			"healthy": 1,
-		}, time.Now(), metric.Gauge,
-	)
-	c.metrics = append(c.metrics, m)
-
 	// Check round trip time (degraded)
 	if c.ThresholdRTT.Duration > 0 {
 		stats := result.ComputeStats()
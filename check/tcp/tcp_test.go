@@ -0,0 +1,167 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSMTP serves a greeting and replies to EHLO, STARTTLS and
+// PING commands on ln, which it closes once t is done.
+func serveSMTP(t *testing.T, ln net.Listener) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.TrimSpace(line); cmd {
+			case "EHLO checkup":
+				_, secure := conn.(*tls.Conn)
+				if secure {
+					conn.Write([]byte("250-localhost\r\n250 AUTH PLAIN\r\n"))
+				} else {
+					conn.Write([]byte("250-localhost\r\n250 STARTTLS\r\n"))
+				}
+			case "STARTTLS":
+				conn.Write([]byte("220 ready\r\n"))
+				conn = tls.Server(conn, config)
+				r = bufio.NewReader(conn)
+			case "PING":
+				conn.Write([]byte{'+', 'P', 'O', 'N', 'G', 0, '\r', '\n'})
+			case "HANG":
+			default:
+				conn.Write([]byte("500 unknown command\r\n"))
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+}
+
+func TestCheckerSteps(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer ln.Close()
+	serveSMTP(t, ln)
+
+	smtp := []Step{
+		{Expect: "220 "},
+		{Send: "EHLO checkup\r\n", ExpectRegex: `250[- ]STARTTLS`},
+		{Send: "STARTTLS\r\n", Expect: "220 ready\r\n", StartTLS: true},
+		{Name: "ehlo", Send: "RUhMTyBjaGVja3VwDQo=", Encoding: "base64", ExpectRegex: `(?m)^250 AUTH`},
+	}
+	for i, test := range []struct {
+		steps []Step
+		err   string
+		names []string
+	}{
+		{
+			steps: smtp,
+			names: []string{`expect "220 "`, `send "EHLO checkup\r\n", expect /250[- ]STARTTLS/`, `send "STARTTLS\r\n", expect "220 ready\r\n", starttls`, "ehlo"},
+		},
+		{
+			steps: []Step{{Expect: "220"}, {Send: "50 49 4e 47 0d 0a", Encoding: "hex", Expect: "+PONG\x00"}},
+			names: []string{`expect "220"`, `send "50 49 4e 47 0d 0a"`},
+		},
+		{
+			steps: []Step{{Expect: "220"}, {Send: "NOOP\r\n", Expect: "250"}},
+			err:   `step 2 (send "NOOP\r\n", expect "250"): expected "250", got " localhost ESMTP\r\n500 unknown command\r\n": `,
+		},
+		{
+			steps: []Step{{Send: "HANG\r\n", ExpectRegex: "^\\+"}},
+			err:   `step 1 (send "HANG\r\n", expect /^\+/): expected a match of /^\+/, got "220 localhost ESMTP\r\n": `,
+		},
+	} {
+		hc := Checker{Name: "Test", URL: ln.Addr().String(), Steps: test.steps, TLSSkipVerify: true}
+		hc.ReadTimeout.Duration = 200 * time.Millisecond
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if test.err != "" {
+			if got := result.Times[0].Error; !result.Down || !strings.HasPrefix(got, test.err) {
+				t.Errorf("Test %d: Expected down with error '%s...', got '%s'", i, test.err, got)
+			}
+			continue
+		}
+		if got, want := result.Healthy, true; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+		for j, name := range test.names {
+			if j >= len(result.Times[0].Steps) {
+				t.Errorf("Test %d: Expected step %s", i, name)
+				continue
+			}
+			if got := result.Times[0].Steps[j].Name; got != name && !strings.HasPrefix(got, name) {
+				t.Errorf("Test %d: Expected step %s, got %s", i, name, got)
+			}
+		}
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	hc := Checker{
+		Name:       "Test",
+		URL:        "localhost:25",
+		TLSEnabled: true,
+		Steps: []Step{
+			{},
+			{Send: "zz", Encoding: "hex", Expect: "a", ExpectRegex: "("},
+			{Send: "x", Encoding: "rot13", StartTLS: true},
+		},
+	}
+	want := []string{
+		"steps[0]: one of send, expect, expect_regex and starttls must be set",
+		"steps[1].send: encoding/hex: invalid byte: U+007A 'z'",
+		"steps[1].expect_regex: cannot be combined with expect",
+		"steps[1].expect_regex: error parsing regexp: missing closing ): `(`",
+		`steps[2].send: unknown encoding "rot13", expected text, hex or base64`,
+		"steps[2].starttls: cannot be combined with tls",
+	}
+	if got := strings.Split(hc.Validate().Error(), "; "); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,434 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/check/internal/checkutil"
+	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
+	"github.com/feifeigood/checkup/prometheus/metric"
+	"github.com/feifeigood/checkup/types"
+)
+
+// Type should match the package name
+const Type = "tls"
+
+// Default expiry thresholds, in days.
+const (
+	DefaultWarningDays  = 30
+	DefaultCriticalDays = 7
+)
+
+// Checker implements a Checker for TLS certificates.
+type Checker struct {
+	// Name is the name of the endpoint.
+	Name string `json:"endpoint_name"`
+
+	// URL is the host:port of the endpoint. If no
+	// port is given, 443 is used.
+	URL string `json:"endpoint_url"`
+
+	// ServerName is the name sent in the SNI extension and
+	// verified against the certificate. Default is the
+	// host of URL.
+	ServerName string `json:"tls_server_name,omitempty"`
+
+	// TLSCAFile is a PEM bundle of Certificate Authorities
+	// used to verify the certificate chain. Default is the
+	// system roots.
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+
+	// TLSSkipVerify skips chain and hostname verification,
+	// only expiry is checked.
+	TLSSkipVerify bool `json:"tls_skip_verify,omitempty"`
+
+	// WarningDays marks the endpoint degraded when any
+	// certificate expires within this many days. Default
+	// is DefaultWarningDays, a negative value disables it.
+	WarningDays int `json:"warning_days,omitempty"`
+
+	// CriticalDays marks the endpoint down when any
+	// certificate expires within this many days. Default
+	// is DefaultCriticalDays, a negative value disables it.
+	// It must not exceed WarningDays.
+	CriticalDays int `json:"critical_days,omitempty"`
+
+	// RequireOCSPStapling marks the endpoint down if the
+	// server does not staple a good OCSP response.
+	RequireOCSPStapling bool `json:"require_ocsp_stapling,omitempty"`
+
+	// Timeout is the maximum time to wait for the
+	// TLS handshake to complete. Default is 5s.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
+	// ThresholdRTT is the maximum round trip time to
+	// allow for a healthy endpoint. If non-zero and a
+	// request takes longer than ThresholdRTT, the
+	// endpoint will be considered unhealthy. Note that
+	// this duration includes any in-between network
+	// latency.
+	ThresholdRTT types.Duration `json:"threshold_rtt,omitempty"`
+
+	// Attempts is how many requests the client will
+	// make to the endpoint in a single check.
+	Attempts int `json:"attempts,omitempty"`
+
+	// Every override every subcommand interval If set.
+	Every types.Duration `json:"every,omitempty"`
+
+	//
+	metrics []metric.Metric
+	state   *connState
+}
+
+// connState is what was learned about the
+// endpoint during the last successful handshake.
+type connState struct {
+	version string
+	ocsp    string
+	certs   []*x509.Certificate
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
+// New creates a new Checker instance based on json config
+func New(config json.RawMessage) (*Checker, error) {
+	var checker Checker
+	err := json.Unmarshal(config, &checker)
+	return &checker, err
+}
+
+// Type returns the checker package name
+func (c *Checker) Type() string {
+	return Type
+}
+
+// GetEvery returns the checker specified check interval to override every subcommand
+func (c *Checker) GetEvery() time.Duration {
+	return c.Every.Duration
+}
+
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	}
+	warning := expiryDays(c.WarningDays, DefaultWarningDays)
+	critical := expiryDays(c.CriticalDays, DefaultCriticalDays)
+	if warning >= 0 && critical > warning {
+		errs = append(errs, types.NewValidationError("critical_days", "must not exceed warning_days (%d)", warning))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":         c.Every.Duration,
+		"timeout":       c.Timeout.Duration,
+		"threshold_rtt": c.ThresholdRTT.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
+// Check performs checks using c according to its configuration.
+// An error is only returned if there is a configuration error.
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
+	if c.Attempts < 1 {
+		c.Attempts = 1
+	}
+	c.WarningDays = expiryDays(c.WarningDays, DefaultWarningDays)
+	c.CriticalDays = expiryDays(c.CriticalDays, DefaultCriticalDays)
+
+	result := types.NewResult()
+	result.Type = c.Type()
+	result.Title = c.Name
+	result.Endpoint = c.URL
+
+	roots, err := c.roots()
+	if err != nil {
+		return result, err
+	}
+
+	result.Times = c.doChecks(ctx, roots)
+
+	return c.conclude(result), nil
+}
+
+// expiryDays returns the threshold days, def if it is zero.
+// Negative thresholds are disabled.
+func expiryDays(days, def int) int {
+	if days == 0 {
+		return def
+	}
+	return days
+}
+
+// address returns c.URL with port 443 added if it has none.
+func (c *Checker) address() string {
+	if _, _, err := net.SplitHostPort(c.URL); err == nil {
+		return c.URL
+	}
+	return net.JoinHostPort(strings.Trim(c.URL, "[]"), "443")
+}
+
+// serverName returns the name to verify the certificate against.
+func (c *Checker) serverName() string {
+	if c.ServerName != "" {
+		return c.ServerName
+	}
+	host, _, _ := net.SplitHostPort(c.address())
+	return host
+}
+
+// roots returns the configured root pool, nil means
+// the system roots.
+func (c *Checker) roots() (*x509.CertPool, error) {
+	if c.TLSCAFile == "" {
+		return nil, nil
+	}
+	return checkutil.LoadCAFile(c.TLSCAFile)
+}
+
+// doChecks executes and returns each attempt.
+func (c *Checker) doChecks(ctx context.Context, roots *x509.CertPool) types.Attempts {
+	timeout := c.Timeout.Duration
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	checks := make(types.Attempts, c.Attempts)
+	for i := 0; i < c.Attempts; i++ {
+		start := time.Now()
+		state, err := c.handshake(ctx, timeout)
+		checks[i].RTT = time.Since(start)
+		if err != nil {
+			checks[i].Error = err.Error()
+			continue
+		}
+		c.state = state
+
+		if err := c.checkDown(state, roots); err != nil {
+			checks[i].Error = err.Error()
+		}
+	}
+	return checks
+}
+
+// handshake connects to the endpoint and returns what was
+// learned from the TLS handshake. Verification is done by
+// checkDown so that expiry is reported for untrusted chains.
+func (c *Checker) handshake(ctx context.Context, timeout time.Duration) (*connState, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.address())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         c.serverName(),
+		InsecureSkipVerify: true,
+	})
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	cs := tlsConn.ConnectionState()
+	if len(cs.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("no certificates presented")
+	}
+
+	state := &connState{
+		version: checkutil.VersionNames[cs.Version],
+		certs:   cs.PeerCertificates,
+		ocsp:    "not stapled",
+	}
+	if state.version == "" {
+		state.version = fmt.Sprintf("0x%04x", cs.Version)
+	}
+	if len(cs.OCSPResponse) > 0 {
+		state.ocsp = ocspStatus(cs.OCSPResponse, cs.PeerCertificates)
+	}
+
+	return state, nil
+}
+
+// ocspStatus parses a stapled OCSP response for the leaf.
+func ocspStatus(raw []byte, certs []*x509.Certificate) string {
+	var issuer *x509.Certificate
+	if len(certs) > 1 {
+		issuer = certs[1]
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, certs[0], issuer)
+	if err != nil {
+		return "invalid"
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unknown"
+}
+
+// checkDown checks whether the endpoint is down based on state and
+// the configuration of c. It returns a non-nil error if down.
+// Note that it does not check for degraded response.
+func (c *Checker) checkDown(state *connState, roots *x509.CertPool) error {
+	leaf := state.certs[0]
+
+	if !c.TLSSkipVerify {
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return fmt.Errorf("verifying certificate chain: %w", err)
+		}
+		if err := leaf.VerifyHostname(c.serverName()); err != nil {
+			return err
+		}
+	}
+
+	switch state.ocsp {
+	case "revoked":
+		return fmt.Errorf("certificate '%s' is revoked (stapled OCSP response)", leaf.Subject.CommonName)
+	case "good":
+	default:
+		if c.RequireOCSPStapling {
+			return fmt.Errorf("OCSP stapling required, got %s", state.ocsp)
+		}
+	}
+
+	cert, days := expiresFirst(state.certs)
+	if days < 0 {
+		return fmt.Errorf("certificate '%s' expired on %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if c.CriticalDays > 0 && days < c.CriticalDays {
+		return fmt.Errorf("certificate '%s' expires in %d days (critical threshold %d days)", cert.Subject.CommonName, days, c.CriticalDays)
+	}
+
+	return nil
+}
+
+// expiresFirst returns the certificate that expires first
+// and the number of whole days until it does.
+func expiresFirst(certs []*x509.Certificate) (*x509.Certificate, int) {
+	first := certs[0]
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(first.NotAfter) {
+			first = cert
+		}
+	}
+	return first, daysLeft(first)
+}
+
+func daysLeft(cert *x509.Certificate) int {
+	return int(math.Floor(time.Until(cert.NotAfter).Hours() / 24))
+}
+
+// conclude takes the data in result from the attempts and
+// computes remaining values needed to fill out the result.
+// It detects degraded (high-latency or soon expiring)
+// responses and makes the conclusion about the result's status.
+func (c *Checker) conclude(result types.Result) types.Result {
+	result.ThresholdRTT = c.ThresholdRTT.Duration
+
+	state := c.state
+	c.state = nil
+	if state != nil {
+		leaf := state.certs[0]
+		_, days := expiresFirst(state.certs)
+		result.Message = fmt.Sprintf("%s, OCSP %s, certificate '%s' expires in %d days", state.version, state.ocsp, leaf.Subject.CommonName, days)
+
+		for i, cert := range state.certs {
+			position := "intermediate"
+			if i == 0 {
+				position = "leaf"
+			}
+			m, _ := metric.New(
+				"checkup_tls",
+				map[string]string{
+					"title":    result.Title,
+					"endpoint": result.Endpoint,
+					"position": position,
+					"subject":  cert.Subject.CommonName,
+					"serial":   cert.SerialNumber.String(),
+				}, map[string]interface{}{
+					"cert_not_after_seconds": cert.NotAfter.Unix(),
+				}, time.Now(), metric.Gauge,
+			)
+			c.metrics = append(c.metrics, m)
+		}
+	}
+
+	// Check errors (down)
+	for i := range result.Times {
+		if result.Times[i].Error != "" {
+			result.Down = true
+			return result
+		}
+	}
+
+	// Check certificate expiry (degraded)
+	if state != nil {
+		cert, days := expiresFirst(state.certs)
+		if c.WarningDays > 0 && days < c.WarningDays {
+			result.Notice = fmt.Sprintf("certificate '%s' expires in %d days (warning threshold %d days)", cert.Subject.CommonName, days, c.WarningDays)
+			result.Degraded = true
+			return result
+		}
+	}
+
+	// Check round trip time (degraded)
+	if c.ThresholdRTT.Duration > 0 {
+		stats := result.ComputeStats()
+		if stats.Median > c.ThresholdRTT.Duration {
+			result.Notice = fmt.Sprintf("median round trip time exceeded threshold (%s)", c.ThresholdRTT)
+			result.Degraded = true
+			return result
+		}
+	}
+
+	result.Healthy = true
+	return result
+}
+
+func (c *Checker) Collect(collector checkup_prometheus_client.Collector) {
+	if c.metrics != nil && len(c.metrics) > 0 {
+		collector.Add(c.metrics)
+	}
+	c.metrics = []metric.Metric{}
+}
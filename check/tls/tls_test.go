@@ -0,0 +1,336 @@
+package tls
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Cannot generate key: %v", err)
+	}
+	return key
+}
+
+// issue creates a certificate from template signed by ca,
+// or self-signed if ca is nil.
+func issue(t *testing.T, template *x509.Certificate, key *ecdsa.PrivateKey, ca *testCA) *x509.Certificate {
+	parent, signer := template, crypto.Signer(key)
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Cannot parse certificate: %v", err)
+	}
+	return cert
+}
+
+// testPKI is a root, an intermediate and a leaf for 127.0.0.1
+// and checkup.test expiring after leafValidity.
+type testPKI struct {
+	root         *testCA
+	intermediate *testCA
+	leaf         tls.Certificate
+}
+
+func newTestPKI(t *testing.T, leafValidity time.Duration) *testPKI {
+	rootKey := newKey(t)
+	root := &testCA{key: rootKey, cert: issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Checkup Test Root"},
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, rootKey, nil)}
+
+	interKey := newKey(t)
+	inter := &testCA{key: interKey, cert: issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Checkup Test Intermediate"},
+		NotAfter:              time.Now().Add(5 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, interKey, root)}
+
+	leafKey := newKey(t)
+	leaf := issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "checkup.test"},
+		DNSNames:     []string{"checkup.test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotAfter:     time.Now().Add(leafValidity),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, leafKey, inter)
+
+	return &testPKI{
+		root:         root,
+		intermediate: inter,
+		leaf: tls.Certificate{
+			Certificate: [][]byte{leaf.Raw, inter.cert.Raw},
+			PrivateKey:  leafKey,
+			Leaf:        leaf,
+		},
+	}
+}
+
+// writeRoot writes the root certificate to a PEM file in dir.
+func (p *testPKI) writeRoot(t *testing.T, dir string) string {
+	name := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.root.cert.Raw})
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatalf("Cannot write CA file: %v", err)
+	}
+	return name
+}
+
+// staple attaches an OCSP response with status to the leaf.
+func (p *testPKI) staple(t *testing.T, status int) {
+	raw, err := ocsp.CreateResponse(p.intermediate.cert, p.intermediate.cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: p.leaf.Leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Hour),
+	}, p.intermediate.key)
+	if err != nil {
+		t.Fatalf("Cannot create OCSP response: %v", err)
+	}
+	p.leaf.OCSPStaple = raw
+}
+
+// serve starts a TLS server presenting the leaf of p.
+func (p *testPKI) serve(t *testing.T) (string, func()) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{p.leaf}})
+	if err != nil {
+		t.Fatalf("Couldn't start TLS test server with error: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestChecker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkup")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pki := newTestPKI(t, 90*24*time.Hour)
+	endpt, stop := pki.serve(t)
+	caFile := pki.writeRoot(t, dir)
+
+	hc := Checker{Name: "Test", URL: endpt, TLSCAFile: caFile, Attempts: 2}
+
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Type, Type; got != want {
+		t.Errorf("Expected result.Type='%s', got '%s'", want, got)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+	if got, want := len(result.Times), hc.Attempts; got != want {
+		t.Errorf("Expected %d attempts, got %d", want, got)
+	}
+	if !strings.Contains(result.Message, "OCSP not stapled") || !strings.Contains(result.Message, "expires in 89 days") {
+		t.Errorf("Expected message to report OCSP and expiry, got '%s'", result.Message)
+	}
+	if got, want := len(hc.metrics), 2; got != want {
+		t.Errorf("Expected %d metrics, got %d", want, got)
+	}
+
+	// Warning threshold
+	hc.WarningDays = 100
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Degraded, true; got != want {
+		t.Errorf("Expected result.Degraded=%v, got %v", want, got)
+	}
+
+	// Critical threshold
+	hc.CriticalDays = 100
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	hc.WarningDays, hc.CriticalDays = 0, 0
+
+	// Hostname does not match
+	hc.ServerName = "other.test"
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+
+	// Hostname matches a SAN
+	hc.ServerName = "checkup.test"
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+
+	// Untrusted chain
+	hc.TLSCAFile = ""
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+
+	hc.TLSSkipVerify = true
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+
+	// Require stapling
+	hc.RequireOCSPStapling = true
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+
+	// Server is not online
+	stop()
+	result, _ = hc.Check(context.Background())
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+}
+
+func TestCheckerExpired(t *testing.T) {
+	pki := newTestPKI(t, -time.Hour)
+	endpt, stop := pki.serve(t)
+	defer stop()
+
+	hc := Checker{Name: "Test", URL: endpt, TLSSkipVerify: true}
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if !strings.Contains(result.Times[0].Error, "expired") {
+		t.Errorf("Expected expiry error, got '%s'", result.Times[0].Error)
+	}
+}
+
+func TestCheckerThresholds(t *testing.T) {
+	pki := newTestPKI(t, 3*24*time.Hour)
+	endpt, stop := pki.serve(t)
+	defer stop()
+
+	for i, test := range []struct {
+		warningDays, criticalDays int
+		healthy, degraded         bool
+	}{
+		{0, 0, false, false},
+		{0, -1, false, true},
+		{-1, -1, true, false},
+	} {
+		hc := Checker{Name: "Test", URL: endpt, TLSSkipVerify: true, WarningDays: test.warningDays, CriticalDays: test.criticalDays}
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if result.Healthy != test.healthy || result.Degraded != test.degraded {
+			t.Errorf("Test %d: Expected result.Healthy=%v and result.Degraded=%v, got %v and %v (%v)", i, test.healthy, test.degraded, result.Healthy, result.Degraded, result.Times)
+		}
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	for i, test := range []struct {
+		hc  Checker
+		err string
+	}{
+		{Checker{Name: "Test", URL: "localhost", WarningDays: 7, CriticalDays: 14}, "critical_days: must not exceed warning_days (7)"},
+		{Checker{Name: "Test", URL: "localhost", WarningDays: 5}, "critical_days: must not exceed warning_days (5)"},
+		{Checker{Name: "Test", URL: "localhost", WarningDays: -1, CriticalDays: 14}, ""},
+		{Checker{Name: "Test", URL: "localhost", WarningDays: 14, CriticalDays: 14}, ""},
+	} {
+		err := test.hc.Validate()
+		if got := fmt.Sprint(err); test.err != "" && got != test.err || test.err == "" && err != nil {
+			t.Errorf("Test %d: Expected error '%s', got '%v'", i, test.err, err)
+		}
+	}
+}
+
+func TestCheckerRootsMissing(t *testing.T) {
+	hc := Checker{Name: "Test", URL: "localhost", TLSCAFile: filepath.Join(os.TempDir(), "checkup-missing-ca.pem")}
+	if _, err := hc.Check(context.Background()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a not exist error reading tls_ca_file, got %v", err)
+	}
+}
+
+func TestCheckerOCSPStapling(t *testing.T) {
+	for _, test := range []struct {
+		status  int
+		healthy bool
+	}{
+		{ocsp.Good, true},
+		{ocsp.Revoked, false},
+	} {
+		pki := newTestPKI(t, 90*24*time.Hour)
+		pki.staple(t, test.status)
+		endpt, stop := pki.serve(t)
+
+		hc := Checker{Name: "Test", URL: endpt, TLSSkipVerify: true, RequireOCSPStapling: true}
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Didn't expect an error: %v", err)
+		}
+		if got, want := result.Healthy, test.healthy; got != want {
+			t.Errorf("OCSP status %d: Expected result.Healthy=%v, got %v (%v)", test.status, want, got, result.Times)
+		}
+		stop()
+	}
+}
@@ -0,0 +1,298 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/check/internal/checkutil"
+	"github.com/feifeigood/checkup/types"
+)
+
+// Type should match the package name
+const Type = "udp"
+
+// DefaultTimeout is how long a reply is waited for
+// when no Timeout is configured.
+const DefaultTimeout = 2 * time.Second
+
+// maxReplyBytes is the size of the largest UDP datagram.
+const maxReplyBytes = 64 << 10
+
+// Checker implements a Checker for UDP endpoints.
+type Checker struct {
+	// Name is the name of the endpoint.
+	Name string `json:"endpoint_name"`
+
+	// URL is the host:port of the endpoint.
+	URL string `json:"endpoint_url"`
+
+	// Send is the payload sent to the endpoint, encoded
+	// with Encoding.
+	Send string `json:"send"`
+
+	// Expect is what the reply must contain, encoded
+	// with Encoding.
+	Expect string `json:"expect,omitempty"`
+
+	// ExpectRegex is a regular expression which the
+	// reply must match.
+	ExpectRegex string `json:"expect_regex,omitempty"`
+
+	// Encoding is the encoding of Send and Expect, one
+	// of text (default), hex and base64.
+	Encoding string `json:"encoding,omitempty"`
+
+	// NoReply is set for endpoints which do not reply,
+	// e.g. syslog collectors. They are up unless an ICMP
+	// port unreachable is received within Timeout, which
+	// every attempt waits for, so ThresholdRTT cannot be set.
+	NoReply bool `json:"no_reply,omitempty"`
+
+	// Timeout is the maximum time to wait for a reply.
+	// Default is DefaultTimeout.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
+	// ThresholdRTT is the maximum round trip time to
+	// allow for a healthy endpoint. If non-zero and a
+	// request takes longer than ThresholdRTT, the
+	// endpoint will be considered unhealthy. Note that
+	// this duration includes any in-between network
+	// latency.
+	ThresholdRTT types.Duration `json:"threshold_rtt,omitempty"`
+
+	// Attempts is how many times a request is sent in a
+	// single check until one succeeds, as datagrams may
+	// be lost. The endpoint is down if all of them fail.
+	Attempts int `json:"attempts,omitempty"`
+
+	// Every override every subcommand interval If set.
+	Every types.Duration `json:"every,omitempty"`
+}
+
+// Type returns the checker package name
+func (c *Checker) Type() string {
+	return Type
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
+// New creates a new Checker instance based on json config
+func New(config json.RawMessage) (*Checker, error) {
+	var checker Checker
+	err := json.Unmarshal(config, &checker)
+	return &checker, err
+}
+
+// GetEvery returns the checker specified check interval to override every subcommand
+func (c *Checker) GetEvery() time.Duration {
+	return c.Every.Duration
+}
+
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	} else if _, _, err := net.SplitHostPort(c.URL); err != nil {
+		errs = append(errs, types.NewValidationError("endpoint_url", "%v", err))
+	}
+	if send, err := checkutil.Decode(c.Send, c.Encoding); err != nil {
+		errs = append(errs, types.NewValidationError("send", "%v", err))
+	} else if len(send) == 0 {
+		errs = append(errs, types.NewValidationError("send", "must not be empty"))
+	}
+	if _, err := checkutil.Decode(c.Expect, c.Encoding); err != nil && c.Expect != "" {
+		errs = append(errs, types.NewValidationError("expect", "%v", err))
+	}
+	if _, err := regexp.Compile(c.ExpectRegex); err != nil {
+		errs = append(errs, types.NewValidationError("expect_regex", "%v", err))
+	}
+	if c.Expect != "" && c.ExpectRegex != "" {
+		errs = append(errs, types.NewValidationError("expect_regex", "cannot be combined with expect"))
+	}
+	if c.NoReply && (c.Expect != "" || c.ExpectRegex != "") {
+		errs = append(errs, types.NewValidationError("no_reply", "cannot be combined with expect or expect_regex"))
+	}
+	if c.NoReply && c.ThresholdRTT.Duration != 0 {
+		// Without a reply, every attempt waits the whole Timeout
+		errs = append(errs, types.NewValidationError("no_reply", "cannot be combined with threshold_rtt"))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":         c.Every.Duration,
+		"timeout":       c.Timeout.Duration,
+		"threshold_rtt": c.ThresholdRTT.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
+// Check performs checks using c according to its configuration.
+// An error is only returned if there is a configuration error.
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
+	if c.Attempts < 1 {
+		c.Attempts = 1
+	}
+
+	result := types.NewResult()
+	result.Type = c.Type()
+	result.Title = c.Name
+	result.Endpoint = c.URL
+
+	send, err := checkutil.Decode(c.Send, c.Encoding)
+	if err != nil {
+		return result, fmt.Errorf("send: %w", err)
+	}
+	expect, err := checkutil.Decode(c.Expect, c.Encoding)
+	if err != nil {
+		return result, fmt.Errorf("expect: %w", err)
+	}
+	var re *regexp.Regexp
+	if c.ExpectRegex != "" {
+		if re, err = regexp.Compile(c.ExpectRegex); err != nil {
+			return result, fmt.Errorf("expect_regex: %w", err)
+		}
+	}
+	result.Times = c.doChecks(ctx, send, expect, re)
+
+	return c.conclude(result), nil
+}
+
+// doChecks executes attempts until one succeeds, at most
+// Attempts, and returns them.
+func (c *Checker) doChecks(ctx context.Context, send, expect []byte, re *regexp.Regexp) types.Attempts {
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var checks types.Attempts
+	for i := 0; i < c.Attempts && ctx.Err() == nil; i++ {
+		var attempt types.Attempt
+		start := time.Now()
+
+		reply, err := c.exchange(ctx, send, timeout)
+		if err == nil {
+			err = checkReply(reply, expect, re)
+		}
+
+		attempt.RTT = time.Since(start)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		checks = append(checks, attempt)
+		if err == nil {
+			break
+		}
+	}
+	return checks
+}
+
+// exchange sends payload to c.URL and returns the reply, or
+// nil with NoReply. It waits for the reply until timeout
+// elapses or ctx is done.
+func (c *Checker) exchange(ctx context.Context, payload []byte, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", c.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Unblock the read when ctx is done
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now())
+	}()
+
+	if _, err := conn.Write(payload); err != nil {
+		return nil, portUnreachable(err)
+	}
+
+	reply := make([]byte, maxReplyBytes)
+	n, err := conn.Read(reply)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		if c.NoReply {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("no reply within %s", timeout)
+	}
+	if err != nil {
+		return nil, portUnreachable(err)
+	}
+	return reply[:n], nil
+}
+
+// portUnreachable explains the errors caused by an ICMP
+// port unreachable reply.
+func portUnreachable(err error) error {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("port unreachable: %w", err)
+	}
+	return err
+}
+
+// checkReply checks reply contains expect and matches re,
+// if they are set.
+func checkReply(reply, expect []byte, re *regexp.Regexp) error {
+	if len(expect) > 0 && !bytes.Contains(reply, expect) {
+		return fmt.Errorf("reply %s does not contain %q", checkutil.Snippet(reply), expect)
+	}
+	if re != nil && !re.Match(reply) {
+		return fmt.Errorf("reply %s does not match /%s/", checkutil.Snippet(reply), re)
+	}
+	return nil
+}
+
+// conclude takes the data in result from the attempts and
+// computes remaining values needed to fill out the result.
+// It detects degraded (high-latency) responses and makes
+// the conclusion about the result's status. Only the last
+// attempt may have succeeded.
+func (c *Checker) conclude(result types.Result) types.Result {
+	result.ThresholdRTT = c.ThresholdRTT.Duration
+
+	// Check errors (down)
+	if len(result.Times) == 0 {
+		result.Down = true
+		return result
+	}
+	last := result.Times[len(result.Times)-1]
+	if last.Error != "" {
+		result.Down = true
+		return result
+	}
+
+	// Check round trip time of the reply (degraded)
+	if c.ThresholdRTT.Duration > 0 && last.RTT > c.ThresholdRTT.Duration {
+		result.Notice = fmt.Sprintf("round trip time exceeded threshold (%s)", c.ThresholdRTT)
+		result.Degraded = true
+		return result
+	}
+
+	result.Healthy = true
+	return result
+}
@@ -0,0 +1,147 @@
+package udp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+func TestChecker(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// Reply to pings, ignore everything else
+			if bytes.HasPrefix(buf[:n], []byte{0xfe, 0xfd}) {
+				conn.WriteTo(append([]byte("PONG "), buf[2:n]...), addr)
+			}
+		}
+	}()
+
+	// A port nobody listens on
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	closedAddr := closed.LocalAddr().String()
+	closed.Close()
+
+	for i, test := range []struct {
+		hc  Checker
+		err string
+	}{
+		{hc: Checker{Send: "fefd 0102", Encoding: "hex", Expect: "504f4e47"}},
+		{hc: Checker{Send: "/v0BAg==", Encoding: "base64", ExpectRegex: "^PONG \x01\x02$"}},
+		{hc: Checker{Send: "hello", NoReply: true}},
+		{hc: Checker{Send: "fefd 0102", Encoding: "hex", Expect: "ff"}, err: `reply "PONG \x01\x02" does not contain "\xff"`},
+		{hc: Checker{Send: "hello"}, err: "no reply within 200ms"},
+		{hc: Checker{URL: closedAddr, Send: "hello"}, err: "port unreachable: "},
+		{hc: Checker{URL: closedAddr, Send: "hello", NoReply: true}, err: "port unreachable: "},
+	} {
+		hc := test.hc
+		hc.Name, hc.Attempts = "Test", 2
+		if hc.URL == "" {
+			hc.URL = conn.LocalAddr().String()
+		}
+		hc.Timeout.Duration = 200 * time.Millisecond
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		// Attempts stop at the first success
+		want := 2
+		if test.err == "" {
+			want = 1
+		}
+		if got := len(result.Times); got != want {
+			t.Errorf("Test %d: Expected %d attempts, got %d", i, want, got)
+		}
+		if test.err == "" {
+			if got, want := result.Healthy, true; got != want {
+				t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+			}
+			continue
+		}
+		if got := result.Times[0].Error; !result.Down || !strings.HasPrefix(got, test.err) {
+			t.Errorf("Test %d: Expected down with error '%s', got '%s'", i, test.err, got)
+		}
+	}
+}
+
+func TestCheckerRetry(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for received := 0; ; received++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// Lose every other datagram
+			if received%2 == 1 {
+				conn.WriteTo(buf[:n], addr)
+			}
+		}
+	}()
+
+	hc := Checker{Name: "Test", URL: conn.LocalAddr().String(), Send: "hello", Expect: "hello", Attempts: 3}
+	hc.Timeout.Duration = 100 * time.Millisecond
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+	if got, want := len(result.Times), 2; got != want {
+		t.Fatalf("Expected %d attempts, got %d", want, got)
+	}
+	if got, want := result.Times[0].Error, "no reply within 100ms"; got != want {
+		t.Errorf("Expected the first attempt to fail with '%s', got '%s'", want, got)
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	hc := Checker{
+		Name:         "Test",
+		URL:          "localhost",
+		Send:         "zz",
+		Encoding:     "hex",
+		Expect:       "00",
+		ExpectRegex:  "(",
+		NoReply:      true,
+		ThresholdRTT: types.Duration{Duration: time.Second},
+	}
+	want := []string{
+		"endpoint_url: address localhost: missing port in address",
+		"send: encoding/hex: invalid byte: U+007A 'z'",
+		"expect_regex: error parsing regexp: missing closing ): `(`",
+		"expect_regex: cannot be combined with expect",
+		"no_reply: cannot be combined with expect or expect_regex",
+		"no_reply: cannot be combined with threshold_rtt",
+	}
+	if got := strings.Split(hc.Validate().Error(), "; "); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
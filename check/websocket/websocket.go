@@ -0,0 +1,456 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	xwebsocket "golang.org/x/net/websocket"
+
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/check/internal/checkutil"
+	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
+	"github.com/feifeigood/checkup/prometheus/metric"
+	"github.com/feifeigood/checkup/types"
+)
+
+// Type should match the package name
+const Type = "websocket"
+
+// DefaultTimeout is the maximum time an attempt may take
+// when no Timeout is configured.
+const DefaultTimeout = 10 * time.Second
+
+// maxHandshakeBytes is how much of the handshake response
+// is kept to report its status and subprotocol.
+const maxHandshakeBytes = 8 << 10
+
+// Checker implements a Checker for WebSocket endpoints.
+type Checker struct {
+	// Name is the name of the endpoint.
+	Name string `json:"endpoint_name"`
+
+	// URL is the ws or wss URL of the endpoint.
+	URL string `json:"endpoint_url"`
+
+	// Origin is sent as the Origin header. By default,
+	// it is the http or https URL of the host of URL.
+	Origin string `json:"origin,omitempty"`
+
+	// Headers contains headers to add to the opening
+	// handshake request.
+	Headers http.Header `json:"headers,omitempty"`
+
+	// Subprotocols are offered to the endpoint, which
+	// must choose one of them if set.
+	Subprotocols []string `json:"subprotocols,omitempty"`
+
+	// Send is a message sent once connected, encoded
+	// with Encoding.
+	Send string `json:"send,omitempty"`
+
+	// Encoding is the encoding of Send, one of text
+	// (default), hex and base64.
+	Encoding string `json:"encoding,omitempty"`
+
+	// Binary sends Send as a binary message instead
+	// of a text message.
+	Binary bool `json:"binary,omitempty"`
+
+	// Expect is what the first message received must
+	// contain.
+	Expect string `json:"expect,omitempty"`
+
+	// ExpectRegex is a regular expression which the
+	// first message received must match.
+	ExpectRegex string `json:"expect_regex,omitempty"`
+
+	// TLSSkipVerify controls whether to skip server TLS
+	// certificate validation or not.
+	TLSSkipVerify bool `json:"tls_skip_verify,omitempty"`
+
+	// TLSCAFile is the Certificate Authority used
+	// to validate the server TLS certificate.
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+
+	// Timeout is the maximum time an attempt, from
+	// connecting to receiving the reply, may take.
+	// Default is DefaultTimeout.
+	Timeout types.Duration `json:"timeout,omitempty"`
+
+	// ThresholdRTT is the maximum round trip time to
+	// allow for a healthy endpoint. If non-zero and a
+	// request takes longer than ThresholdRTT, the
+	// endpoint will be considered unhealthy. Note that
+	// this duration includes any in-between network
+	// latency.
+	ThresholdRTT types.Duration `json:"threshold_rtt,omitempty"`
+
+	// Attempts is how many requests the client will
+	// make to the endpoint in a single check.
+	Attempts int `json:"attempts,omitempty"`
+
+	// Every override every subcommand interval If set.
+	Every types.Duration `json:"every,omitempty"`
+
+	//
+	metrics []metric.Metric
+}
+
+// Type returns the checker package name
+func (c *Checker) Type() string {
+	return Type
+}
+
+func init() {
+	checkup.RegisterChecker(Type, func(config json.RawMessage) (checkup.Checker, error) {
+		return New(config)
+	})
+}
+
+// New creates a new Checker instance based on json config
+func New(config json.RawMessage) (*Checker, error) {
+	var checker Checker
+	err := json.Unmarshal(config, &checker)
+	checker.metrics = []metric.Metric{}
+	return &checker, err
+}
+
+// GetEvery returns the checker specified check interval to override every subcommand
+func (c *Checker) GetEvery() time.Duration {
+	return c.Every.Duration
+}
+
+// Validate implements checkup.Validator.
+func (c *Checker) Validate() error {
+	var errs types.Errors
+	if c.Name == "" {
+		errs = append(errs, types.NewValidationError("endpoint_name", "must not be empty"))
+	}
+	if u, err := url.Parse(c.URL); c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	} else if err != nil {
+		errs = append(errs, types.NewValidationError("endpoint_url", "%v", err))
+	} else if u.Scheme != "ws" && u.Scheme != "wss" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "scheme must be ws or wss"))
+	}
+	if _, err := url.ParseRequestURI(c.Origin); c.Origin != "" && err != nil {
+		errs = append(errs, types.NewValidationError("origin", "%v", err))
+	}
+	if _, err := checkutil.Decode(c.Send, c.Encoding); err != nil {
+		errs = append(errs, types.NewValidationError("send", "%v", err))
+	}
+	if c.Binary && c.Send == "" {
+		errs = append(errs, types.NewValidationError("binary", "requires send"))
+	}
+	if _, err := regexp.Compile(c.ExpectRegex); err != nil {
+		errs = append(errs, types.NewValidationError("expect_regex", "%v", err))
+	}
+	if c.Expect != "" && c.ExpectRegex != "" {
+		errs = append(errs, types.NewValidationError("expect_regex", "cannot be combined with expect"))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, types.NewValidationError("attempts", "must not be negative"))
+	}
+	for field, d := range map[string]time.Duration{
+		"every":         c.Every.Duration,
+		"timeout":       c.Timeout.Duration,
+		"threshold_rtt": c.ThresholdRTT.Duration,
+	} {
+		if d < 0 {
+			errs = append(errs, types.NewValidationError(field, "must not be negative"))
+		}
+	}
+	return errs.Err()
+}
+
+// Check performs checks using c according to its configuration.
+// An error is only returned if there is a configuration error.
+func (c *Checker) Check(ctx context.Context) (types.Result, error) {
+	if c.Attempts < 1 {
+		c.Attempts = 1
+	}
+
+	result := types.NewResult()
+	result.Type = c.Type()
+	result.Title = c.Name
+	result.Endpoint = c.URL
+
+	config, err := c.config()
+	if err != nil {
+		return result, err
+	}
+	send, err := checkutil.Decode(c.Send, c.Encoding)
+	if err != nil {
+		return result, fmt.Errorf("send: %w", err)
+	}
+	var re *regexp.Regexp
+	if c.ExpectRegex != "" {
+		if re, err = regexp.Compile(c.ExpectRegex); err != nil {
+			return result, fmt.Errorf("expect_regex: %w", err)
+		}
+	}
+	var subprotocol string
+	result.Times, subprotocol = c.doChecks(ctx, config, send, re)
+
+	return c.conclude(result, subprotocol), nil
+}
+
+// config returns the configuration of the WebSocket client.
+func (c *Checker) config() (*xwebsocket.Config, error) {
+	location, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	origin := c.Origin
+	if origin == "" {
+		scheme := "http"
+		if location.Scheme == "wss" {
+			scheme = "https"
+		}
+		origin = scheme + "://" + location.Host
+	}
+	config, err := xwebsocket.NewConfig(c.URL, origin)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Headers {
+		for _, value := range values {
+			config.Header.Add(key, value)
+		}
+	}
+
+	if location.Scheme == "wss" {
+		config.TlsConfig = &tls.Config{
+			ServerName:         location.Hostname(),
+			InsecureSkipVerify: c.TLSSkipVerify,
+		}
+		if c.TLSCAFile != "" {
+			pool, err := checkutil.LoadCAFile(c.TLSCAFile)
+			if err != nil {
+				return nil, err
+			}
+			config.TlsConfig.RootCAs = pool
+		}
+	}
+	return config, nil
+}
+
+// doChecks executes and returns each attempt, and the
+// subprotocol chosen by the endpoint in the last handshake.
+func (c *Checker) doChecks(ctx context.Context, config *xwebsocket.Config, send []byte, re *regexp.Regexp) (types.Attempts, string) {
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var subprotocol string
+	checks := make(types.Attempts, c.Attempts)
+	for i := 0; i < c.Attempts; i++ {
+		var chosen string
+		checks[i], chosen = c.doCheck(ctx, config, send, re, timeout)
+		if chosen != "" {
+			subprotocol = chosen
+		}
+	}
+	return checks, subprotocol
+}
+
+// doCheck connects to the endpoint and exchanges a message if
+// configured, within timeout. The handshake and the message
+// are recorded as steps of the attempt. The subprotocol chosen
+// in the handshake is returned along.
+func (c *Checker) doCheck(ctx context.Context, config *xwebsocket.Config, send []byte, re *regexp.Regexp, timeout time.Duration) (attempt types.Attempt, subprotocol string) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		attempt.RTT = time.Since(start)
+	}()
+
+	step := types.Step{Name: "handshake"}
+	ws, subprotocol, err := c.handshake(ctx, config)
+	step.RTT = time.Since(start)
+	if err != nil {
+		step.Error = err.Error()
+		attempt.Steps = append(attempt.Steps, step)
+		attempt.Error = fmt.Sprintf("handshake: %v", err)
+		return attempt, subprotocol
+	}
+	defer ws.Close()
+	attempt.Steps = append(attempt.Steps, step)
+
+	if len(send) == 0 && c.Expect == "" && re == nil {
+		return attempt, subprotocol
+	}
+	step = types.Step{Name: "message"}
+	messageStart := time.Now()
+	err = c.exchange(ws, send, re)
+	step.RTT = time.Since(messageStart)
+	if err != nil {
+		step.Error = err.Error()
+		attempt.Error = fmt.Sprintf("message: %v", err)
+	}
+	attempt.Steps = append(attempt.Steps, step)
+	return attempt, subprotocol
+}
+
+// handshake connects to the endpoint and performs the opening
+// handshake. The connection is usable until ctx is done. The
+// subprotocol chosen by the endpoint is returned along.
+func (c *Checker) handshake(ctx context.Context, config *xwebsocket.Config) (*xwebsocket.Conn, string, error) {
+	// Copied as the handshake replaces the subprotocols
+	// with the one chosen
+	config.Protocol = append([]string(nil), c.Subprotocols...)
+
+	host := config.Location.Host
+	if config.Location.Port() == "" {
+		port := "80"
+		if config.Location.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(config.Location.Hostname(), port)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, "", err
+	}
+	// Unblock reads and writes when ctx is done, at the
+	// latest when the attempt ends
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now())
+	}()
+	if config.TlsConfig != nil {
+		conn = tls.Client(conn, config.TlsConfig)
+	}
+
+	recorder := &handshakeRecorder{Conn: conn}
+	ws, err := xwebsocket.NewClient(config, recorder)
+	if err != nil {
+		conn.Close()
+		if resp := recorder.response(); resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			return nil, "", fmt.Errorf("response status %s", resp.Status)
+		}
+		return nil, "", err
+	}
+	var subprotocol string
+	if resp := recorder.response(); resp != nil {
+		subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	}
+	if len(c.Subprotocols) > 0 && subprotocol == "" {
+		ws.Close()
+		return nil, "", fmt.Errorf("no subprotocol of %s was chosen", strings.Join(c.Subprotocols, ", "))
+	}
+	return ws, subprotocol, nil
+}
+
+// exchange sends send over ws, if set, then receives a message
+// and checks it contains Expect and matches re.
+func (c *Checker) exchange(ws *xwebsocket.Conn, send []byte, re *regexp.Regexp) error {
+	if len(send) > 0 {
+		var err error
+		if c.Binary {
+			err = xwebsocket.Message.Send(ws, send)
+		} else {
+			err = xwebsocket.Message.Send(ws, string(send))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if c.Expect == "" && re == nil {
+		return nil
+	}
+
+	var reply []byte
+	if err := xwebsocket.Message.Receive(ws, &reply); err != nil {
+		return err
+	}
+	if c.Expect != "" && !bytes.Contains(reply, []byte(c.Expect)) {
+		return fmt.Errorf("reply %s does not contain %q", checkutil.Snippet(reply), c.Expect)
+	}
+	if re != nil && !re.Match(reply) {
+		return fmt.Errorf("reply %s does not match /%s/", checkutil.Snippet(reply), re)
+	}
+	return nil
+}
+
+// handshakeRecorder keeps the beginning of what is read from
+// the connection, which is the handshake response.
+type handshakeRecorder struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (r *handshakeRecorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	if room := maxHandshakeBytes - r.buf.Len(); room > 0 {
+		if n < room {
+			room = n
+		}
+		r.buf.Write(p[:room])
+	}
+	return n, err
+}
+
+// response parses the handshake response, nil if it was
+// not received.
+func (r *handshakeRecorder) response() *http.Response {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.buf.Bytes())), nil)
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// conclude takes the data in result from the attempts and
+// computes remaining values needed to fill out the result.
+// It detects degraded (high-latency) responses and makes
+// the conclusion about the result's status.
+func (c *Checker) conclude(result types.Result, subprotocol string) types.Result {
+	result.ThresholdRTT = c.ThresholdRTT.Duration
+
+	if subprotocol != "" {
+		result.Details = map[string]string{"subprotocol": subprotocol}
+	}
+
+	// Check errors (down)
+	for i := range result.Times {
+		if result.Times[i].Error != "" {
+			result.Down = true
+			return result
+		}
+	}
+
+	// Check round trip time (degraded)
+	if c.ThresholdRTT.Duration > 0 {
+		stats := result.ComputeStats()
+		if stats.Median > c.ThresholdRTT.Duration {
+			result.Notice = fmt.Sprintf("median round trip time exceeded threshold (%s)", c.ThresholdRTT)
+			result.Degraded = true
+			return result
+		}
+	}
+
+	result.Healthy = true
+	return result
+}
+
+func (c *Checker) Collect(collector checkup_prometheus_client.Collector) {
+	if c.metrics != nil && len(c.metrics) > 0 {
+		collector.Add(c.metrics)
+	}
+	c.metrics = []metric.Metric{}
+}
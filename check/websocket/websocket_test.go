@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	xwebsocket "golang.org/x/net/websocket"
+)
+
+// newServer returns a server echoing messages back on /echo,
+// prefixed with "echo: ", to clients sending the header
+// Token: s3cret. It chooses the subprotocol chat if offered.
+func newServer(tlsEnabled bool) *httptest.Server {
+	server := xwebsocket.Server{
+		Handshake: func(config *xwebsocket.Config, r *http.Request) error {
+			if r.Header.Get("Token") != "s3cret" {
+				return fmt.Errorf("missing token")
+			}
+			for _, protocol := range config.Protocol {
+				if protocol == "chat" {
+					config.Protocol = []string{protocol}
+					return nil
+				}
+			}
+			config.Protocol = nil
+			return nil
+		},
+		Handler: func(ws *xwebsocket.Conn) {
+			var msg []byte
+			for xwebsocket.Message.Receive(ws, &msg) == nil {
+				reply := append([]byte("echo: "), msg...)
+				if ws.PayloadType == xwebsocket.BinaryFrame {
+					xwebsocket.Message.Send(ws, reply)
+				} else {
+					xwebsocket.Message.Send(ws, string(reply))
+				}
+			}
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/echo", server)
+	if tlsEnabled {
+		return httptest.NewTLSServer(mux)
+	}
+	return httptest.NewServer(mux)
+}
+
+func TestChecker(t *testing.T) {
+	srv := newServer(false)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/echo"
+
+	for i, test := range []struct {
+		hc          Checker
+		steps       int
+		subprotocol string
+		err         string
+	}{
+		{hc: Checker{}, steps: 1},
+		{hc: Checker{Subprotocols: []string{"v2.chat", "chat"}}, steps: 1, subprotocol: "chat"},
+		{hc: Checker{Send: "ping", Expect: "echo: ping"}, steps: 2},
+		{hc: Checker{Send: "0102", Encoding: "hex", Binary: true, ExpectRegex: "^echo: \x01\x02$"}, steps: 2},
+		{hc: Checker{Send: "ping", Expect: "pong"}, steps: 2, err: `message: reply "echo: ping" does not contain "pong"`},
+		{hc: Checker{Subprotocols: []string{"v2.chat"}}, steps: 1, err: "handshake: no subprotocol of v2.chat was chosen"},
+		{hc: Checker{Headers: http.Header{}}, steps: 1, err: "handshake: response status 403 Forbidden"},
+		{hc: Checker{URL: strings.TrimSuffix(url, "/echo") + "/missing"}, steps: 1, err: "handshake: response status 404 Not Found"},
+	} {
+		hc := test.hc
+		hc.Name, hc.Attempts = "Test", 2
+		if hc.URL == "" {
+			hc.URL = url
+		}
+		if hc.Headers == nil {
+			hc.Headers = http.Header{"Token": {"s3cret"}}
+		}
+		hc.Timeout.Duration = time.Second
+		if err := hc.Validate(); err != nil {
+			t.Errorf("Test %d: Didn't expect a validation error: %v", i, err)
+		}
+
+		result, err := hc.Check(context.Background())
+		if err != nil {
+			t.Errorf("Test %d: Didn't expect an error: %v", i, err)
+		}
+		if got, want := result.Healthy, test.err == ""; got != want {
+			t.Errorf("Test %d: Expected result.Healthy=%v, got %v (%v)", i, want, got, result.Times)
+		}
+		if got, want := result.Times[0].Error, test.err; got != want {
+			t.Errorf("Test %d: Expected error '%s', got '%s'", i, want, got)
+		}
+		if got, want := len(result.Times[0].Steps), test.steps; got != want {
+			t.Errorf("Test %d: Expected %d steps, got %d", i, want, got)
+			continue
+		}
+		if got, want := result.Times[0].Steps[0].Name, "handshake"; got != want {
+			t.Errorf("Test %d: Expected first step %s, got %s", i, want, got)
+		}
+		if got, want := result.Details["subprotocol"], test.subprotocol; got != want {
+			t.Errorf("Test %d: Expected subprotocol '%s', got '%s'", i, want, got)
+		}
+	}
+}
+
+func TestCheckerCancel(t *testing.T) {
+	srv := newServer(false)
+	defer srv.Close()
+
+	// The server never sends a message unprompted
+	hc := Checker{
+		Name:    "Test",
+		URL:     "ws" + strings.TrimPrefix(srv.URL, "http") + "/echo",
+		Headers: http.Header{"Token": {"s3cret"}},
+		Expect:  "echo",
+	}
+	hc.Timeout.Duration = 10 * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := hc.Check(ctx)
+	if err != nil {
+		t.Errorf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Down, true; got != want {
+		t.Errorf("Expected result.Down=%v, got %v", want, got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected check to be aborted, took %s", elapsed)
+	}
+}
+
+func TestCheckerTLS(t *testing.T) {
+	srv := newServer(true)
+	defer srv.Close()
+
+	hc := Checker{
+		Name:          "Test",
+		URL:           "wss" + strings.TrimPrefix(srv.URL, "https") + "/echo",
+		Headers:       http.Header{"Token": {"s3cret"}},
+		Send:          "ping",
+		Expect:        "echo: ping",
+		TLSSkipVerify: true,
+	}
+	result, err := hc.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	if got, want := result.Healthy, true; got != want {
+		t.Errorf("Expected result.Healthy=%v, got %v (%v)", want, got, result.Times)
+	}
+
+	// The test certificate is not trusted
+	hc.TLSSkipVerify = false
+	result, _ = hc.Check(context.Background())
+	if got := result.Times[0].Error; !strings.HasPrefix(got, "handshake: ") || !strings.Contains(got, "x509: ") {
+		t.Errorf("Expected a certificate error, got '%s'", got)
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	hc := Checker{
+		Name:        "Test",
+		URL:         "http://localhost",
+		Send:        "zz",
+		Encoding:    "hex",
+		Expect:      "00",
+		ExpectRegex: "(",
+	}
+	want := []string{
+		"endpoint_url: scheme must be ws or wss",
+		"send: encoding/hex: invalid byte: U+007A 'z'",
+		"expect_regex: error parsing regexp: missing closing ): `(`",
+		"expect_regex: cannot be combined with expect",
+	}
+	if got := strings.Split(hc.Validate().Error(), "; "); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -1,20 +1,17 @@
 package checkup
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/feifeigood/checkup/check/exec"
-	"github.com/feifeigood/checkup/check/http"
-	"github.com/feifeigood/checkup/check/icmp"
-	"github.com/feifeigood/checkup/check/tcp"
-	"github.com/feifeigood/checkup/notifier/mail"
 	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
+	"github.com/feifeigood/checkup/prometheus/metric"
 	v2 "github.com/feifeigood/checkup/prometheus/v2"
-	"github.com/feifeigood/checkup/storage/fs"
 	"github.com/feifeigood/checkup/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
@@ -25,18 +22,29 @@ var log = logrus.WithField("component", "checkup")
 // DefaultConcurrentChecks is how many checks, at most to perform concurrently
 var DefaultConcurrentChecks = 128
 
+// flushQueueSize is how many batches of results may wait for
+// the storage and notifiers before results are held back.
+const flushQueueSize = 4
+
 // Checker can create a types.Result.
 type Checker interface {
 	Type() string
-	Check() (types.Result, error)
+	// Check performs the check. Implementations must abort
+	// in-flight work and return once ctx is done.
+	Check(ctx context.Context) (types.Result, error)
 	GetEvery() time.Duration
+}
+
+// MetricsCollector is implemented by Checkers with metrics of
+// their own, besides the standard ones derived from results.
+type MetricsCollector interface {
 	Collect(checkup_prometheus_client.Collector)
 }
 
-// Notifier can notify a types.Result.
+// Notifier can notify about changes in the status of checks.
 type Notifier interface {
 	Type() string
-	Notify([]types.Result) error
+	Notify([]types.Transition) error
 }
 
 // Storage can store results.
@@ -82,10 +90,25 @@ type Checkup struct {
 
 	// Notifiers
 	Notifiers []Notifier `json:"notifiers,omitempty"`
+
+	// RenotifyInterval is how often Notifiers are reminded
+	// about a check that stays unhealthy. By default they
+	// are only told when the status of a check changes.
+	RenotifyInterval types.Duration `json:"renotify_interval,omitempty"`
+
+	// StatusPage configures the status page served in
+	// apiserver mode, which is disabled if nil.
+	StatusPage *StatusPage `json:"status_page,omitempty"`
+
+	// tracker remembers the status of each check between
+	// calls to Check. It is created by UnmarshalJSON or
+	// the first notification.
+	tracker *StateTracker
 }
 
-// Check perform the health checks.
-func (c Checkup) Check() ([]types.Result, error) {
+// Check perform the health checks. Checks still running
+// when ctx is done are aborted.
+func (c *Checkup) Check(ctx context.Context) ([]types.Result, error) {
 	if c.ConcurrentChecks == 0 {
 		c.ConcurrentChecks = DefaultConcurrentChecks
 	}
@@ -100,10 +123,15 @@ func (c Checkup) Check() ([]types.Result, error) {
 	wg := sync.WaitGroup{}
 
 	for i, checker := range c.Checkers {
-		throttle <- struct{}{}
+		select {
+		case throttle <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
 		wg.Add(1)
 		go func(i int, checker Checker) {
-			results[i], errs[i] = checker.Check()
+			results[i], errs[i] = checker.Check(ctx)
 			log.Debugf("== (%s)%s - %s - %s", results[i].Type, results[i].Title, results[i].Endpoint, results[i].Status())
 			<-throttle
 			wg.Done()
@@ -115,25 +143,45 @@ func (c Checkup) Check() ([]types.Result, error) {
 		return nil, errs
 	}
 
+	c.notify(results, func(service Notifier, err error) {
+		log.Errorf("sending notifications for %s: %s", service.Type(), err)
+	})
+
+	return results, nil
+}
+
+// notify passes the transitions found in results to the
+// notifiers, calling failed for each notifier that errors.
+func (c *Checkup) notify(results []types.Result, failed func(Notifier, error)) {
+	if len(c.Notifiers) == 0 {
+		return
+	}
+	if c.tracker == nil {
+		c.tracker = NewStateTracker(c.RenotifyInterval.Duration)
+	}
+
+	transitions := c.tracker.Track(results)
+	if len(transitions) == 0 {
+		return
+	}
+
 	for _, service := range c.Notifiers {
-		err := service.Notify(results)
+		err := service.Notify(transitions)
 		if err != nil {
-			log.Errorf("sending notifications for %s: %s", service.Type(), err)
+			failed(service, err)
 		}
 	}
-
-	return results, nil
 }
 
 // CheckAndStore performs health checks and immediately
 // stores the results to the configured storage if there
 // were no errors.
-func (c Checkup) CheckAndStore() error {
+func (c *Checkup) CheckAndStore(ctx context.Context) error {
 	if c.Storage == nil {
 		return fmt.Errorf("no storage mechanism defined")
 	}
 
-	results, err := c.Check()
+	results, err := c.Check(ctx)
 	if err != nil {
 		return err
 	}
@@ -151,11 +199,11 @@ func (c Checkup) CheckAndStore() error {
 }
 
 // CheckAndStoreEvery calls CheckAndStore every interval.
-func (c Checkup) CheckAndStoreEvery(interval time.Duration) *time.Ticker {
+func (c *Checkup) CheckAndStoreEvery(interval time.Duration) *time.Ticker {
 	ticker := time.NewTicker(interval)
 	go func() {
 		for range ticker.C {
-			if err := c.CheckAndStore(); err != nil {
+			if err := c.CheckAndStore(context.Background()); err != nil {
 				log.Error(err)
 			}
 		}
@@ -165,66 +213,65 @@ func (c Checkup) CheckAndStoreEvery(interval time.Duration) *time.Ticker {
 
 // UnmarshalJSON unmarshales b into c. To succeed, it
 // requires type information for the interface values.
+// Use Validate for a detailed report of problems in b.
 func (c *Checkup) UnmarshalJSON(b []byte) error {
-
-	type checkup2 *Checkup
-	_ = json.Unmarshal(b, checkup2(c))
-
-	// clean the slate
-	c.Checkers = []Checker{}
-	c.Notifiers = []Notifier{}
-
-	// Begin unmarshaling interface values by
-	// collecting the raw JSON
+	// Unmarshal the plain fields, collecting the raw
+	// JSON of the interface values which shadow them
+	type checkup2 Checkup
 	raw := struct {
+		*checkup2
 		Checkers  []json.RawMessage `json:"checkers"`
 		Storage   json.RawMessage   `json:"storage"`
 		Notifiers []json.RawMessage `json:"notifiers"`
-	}{}
+	}{checkup2: (*checkup2)(c)}
 
 	err := json.Unmarshal(b, &raw)
 	if err != nil {
 		return err
 	}
 
-	// Then collect the concrete type information
-	configTypes := struct {
-		Checkers []struct {
-			Type string `json:"type"`
-		}
-		Storage struct {
-			Type string `json:"type"`
-		}
-		Notifiers []struct {
-			Type string `json:"type"`
-		}
-	}{}
+	// clean the slate
+	c.Checkers = []Checker{}
+	c.Notifiers = []Notifier{}
+	c.tracker = NewStateTracker(c.RenotifyInterval.Duration)
 
-	err = json.Unmarshal(b, &configTypes)
-	if err != nil {
-		return err
+	// Then collect the concrete type information
+	var configType struct {
+		Type string `json:"type"`
 	}
 
-	for i, t := range configTypes.Checkers {
-		checker, err := checkerDecode(t.Type, raw.Checkers[i])
+	for i, config := range raw.Checkers {
+		configType.Type = ""
+		if err := json.Unmarshal(config, &configType); err != nil {
+			return fmt.Errorf("checkers[%d]: %w", i, err)
+		}
+		checker, err := checkerDecode(configType.Type, config)
 		if err != nil {
-			return err
+			return fmt.Errorf("checkers[%d]: %w", i, err)
 		}
 		c.Checkers = append(c.Checkers, checker)
 	}
 
 	if raw.Storage != nil {
-		storage, err := storageDecode(configTypes.Storage.Type, raw.Storage)
+		configType.Type = ""
+		if err := json.Unmarshal(raw.Storage, &configType); err != nil {
+			return fmt.Errorf("storage: %w", err)
+		}
+		storage, err := storageDecode(configType.Type, raw.Storage)
 		if err != nil {
-			return err
+			return fmt.Errorf("storage: %w", err)
 		}
 		c.Storage = storage
 	}
 
-	for i, n := range configTypes.Notifiers {
-		notifier, err := notifierDecode(n.Type, raw.Notifiers[i])
+	for i, config := range raw.Notifiers {
+		configType.Type = ""
+		if err := json.Unmarshal(config, &configType); err != nil {
+			return fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+		notifier, err := notifierDecode(configType.Type, config)
 		if err != nil {
-			return err
+			return fmt.Errorf("notifiers[%d]: %w", i, err)
 		}
 		c.Notifiers = append(c.Notifiers, notifier)
 	}
@@ -232,55 +279,6 @@ func (c *Checkup) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func checkerDecode(typeName string, config json.RawMessage) (Checker, error) {
-	switch typeName {
-	// case dns.Type:
-	// 	return dns.New(config)
-	case icmp.Type:
-		return icmp.New(config)
-	case exec.Type:
-		return exec.New(config)
-	case http.Type:
-		return http.New(config)
-	case tcp.Type:
-		return tcp.New(config)
-	// case tls.Type:
-	// 	return tls.New(config)
-	default:
-		return nil, fmt.Errorf(errUnknownCheckerType, typeName)
-	}
-}
-
-func storageDecode(typeName string, config json.RawMessage) (Storage, error) {
-	switch typeName {
-	// case s3.Type:
-	// 	return s3.New(config)
-	// case github.Type:
-	// 	return github.New(config)
-	case fs.Type:
-		return fs.New(config)
-	// case sql.Type:
-	// 	return sql.New(config)
-	default:
-		return nil, fmt.Errorf(errUnknownStorageType, typeName)
-	}
-}
-
-func notifierDecode(typeName string, config json.RawMessage) (Notifier, error) {
-	switch typeName {
-	case mail.Type:
-		return mail.New(config)
-	// case slack.Type:
-	// 	return slack.New(config)
-	// case mailgun.Type:
-	// 	return mailgun.New(config)
-	// case pushover.Type:
-	// 	return pushover.New(config)
-	default:
-		return nil, fmt.Errorf(errUnknownNotifierType, typeName)
-	}
-}
-
 // Controller represents checker controller
 type Controller struct {
 	configFile string
@@ -288,9 +286,27 @@ type Controller struct {
 
 	checkup   Checkup
 	collector checkup_prometheus_client.Collector
+	attempts  *attemptCounter
+	errors    *errorCounter
+
+	// pending holds the results not yet passed to the
+	// storage and notifiers, flushed on reload and stop.
+	pending   []types.Result
+	pendingMu sync.Mutex
+
+	// latest is the last result of each check by title
+	// since the last reload, storage and statusPage are
+	// the configured ones and uptime counts the stored
+	// results for the status page.
+	latest     map[string]types.Result
+	storage    Storage
+	statusPage *StatusPage
+	uptime     *uptimeIndex
+	resultsMu  sync.RWMutex
 
 	logger *logrus.Entry
-	cond   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
 	reload chan struct{}
 	wg     *sync.WaitGroup
 }
@@ -303,6 +319,9 @@ func NewController(configFile string, interval time.Duration) *Controller {
 		interval:   interval,
 		reload:     make(chan struct{}, 1),
 		collector:  v2.NewCollector(time.Duration(2 * time.Minute)),
+		attempts:   newAttemptCounter(),
+		errors:     newErrorCounter(),
+		latest:     make(map[string]types.Result),
 		logger:     logrus.WithField("component", "controller"),
 	}
 }
@@ -322,32 +341,204 @@ func (ctrl *Controller) initCheckup() (Checkup, error) {
 	return c, nil
 }
 
-func (ctrl *Controller) runCheck(checker Checker, throttle chan struct{}) (types.Result, error) {
-	throttle <- struct{}{}
-	result, err := checker.Check()
+func (ctrl *Controller) runCheck(ctx context.Context, checker Checker, throttle chan struct{}) (types.Result, error) {
+	select {
+	case throttle <- struct{}{}:
+	case <-ctx.Done():
+		return types.Result{}, ctx.Err()
+	}
+	start := time.Now()
+	result, err := checker.Check(ctx)
+	duration := time.Since(start)
+	<-throttle
 	if err != nil {
-		<-throttle
 		return result, err
 	}
+
+	// The check was aborted by a reload or shutdown, its
+	// result says nothing about the endpoint.
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
 	ctrl.logger.Debugf("== (%s)%s - %s - %s", result.Type, result.Title, result.Endpoint, result.Status())
-	<-throttle
 
-	checker.Collect(ctrl.collector)
+	ctrl.collector.Add(resultMetrics(result, duration, ctrl.attempts.add(result)))
+	if mc, ok := checker.(MetricsCollector); ok {
+		mc.Collect(ctrl.collector)
+	}
+
+	ctrl.pendingMu.Lock()
+	ctrl.pending = append(ctrl.pending, result)
+	ctrl.pendingMu.Unlock()
+
+	ctrl.resultsMu.Lock()
+	ctrl.latest[result.Title] = result
+	ctrl.resultsMu.Unlock()
 
 	return result, nil
 }
 
-func (ctrl *Controller) runCheckup() {
+// Latest returns the last result of every check, sorted by title.
+func (ctrl *Controller) Latest() []types.Result {
+	ctrl.resultsMu.RLock()
+	defer ctrl.resultsMu.RUnlock()
+
+	results := make([]types.Result, 0, len(ctrl.latest))
+	for _, result := range ctrl.latest {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Title < results[j].Title
+	})
+	return results
+}
+
+// LatestResult returns the last result of the check titled title.
+func (ctrl *Controller) LatestResult(title string) (types.Result, bool) {
+	ctrl.resultsMu.RLock()
+	defer ctrl.resultsMu.RUnlock()
+
+	result, ok := ctrl.latest[title]
+	return result, ok
+}
+
+// Storage returns the configured storage, nil if there is none.
+func (ctrl *Controller) Storage() Storage {
+	ctrl.resultsMu.RLock()
+	defer ctrl.resultsMu.RUnlock()
+
+	return ctrl.storage
+}
+
+// StatusPage returns the status page configuration,
+// nil if the status page is disabled.
+func (ctrl *Controller) StatusPage() *StatusPage {
+	ctrl.resultsMu.RLock()
+	defer ctrl.resultsMu.RUnlock()
+
+	return ctrl.statusPage
+}
+
+// setCheckup makes c the running configuration.
+func (ctrl *Controller) setCheckup(c Checkup) {
+	// Flushes notify with copies of c, which must share
+	// the tracker
+	if c.tracker == nil {
+		c.tracker = NewStateTracker(c.RenotifyInterval.Duration)
+	}
+	ctrl.checkup = c
+
+	ctrl.resultsMu.Lock()
+	ctrl.latest = make(map[string]types.Result)
+	ctrl.storage = c.Storage
+	ctrl.statusPage = c.StatusPage
+	ctrl.uptime = nil
+	if c.StatusPage != nil {
+		ctrl.uptime = newUptimeIndex(c.StatusPage.days())
+	}
+	ctrl.resultsMu.Unlock()
+}
+
+// uptimeIndex returns the uptime of the checks for the status
+// page, nil if the status page is disabled.
+func (ctrl *Controller) uptimeIndex() *uptimeIndex {
+	ctrl.resultsMu.RLock()
+	defer ctrl.resultsMu.RUnlock()
+
+	return ctrl.uptime
+}
+
+// flush passes results to the storage, its maintenance and
+// the notifiers of c. Failures are logged and counted.
+func (ctrl *Controller) flush(c Checkup, results []types.Result) {
+	failed := func(stage, typ string, err error) {
+		ctrl.logger.Errorf("%s failed for %s: %v", stage, typ, err)
+		ctrl.collector.Add([]metric.Metric{ctrl.errors.add(stage, typ)})
+	}
+
+	if c.Storage != nil {
+		if err := ctrl.uptimeIndex().store(c.Storage, results); err != nil {
+			failed("store", c.Storage.Type(), err)
+		} else if m, ok := c.Storage.(Maintainer); ok {
+			if err := m.Maintain(); err != nil {
+				failed("maintain", c.Storage.Type(), err)
+			}
+		}
+	}
+
+	c.notify(results, func(service Notifier, err error) {
+		failed("notify", service.Type(), err)
+	})
+}
+
+// takePending returns the pending results and clears them.
+func (ctrl *Controller) takePending() []types.Result {
+	ctrl.pendingMu.Lock()
+	defer ctrl.pendingMu.Unlock()
+
+	results := ctrl.pending
+	ctrl.pending = nil
+	return results
+}
+
+// runFlush queues the pending results to batches every interval
+// until ctx is done, then queues the last of them and closes
+// batches. While the queue is full, results stay pending and are
+// queued with the next ones, so slow storage neither holds up the
+// checks nor reorders the results.
+func (ctrl *Controller) runFlush(ctx context.Context, batches chan<- []types.Result) {
+	defer close(batches)
+
+	ticker := time.NewTicker(ctrl.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if len(batches) == cap(batches) {
+				ctrl.logger.Warnf("storage and notifiers are behind, flushing later")
+				continue
+			}
+			if results := ctrl.takePending(); len(results) > 0 {
+				batches <- results
+			}
+		case <-ctx.Done():
+			if results := ctrl.takePending(); len(results) > 0 {
+				batches <- results
+			}
+			return
+		}
+	}
+}
+
+func (ctrl *Controller) runCheckup(ctx context.Context) {
 	ctrl.wg = &sync.WaitGroup{}
+	wg := ctrl.wg
 
 	throttle := make(chan struct{}, ctrl.checkup.ConcurrentChecks)
 
+	if c := ctrl.checkup; c.Storage != nil || len(c.Notifiers) > 0 {
+		// A single worker flushes the batches in order
+		batches := make(chan []types.Result, flushQueueSize)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			ctrl.runFlush(ctx, batches)
+		}()
+		go func() {
+			defer wg.Done()
+			for results := range batches {
+				ctrl.flush(c, results)
+			}
+		}()
+	}
+
 	for _, checker := range ctrl.checkup.Checkers {
 		checker := checker
-		ctrl.wg.Add(1)
+		wg.Add(1)
 
 		go func() {
-			defer ctrl.wg.Done()
+			defer wg.Done()
 
 			ticker := time.NewTicker(ctrl.interval)
 			if checker.GetEvery() > 0 {
@@ -358,13 +549,15 @@ func (ctrl *Controller) runCheckup() {
 			for {
 				select {
 				case <-ticker.C:
+					wg.Add(1)
 					go func() {
-						_, err := ctrl.runCheck(checker, throttle)
-						if err != nil {
+						defer wg.Done()
+						_, err := ctrl.runCheck(ctx, checker, throttle)
+						if err != nil && ctx.Err() == nil {
 							ctrl.logger.Errorf("%v", err)
 						}
 					}()
-				case <-ctrl.cond:
+				case <-ctx.Done():
 					return
 				}
 			}
@@ -390,11 +583,13 @@ func (ctrl *Controller) Run() {
 		ctrl.logger.Fatalf("invalid value for Concurrentchecks: %d (must be set > 0)", c.ConcurrentChecks)
 	}
 
-	// init throttle
-	ctrl.cond = make(chan struct{})
-	ctrl.checkup = c
+	ctrl.reload <- struct{}{}
+	defer func() { <-ctrl.reload }()
+
+	ctrl.ctx, ctrl.cancel = context.WithCancel(context.Background())
+	ctrl.setCheckup(c)
 
-	go ctrl.runCheckup()
+	ctrl.runCheckup(ctrl.ctx)
 
 	ctrl.logger.Info("started checkup process in background")
 }
@@ -402,28 +597,45 @@ func (ctrl *Controller) Run() {
 // Reload refresh checkup configuration file on runtime
 func (ctrl *Controller) Reload() {
 	ctrl.reload <- struct{}{}
+	defer func() { <-ctrl.reload }()
+
 	c, err := ctrl.initCheckup()
 	if err != nil {
 		ctrl.logger.Errorf("could not reload checkup: %v", err)
 		return
 	}
 
-	// shutdown current checker goroutine
-	close(ctrl.cond)
-
-	// wait all goroutine completed
-	ctrl.wg.Wait()
+	// shutdown current checker goroutine and abort in-flight checks
+	ctrl.stop()
 	ctrl.logger.Infof("all checker goroutine had completed, now reload it.")
 
 	if c.ConcurrentChecks <= 0 {
 		ctrl.logger.Warnf("ignore invalid value for Concurrentchecks: %d (must be set > 0)", c.ConcurrentChecks)
 		c.ConcurrentChecks = ctrl.checkup.ConcurrentChecks
 	}
+	c.tracker.inherit(ctrl.checkup.tracker)
 
-	ctrl.cond = make(chan struct{})
-	ctrl.checkup = c
+	ctrl.ctx, ctrl.cancel = context.WithCancel(context.Background())
+	ctrl.setCheckup(c)
 
-	go ctrl.runCheckup()
+	ctrl.runCheckup(ctrl.ctx)
 	ctrl.logger.Infof("checkup configuration reload successfully.")
-	<-ctrl.reload
+}
+
+// Stop aborts in-flight checks and waits for all checker
+// goroutines to exit.
+func (ctrl *Controller) Stop() {
+	ctrl.reload <- struct{}{}
+	defer func() { <-ctrl.reload }()
+
+	ctrl.stop()
+	ctrl.logger.Info("stopped checkup process")
+}
+
+func (ctrl *Controller) stop() {
+	if ctrl.cancel == nil {
+		return
+	}
+	ctrl.cancel()
+	ctrl.wg.Wait()
 }
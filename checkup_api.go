@@ -0,0 +1,228 @@
+package checkup
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+const (
+	// DefaultHistoryLimit is how many results a history
+	// request returns when no limit is given.
+	DefaultHistoryLimit = 100
+	// MaxHistoryLimit is the largest limit accepted by
+	// a history request.
+	MaxHistoryLimit = 1000
+	// DefaultHistoryWindow is how far back from its end a
+	// history request reads when no from is given, so
+	// it does not read the whole storage.
+	DefaultHistoryWindow = 7 * 24 * time.Hour
+)
+
+// ResultResponse is the JSON rendering of a result by the API.
+type ResultResponse struct {
+	types.Result
+	Status types.StatusText `json:"status"`
+	Stats  types.Stats      `json:"stats"`
+}
+
+// HistoryResponse is a page of the results of a check, newest first.
+type HistoryResponse struct {
+	Results []ResultResponse `json:"results"`
+	Offset  int              `json:"offset"`
+	Limit   int              `json:"limit"`
+	// NextOffset is the offset of the next page, zero
+	// if this is the last one.
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func newResultResponse(result types.Result) ResultResponse {
+	response := ResultResponse{Result: result, Status: result.Status()}
+	if len(result.Times) > 0 {
+		response.Stats = result.ComputeStats()
+	}
+	return response
+}
+
+// apiWebService returns the /api/v1 web service.
+func (a *APIServer) apiWebService() *restful.WebService {
+	ws := new(restful.WebService)
+	ws.Path("/api/v1").Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("/checks").To(a.listChecks).
+		Doc("list checks with their latest result"))
+	ws.Route(ws.GET("/checks/{title}").To(a.getCheck).
+		Doc("get the latest result of a check").
+		Param(ws.PathParameter("title", "title of the check")))
+	ws.Route(ws.GET("/checks/{title}/history").To(a.getHistory).
+		Doc("get the stored results of a check, newest first").
+		Param(ws.PathParameter("title", "title of the check")).
+		Param(ws.QueryParameter("from", "RFC 3339 time of the oldest result")).
+		Param(ws.QueryParameter("to", "RFC 3339 time of the newest result")).
+		Param(ws.QueryParameter("offset", "number of results to skip")).
+		Param(ws.QueryParameter("limit", "maximum number of results")))
+
+	return ws
+}
+
+func writeError(response *restful.Response, status int, format string, args ...interface{}) {
+	response.WriteHeaderAndJson(status, errorResponse{Error: fmt.Sprintf(format, args...)}, restful.MIME_JSON)
+}
+
+func (a *APIServer) listChecks(request *restful.Request, response *restful.Response) {
+	checks := []ResultResponse{}
+	for _, result := range a.controller.Latest() {
+		checks = append(checks, newResultResponse(result))
+	}
+	response.WriteAsJson(checks)
+}
+
+func (a *APIServer) getCheck(request *restful.Request, response *restful.Response) {
+	title := request.PathParameter("title")
+	result, ok := a.controller.LatestResult(title)
+	if !ok {
+		writeError(response, http.StatusNotFound, "no result for check %q", title)
+		return
+	}
+	response.WriteAsJson(newResultResponse(result))
+}
+
+func (a *APIServer) getHistory(request *restful.Request, response *restful.Response) {
+	title := request.PathParameter("title")
+
+	reader, ok := a.controller.Storage().(StorageReader)
+	if !ok {
+		writeError(response, http.StatusNotImplemented, "storage does not support reading results")
+		return
+	}
+
+	var (
+		from, to      time.Time
+		offset, limit = 0, DefaultHistoryLimit
+		err           error
+	)
+	if s := request.QueryParameter("from"); s != "" {
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			writeError(response, http.StatusBadRequest, "invalid from: %v", err)
+			return
+		}
+	}
+	if s := request.QueryParameter("to"); s != "" {
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			writeError(response, http.StatusBadRequest, "invalid to: %v", err)
+			return
+		}
+	}
+	if from.IsZero() {
+		end := to
+		if end.IsZero() {
+			end = time.Now()
+		}
+		from = end.Add(-DefaultHistoryWindow)
+	}
+	if s := request.QueryParameter("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			writeError(response, http.StatusBadRequest, "invalid offset: %s", s)
+			return
+		}
+	}
+	if s := request.QueryParameter("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > MaxHistoryLimit {
+			writeError(response, http.StatusBadRequest, "invalid limit: %s (must be 1-%d)", s, MaxHistoryLimit)
+			return
+		}
+	}
+
+	results, more, err := history(reader, title, from, to, offset, limit)
+	if err != nil {
+		a.logger.Errorf("reading history of %s: %v", title, err)
+		writeError(response, http.StatusInternalServerError, "cannot read results: %v", err)
+		return
+	}
+
+	page := HistoryResponse{Results: []ResultResponse{}, Offset: offset, Limit: limit}
+	for _, result := range results {
+		page.Results = append(page.Results, newResultResponse(result))
+	}
+	if more {
+		page.NextOffset = offset + limit
+	}
+	response.WriteAsJson(page)
+}
+
+// history reads the results of the check titled title between
+// from and to, newest first, skipping offset results and
+// returning at most limit. more reports whether there are more.
+// A zero from or to leaves the range open on that side. Check
+// files are read newest first until the page is complete.
+func history(reader StorageReader, title string, from, to time.Time, offset, limit int) (results []types.Result, more bool, err error) {
+	index, err := reader.GetIndex()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Check files are stored after their results, so
+	// only the files older than from can be skipped.
+	var files []string
+	for name, timestamp := range index {
+		if !from.IsZero() && timestamp < from.UnixNano() {
+			continue
+		}
+		files = append(files, name)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return index[files[i]] > index[files[j]]
+	})
+
+	// One more than the page tells whether there are more
+	want := offset + limit + 1
+	var found []types.Result
+	for _, name := range files {
+		if len(found) >= want {
+			break
+		}
+
+		stored, err := reader.Fetch(name)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var matched []types.Result
+		for _, result := range stored {
+			if result.Title != title {
+				continue
+			}
+			if !from.IsZero() && result.Timestamp < from.UnixNano() {
+				continue
+			}
+			if !to.IsZero() && result.Timestamp > to.UnixNano() {
+				continue
+			}
+			matched = append(matched, result)
+		}
+		sort.Slice(matched, func(i, j int) bool {
+			return matched[i].Timestamp > matched[j].Timestamp
+		})
+
+		found = append(found, matched...)
+	}
+
+	if len(found) <= offset {
+		return nil, false, nil
+	}
+	found = found[offset:]
+	if len(found) > limit {
+		return found[:limit], true, nil
+	}
+	return found, false, nil
+}
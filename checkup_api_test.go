@@ -0,0 +1,143 @@
+package checkup
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+// memStorage is a StorageReader keeping one check file per Store.
+type memStorage struct {
+	files   map[string][]types.Result
+	index   map[string]int64
+	fetched int
+}
+
+func (s *memStorage) Type() string { return "mem" }
+func (s *memStorage) Store(results []types.Result) error {
+	name := fmt.Sprintf("%d-check.json", len(s.files))
+	s.files[name] = results
+	s.index[name] = results[len(results)-1].Timestamp
+	return nil
+}
+func (s *memStorage) Fetch(name string) ([]types.Result, error) {
+	s.fetched++
+	return s.files[name], nil
+}
+func (s *memStorage) GetIndex() (map[string]int64, error) { return s.index, nil }
+
+func getJSON(t *testing.T, url string, status int, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, status; got != want {
+		t.Errorf("GET %s: Expected status %d, got %d", url, want, got)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Errorf("GET %s: Cannot decode response: %v", url, err)
+		}
+	}
+}
+
+func TestAPI(t *testing.T) {
+	start := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	storage := &memStorage{files: map[string][]types.Result{}, index: map[string]int64{}}
+	for i := 0; i < 5; i++ {
+		timestamp := start.Add(time.Duration(i) * time.Minute).UnixNano()
+		storage.Store([]types.Result{
+			{Title: "Web Site", Healthy: true, Timestamp: timestamp, Times: types.Attempts{{RTT: time.Second}}},
+			{Title: "Other", Down: true, Timestamp: timestamp},
+		})
+	}
+
+	apiserver, err := NewAPIServer(Config{MetricsPath: "/metrics"})
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	apiserver.controller.setCheckup(Checkup{Storage: storage})
+	apiserver.controller.latest["Web Site"] = types.Result{Title: "Web Site", Degraded: true, Times: types.Attempts{{RTT: time.Second}}}
+	apiserver.controller.latest["Other"] = types.Result{Title: "Other", Down: true}
+
+	server := httptest.NewServer(apiserver.container)
+	defer server.Close()
+
+	var checks []ResultResponse
+	getJSON(t, server.URL+"/api/v1/checks", http.StatusOK, &checks)
+	if got, want := len(checks), 2; got != want {
+		t.Fatalf("Expected %d checks, got %d", want, got)
+	}
+	if got, want := checks[0].Title, "Other"; got != want {
+		t.Errorf("Expected checks sorted by title, got '%s' first", got)
+	}
+	if got, want := checks[1].Status, types.StatusDegraded; got != want {
+		t.Errorf("Expected status '%s', got '%s'", want, got)
+	}
+	if got, want := checks[1].Stats.Max, time.Second; got != want {
+		t.Errorf("Expected stats max %v, got %v", want, got)
+	}
+
+	var check ResultResponse
+	getJSON(t, server.URL+"/api/v1/checks/Web%20Site", http.StatusOK, &check)
+	if got, want := check.Title, "Web Site"; got != want {
+		t.Errorf("Expected title '%s', got '%s'", want, got)
+	}
+	getJSON(t, server.URL+"/api/v1/checks/Missing", http.StatusNotFound, nil)
+
+	// Results older than the default window are not read
+	var page HistoryResponse
+	getJSON(t, server.URL+"/api/v1/checks/Web%20Site/history", http.StatusOK, &page)
+	if got, want := len(page.Results), 0; got != want {
+		t.Errorf("Expected %d results, got %d", want, got)
+	}
+	if got, want := storage.fetched, 0; got != want {
+		t.Errorf("Expected %d check files read, got %d", want, got)
+	}
+
+	to := url.QueryEscape(start.Add(time.Hour).Format(time.RFC3339))
+	page = HistoryResponse{}
+	getJSON(t, server.URL+"/api/v1/checks/Web%20Site/history?limit=2&offset=1&to="+to, http.StatusOK, &page)
+	if got, want := len(page.Results), 2; got != want {
+		t.Fatalf("Expected %d results, got %d", want, got)
+	}
+	// Only as many check files as the page needs are read
+	if got, want := storage.fetched, 4; got != want {
+		t.Errorf("Expected %d check files read, got %d", want, got)
+	}
+	if got, want := page.Results[0].Timestamp, start.Add(3*time.Minute).UnixNano(); got != want {
+		t.Errorf("Expected newest results first, got timestamp %d", got)
+	}
+	if got, want := page.NextOffset, 3; got != want {
+		t.Errorf("Expected next offset %d, got %d", want, got)
+	}
+
+	query := url.Values{
+		"from": {start.Add(time.Minute).Format(time.RFC3339)},
+		"to":   {start.Add(2 * time.Minute).Format(time.RFC3339)},
+	}
+	page = HistoryResponse{}
+	getJSON(t, server.URL+"/api/v1/checks/Other/history?"+query.Encode(), http.StatusOK, &page)
+	if got, want := len(page.Results), 2; got != want {
+		t.Fatalf("Expected %d results, got %d", want, got)
+	}
+	if got, want := page.NextOffset, 0; got != want {
+		t.Errorf("Expected next offset %d, got %d", want, got)
+	}
+	if got, want := page.Results[0].Status, types.StatusDown; got != want {
+		t.Errorf("Expected status '%s', got '%s'", want, got)
+	}
+
+	getJSON(t, server.URL+"/api/v1/checks/Other/history?limit=0", http.StatusBadRequest, nil)
+	getJSON(t, server.URL+"/api/v1/checks/Other/history?from=yesterday", http.StatusBadRequest, nil)
+
+	apiserver.controller.setCheckup(Checkup{})
+	getJSON(t, server.URL+"/api/v1/checks/Other/history", http.StatusNotImplemented, nil)
+}
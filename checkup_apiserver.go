@@ -63,6 +63,11 @@ func NewAPIServer(config Config) (*APIServer, error) {
 	apiWs := new(restful.WebService)
 	apiWs.Route(apiWs.POST("/-/reload").To(apiserver.Reload))
 	cr.Add(apiWs)
+	cr.Add(apiserver.apiWebService())
+
+	// The status page is public, container filters don't apply.
+	cr.Handle(StatusPagePath, http.HandlerFunc(apiserver.serveStatusPage))
+	cr.Handle(StatusPagePath+"/", http.HandlerFunc(apiserver.serveStatusPage))
 
 	apiserver.container = cr
 
@@ -98,6 +103,9 @@ func (a *APIServer) Run(stop <-chan struct{}) error {
 		return err
 	}
 
+	// abort in-flight checks before returning
+	a.controller.Stop()
+
 	return nil
 }
 
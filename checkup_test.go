@@ -0,0 +1,129 @@
+package checkup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+type fakeStorage struct {
+	sync.Mutex
+	results    []types.Result
+	maintained int
+	err        error
+}
+
+func (s *fakeStorage) Type() string { return "fake" }
+func (s *fakeStorage) Store(results []types.Result) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.results = append(s.results, results...)
+	return nil
+}
+func (s *fakeStorage) Maintain() error {
+	s.Lock()
+	defer s.Unlock()
+	s.maintained++
+	return nil
+}
+
+type fakeNotifier struct {
+	sync.Mutex
+	transitions []types.Transition
+}
+
+func (n *fakeNotifier) Type() string { return "fake" }
+func (n *fakeNotifier) Notify(transitions []types.Transition) error {
+	n.Lock()
+	defer n.Unlock()
+	n.transitions = append(n.transitions, transitions...)
+	return errors.New("cannot notify")
+}
+
+type downChecker struct{ fakeChecker }
+
+func (c *downChecker) Check(context.Context) (types.Result, error) {
+	return types.Result{Title: c.Name, Down: true}, nil
+}
+
+func TestControllerFlush(t *testing.T) {
+	storage := &fakeStorage{}
+	notifier := &fakeNotifier{}
+
+	ctrl := NewController("", 10*time.Millisecond)
+	ctrl.checkup = Checkup{
+		Checkers:         []Checker{&downChecker{fakeChecker{Name: "Down"}}},
+		ConcurrentChecks: 1,
+		Storage:          storage,
+		Notifiers:        []Notifier{notifier},
+		tracker:          NewStateTracker(0),
+	}
+	ctrl.ctx, ctrl.cancel = context.WithCancel(context.Background())
+	ctrl.runCheckup(ctrl.ctx)
+	time.Sleep(100 * time.Millisecond)
+	ctrl.Stop()
+
+	if len(storage.results) == 0 {
+		t.Errorf("Expected results to be stored")
+	}
+	if storage.maintained == 0 {
+		t.Errorf("Expected storage to be maintained")
+	}
+	if got, want := len(notifier.transitions), 1; got != want {
+		t.Fatalf("Expected %d transitions, got %d", want, got)
+	}
+	if got, want := notifier.transitions[0].Kind, types.TransitionDown; got != want {
+		t.Errorf("Expected transition kind '%s', got '%s'", want, got)
+	}
+	if got := ctrl.errors.counts["notify\nfake"]; got == 0 {
+		t.Errorf("Expected notifier errors to be counted")
+	}
+
+	storage.err = errors.New("cannot store")
+	ctrl.flush(ctrl.checkup, []types.Result{{Title: "Down", Down: true}})
+	if got, want := ctrl.errors.counts["store\nfake"], int64(1); got != want {
+		t.Errorf("Expected %d storage errors, got %d", want, got)
+	}
+}
+
+func TestControllerFlushOnStop(t *testing.T) {
+	storage := &fakeStorage{}
+
+	ctrl := NewController("", time.Hour)
+	ctrl.checkup = Checkup{
+		ConcurrentChecks: 1,
+		Storage:          storage,
+		tracker:          NewStateTracker(0),
+	}
+	ctrl.pending = []types.Result{{Title: "First"}, {Title: "Second"}}
+	ctrl.ctx, ctrl.cancel = context.WithCancel(context.Background())
+	ctrl.runCheckup(ctrl.ctx)
+	ctrl.Stop()
+
+	if got, want := len(storage.results), 2; got != want {
+		t.Fatalf("Expected %d results to be stored on stop, got %d", want, got)
+	}
+	if got, want := storage.results[0].Title, "First"; got != want {
+		t.Errorf("Expected results in order, got '%s' first", got)
+	}
+}
+
+func TestCheckupNotifyLiteral(t *testing.T) {
+	notifier := &fakeNotifier{}
+	c := Checkup{Notifiers: []Notifier{notifier}}
+
+	down := []types.Result{{Title: "Down", Down: true}}
+	c.notify(down, func(Notifier, error) {})
+	c.notify(down, func(Notifier, error) {})
+
+	if got, want := len(notifier.transitions), 1; got != want {
+		t.Errorf("Expected %d transitions, got %d", want, got)
+	}
+}
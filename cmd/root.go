@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,7 @@ import (
 
 	nested "github.com/antonfisher/nested-logrus-formatter"
 	"github.com/feifeigood/checkup"
+	_ "github.com/feifeigood/checkup/builtin"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -46,7 +48,7 @@ store the results of the check, use --store.
 				}
 			}
 
-			results, err := c.Check()
+			results, err := c.Check(context.Background())
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/feifeigood/checkup"
+	"github.com/feifeigood/checkup/types"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the checkup configuration",
+	Long: `the validate subcommand checks the configuration file
+without running any checks. Every problem is printed with
+its JSON path, e.g. checkers[3].endpoint_url, and the
+command exits with a non-zero status if there are any, so
+configuration changes can be gated in CI.
+Examples:
+  $ checkup validate
+  $ checkup validate -c /etc/checkup/checkup.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configBytes, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = checkup.Validate(configBytes)
+		if err == nil {
+			fmt.Printf("%s: configuration is valid\n", configFile)
+			return
+		}
+
+		errs, ok := err.(types.Errors)
+		if !ok {
+			errs = types.Errors{err}
+		}
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", configFile, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d problem(s) found\n", configFile, len(errs))
+		os.Exit(1)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -3,6 +3,7 @@ module github.com/feifeigood/checkup
 go 1.14
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/antonfisher/nested-logrus-formatter v1.1.0
 	github.com/emicklei/go-restful v2.13.0+incompatible
 	github.com/fatih/color v1.7.0
@@ -10,7 +11,7 @@ require (
 	github.com/mattn/go-colorable v0.1.7 // indirect
 	github.com/miekg/dns v1.1.31
 	github.com/prometheus/client_golang v1.0.0
-	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90
+	github.com/prometheus/client_model v0.0.0-20190812154241-14fe0d1b01d4
 	github.com/prometheus/common v0.5.0 // indirect
 	github.com/sirupsen/logrus v1.2.0
 	github.com/spf13/cobra v1.0.0
@@ -19,6 +20,7 @@ require (
 	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de
 	golang.org/x/net v0.0.0-20190923162816-aa69164e4478
 	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
+	google.golang.org/grpc v1.31.1
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 )
@@ -0,0 +1,147 @@
+package checkup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/feifeigood/checkup/prometheus/metric"
+	"github.com/feifeigood/checkup/types"
+)
+
+// MetricPrefix is the measurement name of the standard
+// metrics derived from every result, e.g. a result
+// produces checkup_check_status and checkup_check_rtt_seconds.
+const MetricPrefix = "checkup_check"
+
+// ControllerMetricPrefix is the measurement name of the
+// metrics about the Controller itself, e.g. failures to
+// store results are counted in checkup_controller_errors_total.
+const ControllerMetricPrefix = "checkup_controller"
+
+var statuses = []types.StatusText{
+	types.StatusHealthy,
+	types.StatusDegraded,
+	types.StatusDown,
+	types.StatusUnknown,
+}
+
+// attemptCounter accumulates attempt counts per check
+// so they can be exported as counters.
+type attemptCounter struct {
+	sync.Mutex
+	counts map[string]*attemptCount
+}
+
+type attemptCount struct {
+	attempts int64
+	failed   int64
+}
+
+func newAttemptCounter() *attemptCounter {
+	return &attemptCounter{counts: make(map[string]*attemptCount)}
+}
+
+// add adds the attempts of result to the totals of its
+// check and returns the new totals.
+func (ac *attemptCounter) add(result types.Result) attemptCount {
+	ac.Lock()
+	defer ac.Unlock()
+
+	key := result.Type + "\n" + result.Title + "\n" + result.Endpoint
+	count, ok := ac.counts[key]
+	if !ok {
+		count = &attemptCount{}
+		ac.counts[key] = count
+	}
+	for _, attempt := range result.Times {
+		count.attempts++
+		if attempt.Error != "" {
+			count.failed++
+		}
+	}
+	return *count
+}
+
+// errorCounter counts the failures of the Controller to
+// store results or send notifications, per stage and type.
+type errorCounter struct {
+	sync.Mutex
+	counts map[string]int64
+}
+
+func newErrorCounter() *errorCounter {
+	return &errorCounter{counts: make(map[string]int64)}
+}
+
+// add counts a failure of stage for typ and returns the
+// errors_total metric with the new total.
+func (ec *errorCounter) add(stage, typ string) metric.Metric {
+	ec.Lock()
+	defer ec.Unlock()
+
+	key := stage + "\n" + typ
+	ec.counts[key]++
+	m, _ := metric.New(ControllerMetricPrefix, map[string]string{
+		"stage": stage,
+		"type":  typ,
+	}, map[string]interface{}{
+		"errors_total": ec.counts[key],
+	}, time.Now(), metric.Counter)
+	return m
+}
+
+// resultMetrics derives the standard metric set from result,
+// labelled by type, title and endpoint. duration is how long
+// the check took and count the running attempt totals.
+func resultMetrics(result types.Result, duration time.Duration, count attemptCount) []metric.Metric {
+	now := time.Now()
+	labels := func(extra ...string) map[string]string {
+		tags := map[string]string{
+			"type":     result.Type,
+			"title":    result.Title,
+			"endpoint": result.Endpoint,
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			tags[extra[i]] = extra[i+1]
+		}
+		return tags
+	}
+
+	var metrics []metric.Metric
+	add := func(tags map[string]string, fields map[string]interface{}, tp metric.ValueType) {
+		m, _ := metric.New(MetricPrefix, tags, fields, now, tp)
+		metrics = append(metrics, m)
+	}
+
+	status := result.Status()
+	for _, s := range statuses {
+		add(labels("status", string(s)), map[string]interface{}{
+			"status": s == status,
+		}, metric.Gauge)
+	}
+
+	if len(result.Times) > 0 {
+		stats := result.ComputeStats()
+		for stat, rtt := range map[string]time.Duration{
+			"median": stats.Median,
+			"min":    stats.Min,
+			"max":    stats.Max,
+		} {
+			add(labels("stat", stat), map[string]interface{}{
+				"rtt_seconds": rtt.Seconds(),
+			}, metric.Gauge)
+		}
+	}
+
+	add(labels(), map[string]interface{}{
+		"attempts_total":        count.attempts,
+		"failed_attempts_total": count.failed,
+	}, metric.Counter)
+
+	add(labels(), map[string]interface{}{
+		"last_run_timestamp_seconds": float64(result.Timestamp) / float64(time.Second),
+		"duration_seconds":           duration.Seconds(),
+	}, metric.Gauge)
+
+	return metrics
+}
@@ -0,0 +1,85 @@
+package checkup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/feifeigood/checkup/prometheus/serializer"
+	"github.com/feifeigood/checkup/types"
+)
+
+func TestResultMetrics(t *testing.T) {
+	result := types.Result{
+		Type:      "http",
+		Title:     "Test",
+		Endpoint:  "http://localhost",
+		Timestamp: 2 * int64(time.Second),
+		Times: types.Attempts{
+			{RTT: 10 * time.Millisecond},
+			{RTT: 30 * time.Millisecond, Error: "timeout"},
+		},
+		Degraded: true,
+	}
+
+	counter := newAttemptCounter()
+	counter.add(result)
+	count := counter.add(result)
+	if got, want := count, (attemptCount{attempts: 4, failed: 2}); got != want {
+		t.Errorf("Expected attempt count %+v, got %+v", want, got)
+	}
+
+	coll := serializer.NewCollection()
+	for _, m := range resultMetrics(result, time.Second, count) {
+		coll.Add(m, time.Now())
+	}
+
+	values := map[string]float64{}
+	for _, family := range coll.GetProto() {
+		for _, m := range family.Metric {
+			labels := map[string]string{}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["type"] != "http" || labels["title"] != "Test" || labels["endpoint"] != "http://localhost" {
+				t.Errorf("Expected %s to be labelled by type, title and endpoint, got %v", family.GetName(), labels)
+			}
+
+			key := family.GetName()
+			if s, ok := labels["status"]; ok {
+				key += "/" + s
+			}
+			if s, ok := labels["stat"]; ok {
+				key += "/" + s
+			}
+			switch {
+			case m.Gauge != nil:
+				values[key] = m.Gauge.GetValue()
+			case m.Counter != nil:
+				values[key] = m.Counter.GetValue()
+			}
+		}
+	}
+
+	for key, want := range map[string]float64{
+		"checkup_check_status/healthy":             0,
+		"checkup_check_status/degraded":            1,
+		"checkup_check_status/down":                0,
+		"checkup_check_status/unknown":             0,
+		"checkup_check_rtt_seconds/median":         0.02,
+		"checkup_check_rtt_seconds/min":            0.01,
+		"checkup_check_rtt_seconds/max":            0.03,
+		"checkup_check_attempts_total":             4,
+		"checkup_check_failed_attempts_total":      2,
+		"checkup_check_last_run_timestamp_seconds": 2,
+		"checkup_check_duration_seconds":           1,
+	} {
+		got, ok := values[key]
+		if !ok {
+			t.Errorf("Expected metric %s to be exported", key)
+			continue
+		}
+		if got != want {
+			t.Errorf("Expected %s=%v, got %v", key, want, got)
+		}
+	}
+}
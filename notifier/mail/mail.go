@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/feifeigood/checkup"
 	"github.com/feifeigood/checkup/types"
 	"gopkg.in/gomail.v2"
 )
@@ -23,6 +25,10 @@ type Notifier struct {
 	// Subject contains customizable subject line
 	Subject string `json:"subject,omitempty"`
 
+	// RecoverySubject is the subject line used when
+	// every check being notified has recovered
+	RecoverySubject string `json:"recovery_subject,omitempty"`
+
 	// SMTP contains all relevant mail server settings
 	SMTP struct {
 		Server   string `json:"server"`
@@ -32,6 +38,12 @@ type Notifier struct {
 	} `json:"smtp"`
 }
 
+func init() {
+	checkup.RegisterNotifier(Type, func(config json.RawMessage) (checkup.Notifier, error) {
+		return New(config)
+	})
+}
+
 // New creates a new Notifier instance based on json config
 func New(config json.RawMessage) (Notifier, error) {
 	var notifier Notifier
@@ -43,6 +55,9 @@ func New(config json.RawMessage) (Notifier, error) {
 	if strings.TrimSpace(notifier.Subject) == "" {
 		notifier.Subject = "Checkup: Service Unavailable"
 	}
+	if strings.TrimSpace(notifier.RecoverySubject) == "" {
+		notifier.RecoverySubject = "Checkup: Service Recovered"
+	}
 	return notifier, err
 }
 
@@ -51,34 +66,74 @@ func (Notifier) Type() string {
 	return Type
 }
 
-// Notify implements notifier interface
-func (m Notifier) Notify(results []types.Result) error {
-	issues := []types.Result{}
-	for _, result := range results {
-		if !result.Healthy {
-			issues = append(issues, result)
-		}
+// Validate implements checkup.Validator.
+func (m Notifier) Validate() error {
+	var errs types.Errors
+	if m.From == "" {
+		errs = append(errs, types.NewValidationError("from", "must not be empty"))
+	}
+	if len(m.To) == 0 {
+		errs = append(errs, types.NewValidationError("to", "must not be empty"))
+	}
+	if m.SMTP.Server == "" {
+		errs = append(errs, types.NewValidationError("smtp.server", "must not be empty"))
+	}
+	if m.SMTP.Port < 0 || m.SMTP.Port > 65535 {
+		errs = append(errs, types.NewValidationError("smtp.port", "%d is not a port", m.SMTP.Port))
 	}
+	return errs.Err()
+}
 
-	if len(issues) == 0 {
+// Notify implements notifier interface
+func (m Notifier) Notify(transitions []types.Transition) error {
+	if len(transitions) == 0 {
 		return nil
 	}
 
+	subject := m.Subject
+	if allRecovered(transitions) {
+		subject = m.RecoverySubject
+	}
+
 	message := gomail.NewMessage()
 	message.SetHeader("From", m.From)
 	message.SetHeader("To", m.To...)
-	message.SetHeader("Subject", m.Subject)
-	message.SetBody("text/html", renderMessage(issues))
+	message.SetHeader("Subject", subject)
+	message.SetBody("text/html", renderMessage(transitions))
 
 	dialer := gomail.NewDialer(m.SMTP.Server, m.SMTP.Port, m.SMTP.Username, m.SMTP.Password)
 	return dialer.DialAndSend(message)
 }
 
-func renderMessage(issues []types.Result) string {
-	body := []string{"<b>Checkup has detected the following issues:</b>", "<br/><br/>", "<ul>"}
-	for _, issue := range issues {
-		format := "<li>%s - Status <b>%s</b></li>"
-		body = append(body, fmt.Sprintf(format, issue.Title, issue.Status()))
+func allRecovered(transitions []types.Transition) bool {
+	for _, t := range transitions {
+		if t.Kind != types.TransitionRecovered {
+			return false
+		}
+	}
+	return true
+}
+
+func renderMessage(transitions []types.Transition) string {
+	body := []string{"<b>Checkup has detected the following changes:</b>", "<br/><br/>", "<ul>"}
+	for _, t := range transitions {
+		duration := t.Duration.Round(time.Second)
+		var line string
+		switch {
+		case t.Kind == types.TransitionRecovered:
+			format := "<li>%s - <b>Recovered</b> after being %s for %s</li>"
+			line = fmt.Sprintf(format, t.Result.Title, t.Previous, duration)
+		case t.Kind == types.TransitionRenotify:
+			format := "<li>%s - Status <b>%s</b> for %s</li>"
+			line = fmt.Sprintf(format, t.Result.Title, t.Result.Status(), duration)
+		case t.Previous == types.StatusUnknown:
+			format := "<li>%s - Status <b>%s</b></li>"
+			line = fmt.Sprintf(format, t.Result.Title, t.Result.Status())
+		default:
+			format := "<li>%s - Status <b>%s</b>, was %s for %s</li>"
+			line = fmt.Sprintf(format, t.Result.Title, t.Result.Status(), t.Previous, duration)
+		}
+		body = append(body, line)
 	}
 	body = append(body, "</ul>")
 	return strings.Join(body, "\n")
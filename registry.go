@@ -0,0 +1,102 @@
+package checkup
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// CheckerFactory creates a Checker from its JSON configuration.
+type CheckerFactory func(config json.RawMessage) (Checker, error)
+
+// StorageFactory creates a Storage from its JSON configuration.
+type StorageFactory func(config json.RawMessage) (Storage, error)
+
+// NotifierFactory creates a Notifier from its JSON configuration.
+type NotifierFactory func(config json.RawMessage) (Notifier, error)
+
+var (
+	registryMu sync.RWMutex
+	checkers   = make(map[string]CheckerFactory)
+	storages   = make(map[string]StorageFactory)
+	notifiers  = make(map[string]NotifierFactory)
+)
+
+// RegisterChecker makes a checker type available to
+// Checkup.UnmarshalJSON. It is meant to be called from
+// the init function of the package implementing the
+// checker. If RegisterChecker is called twice with the
+// same typeName or if factory is nil, it panics.
+func RegisterChecker(typeName string, factory CheckerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("checkup: RegisterChecker factory is nil")
+	}
+	if _, dup := checkers[typeName]; dup {
+		panic("checkup: RegisterChecker called twice for checker " + typeName)
+	}
+	checkers[typeName] = factory
+}
+
+// RegisterStorage makes a storage type available to
+// Checkup.UnmarshalJSON. If RegisterStorage is called
+// twice with the same typeName or if factory is nil,
+// it panics.
+func RegisterStorage(typeName string, factory StorageFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("checkup: RegisterStorage factory is nil")
+	}
+	if _, dup := storages[typeName]; dup {
+		panic("checkup: RegisterStorage called twice for storage " + typeName)
+	}
+	storages[typeName] = factory
+}
+
+// RegisterNotifier makes a notifier type available to
+// Checkup.UnmarshalJSON. If RegisterNotifier is called
+// twice with the same typeName or if factory is nil,
+// it panics.
+func RegisterNotifier(typeName string, factory NotifierFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("checkup: RegisterNotifier factory is nil")
+	}
+	if _, dup := notifiers[typeName]; dup {
+		panic("checkup: RegisterNotifier called twice for notifier " + typeName)
+	}
+	notifiers[typeName] = factory
+}
+
+func checkerDecode(typeName string, config json.RawMessage) (Checker, error) {
+	registryMu.RLock()
+	factory, ok := checkers[typeName]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf(errUnknownCheckerType, typeName)
+	}
+	return factory(config)
+}
+
+func storageDecode(typeName string, config json.RawMessage) (Storage, error) {
+	registryMu.RLock()
+	factory, ok := storages[typeName]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf(errUnknownStorageType, typeName)
+	}
+	return factory(config)
+}
+
+func notifierDecode(typeName string, config json.RawMessage) (Notifier, error) {
+	registryMu.RLock()
+	factory, ok := notifiers[typeName]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf(errUnknownNotifierType, typeName)
+	}
+	return factory(config)
+}
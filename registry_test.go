@@ -0,0 +1,54 @@
+package checkup
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	checkup_prometheus_client "github.com/feifeigood/checkup/prometheus"
+	"github.com/feifeigood/checkup/types"
+)
+
+type fakeChecker struct {
+	Name string `json:"endpoint_name"`
+}
+
+func (c *fakeChecker) Type() string                                { return "fake" }
+func (c *fakeChecker) GetEvery() time.Duration                     { return 0 }
+func (c *fakeChecker) Collect(checkup_prometheus_client.Collector) {}
+func (c *fakeChecker) Check(context.Context) (types.Result, error) {
+	return types.Result{Title: c.Name}, nil
+}
+
+func TestRegisterChecker(t *testing.T) {
+	RegisterChecker("fake", func(config json.RawMessage) (Checker, error) {
+		var c fakeChecker
+		err := json.Unmarshal(config, &c)
+		return &c, err
+	})
+
+	var c Checkup
+	err := json.Unmarshal([]byte(`{"checkers":[{"type":"fake","endpoint_name":"Fake"}]}`), &c)
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	if got, want := len(c.Checkers), 1; got != want {
+		t.Fatalf("Expected %d checkers, got %d", want, got)
+	}
+	if got, want := c.Checkers[0].(*fakeChecker).Name, "Fake"; got != want {
+		t.Errorf("Expected checker name '%s', got '%s'", want, got)
+	}
+
+	err = json.Unmarshal([]byte(`{"checkers":[{"type":"missing"}]}`), &c)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown checker type")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering a checker type twice to panic")
+		}
+	}()
+	RegisterChecker("fake", func(config json.RawMessage) (Checker, error) { return nil, nil })
+}
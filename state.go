@@ -0,0 +1,115 @@
+package checkup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+// StateTracker remembers the last status of every check,
+// by title, and turns results into the transitions that
+// notifiers should be told about.
+type StateTracker struct {
+	sync.Mutex
+
+	// renotify is how often a check that stays unhealthy
+	// is notified again. Zero disables reminders.
+	renotify time.Duration
+	states   map[string]*checkState
+}
+
+type checkState struct {
+	status   types.StatusText
+	since    time.Time
+	notified time.Time
+}
+
+// NewStateTracker creates a StateTracker reminding about
+// checks that stay unhealthy every renotify, if non-zero.
+func NewStateTracker(renotify time.Duration) *StateTracker {
+	return &StateTracker{
+		renotify: renotify,
+		states:   make(map[string]*checkState),
+	}
+}
+
+// Track records the status of results and returns the
+// transitions to notify: unhealthy checks seen for the
+// first time, status changes and reminders.
+func (t *StateTracker) Track(results []types.Result) []types.Transition {
+	t.Lock()
+	defer t.Unlock()
+
+	var transitions []types.Transition
+	for _, result := range results {
+		status := result.Status()
+		if status == types.StatusUnknown {
+			continue
+		}
+
+		now := time.Now()
+		if result.Timestamp != 0 {
+			now = time.Unix(0, result.Timestamp)
+		}
+
+		state, ok := t.states[result.Title]
+		if !ok {
+			state = &checkState{status: types.StatusUnknown, since: now}
+			t.states[result.Title] = state
+			if status == types.StatusHealthy {
+				state.status = status
+				continue
+			}
+		}
+
+		transition := types.Transition{
+			Result:   result,
+			Previous: state.status,
+			Duration: now.Sub(state.since),
+		}
+
+		switch {
+		case status != state.status:
+			transition.Kind = transitionKind(status)
+			state.status = status
+			state.since = now
+		case status != types.StatusHealthy && t.renotify > 0 && now.Sub(state.notified) >= t.renotify:
+			transition.Kind = types.TransitionRenotify
+		default:
+			continue
+		}
+
+		state.notified = now
+		transitions = append(transitions, transition)
+	}
+
+	return transitions
+}
+
+func transitionKind(status types.StatusText) types.TransitionKind {
+	switch status {
+	case types.StatusHealthy:
+		return types.TransitionRecovered
+	case types.StatusDegraded:
+		return types.TransitionDegraded
+	}
+	return types.TransitionDown
+}
+
+// inherit takes over the states remembered by old, so that
+// reloading the configuration doesn't repeat notifications.
+func (t *StateTracker) inherit(old *StateTracker) {
+	if old == nil || old == t {
+		return
+	}
+	old.Lock()
+	defer old.Unlock()
+	t.Lock()
+	defer t.Unlock()
+
+	for title, state := range old.states {
+		s := *state
+		t.states[title] = &s
+	}
+}
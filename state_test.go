@@ -0,0 +1,91 @@
+package checkup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+func TestStateTracker(t *testing.T) {
+	start := time.Now()
+	result := func(offset time.Duration, healthy, degraded, down bool) types.Result {
+		return types.Result{
+			Title:     "Test",
+			Healthy:   healthy,
+			Degraded:  degraded,
+			Down:      down,
+			Timestamp: start.Add(offset).UnixNano(),
+		}
+	}
+	healthy := func(offset time.Duration) types.Result { return result(offset, true, false, false) }
+	degraded := func(offset time.Duration) types.Result { return result(offset, false, true, false) }
+	down := func(offset time.Duration) types.Result { return result(offset, false, false, true) }
+
+	tracker := NewStateTracker(10 * time.Minute)
+
+	for i, test := range []struct {
+		result   types.Result
+		kind     types.TransitionKind
+		previous types.StatusText
+		duration time.Duration
+	}{
+		// Healthy on first sight is not notified
+		{result: healthy(0)},
+		{result: healthy(time.Minute)},
+		{result: healthy(2 * time.Minute)},
+		{down(3 * time.Minute), types.TransitionDown, types.StatusHealthy, 3 * time.Minute},
+		// Staying down is only notified after renotify_interval
+		{result: down(5 * time.Minute)},
+		{down(13 * time.Minute), types.TransitionRenotify, types.StatusDown, 10 * time.Minute},
+		{result: down(15 * time.Minute)},
+		{degraded(16 * time.Minute), types.TransitionDegraded, types.StatusDown, 13 * time.Minute},
+		{healthy(20 * time.Minute), types.TransitionRecovered, types.StatusDegraded, 4 * time.Minute},
+		{result: types.Result{Title: "Test", Timestamp: start.Add(21 * time.Minute).UnixNano()}},
+	} {
+		transitions := tracker.Track([]types.Result{test.result})
+		if test.kind == "" {
+			if len(transitions) != 0 {
+				t.Errorf("Test %d: Expected no transitions, got %v", i, transitions)
+			}
+			continue
+		}
+		if got, want := len(transitions), 1; got != want {
+			t.Errorf("Test %d: Expected %d transitions, got %d", i, want, got)
+			continue
+		}
+		if got, want := transitions[0].Kind, test.kind; got != want {
+			t.Errorf("Test %d: Expected kind '%s', got '%s'", i, want, got)
+		}
+		if got, want := transitions[0].Previous, test.previous; got != want {
+			t.Errorf("Test %d: Expected previous status '%s', got '%s'", i, want, got)
+		}
+		if got, want := transitions[0].Duration, test.duration; got != want {
+			t.Errorf("Test %d: Expected duration %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestStateTrackerFirstUnhealthy(t *testing.T) {
+	tracker := NewStateTracker(0)
+
+	transitions := tracker.Track([]types.Result{
+		{Title: "Up", Healthy: true},
+		{Title: "Down", Down: true},
+	})
+	if got, want := len(transitions), 1; got != want {
+		t.Fatalf("Expected %d transitions, got %d", want, got)
+	}
+	if got, want := transitions[0].Result.Title, "Down"; got != want {
+		t.Errorf("Expected transition for '%s', got '%s'", want, got)
+	}
+	if got, want := transitions[0].Previous, types.StatusUnknown; got != want {
+		t.Errorf("Expected previous status '%s', got '%s'", want, got)
+	}
+
+	// Without renotify_interval a check that stays down is quiet
+	transitions = tracker.Track([]types.Result{{Title: "Down", Down: true}})
+	if got, want := len(transitions), 0; got != want {
+		t.Errorf("Expected %d transitions, got %d", want, got)
+	}
+}
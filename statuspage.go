@@ -0,0 +1,410 @@
+package checkup
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+const (
+	// StatusPagePath is where the APIServer serves the status
+	// page, its JSON feed is served at StatusPagePath/feed.json.
+	StatusPagePath = "/status"
+
+	// DefaultStatusPageDays is how many days of uptime the
+	// status page shows by default.
+	DefaultStatusPageDays = 90
+
+	day = 24 * time.Hour
+)
+
+// StatusPage configures the public status page.
+type StatusPage struct {
+	// Title is shown at the top of the page.
+	Title string `json:"title,omitempty"`
+
+	// Logo is the URL of an image shown next to the title.
+	// Use a data: URL to keep the page free of external assets.
+	Logo string `json:"logo,omitempty"`
+
+	// Groups lists the checks shown together, by title.
+	// Checks in no group are grouped by type.
+	Groups []StatusPageGroup `json:"groups,omitempty"`
+
+	// Days is how many days of uptime to show.
+	// Default value is DefaultStatusPageDays
+	Days int `json:"days,omitempty"`
+
+	// ShowMessages adds the message of the latest result
+	// of each check to the page. Messages may contain
+	// internal details, e.g. error text, so they are left
+	// out by default.
+	ShowMessages bool `json:"show_messages,omitempty"`
+}
+
+// days returns how many days of uptime to show.
+func (page *StatusPage) days() int {
+	if page.Days <= 0 {
+		return DefaultStatusPageDays
+	}
+	return page.Days
+}
+
+// StatusPageGroup is a user-defined group of checks.
+type StatusPageGroup struct {
+	Name   string   `json:"name"`
+	Checks []string `json:"checks"`
+}
+
+// StatusFeed is the JSON feed behind the status page.
+type StatusFeed struct {
+	Title string `json:"title"`
+	Logo  string `json:"logo,omitempty"`
+
+	// Status is the worst status of all checks.
+	Status types.StatusText `json:"status"`
+
+	// Updated is when the feed was generated. UTC Unix nano format.
+	Updated int64 `json:"updated"`
+
+	Groups []StatusFeedGroup `json:"groups"`
+}
+
+// StatusFeedGroup is a group of checks in the feed.
+type StatusFeedGroup struct {
+	Name string `json:"name"`
+
+	// Status is the worst status of the checks in the group.
+	Status types.StatusText `json:"status"`
+
+	Checks []StatusFeedCheck `json:"checks"`
+}
+
+// StatusFeedCheck is the current status and uptime of a
+// check in the feed. Endpoints are left out on purpose, the
+// feed is public.
+type StatusFeedCheck struct {
+	Title     string           `json:"title"`
+	Type      string           `json:"type,omitempty"`
+	Status    types.StatusText `json:"status"`
+	Message   string           `json:"message,omitempty"`
+	Timestamp int64            `json:"timestamp,omitempty"`
+
+	// Uptime is the percentage of healthy or degraded results
+	// over all Days, nil if no results were stored.
+	Uptime *float64 `json:"uptime,omitempty"`
+
+	// Days is the uptime per day, oldest first.
+	Days []StatusDay `json:"days"`
+}
+
+// StatusDay sums up the stored results of a check for a UTC day.
+type StatusDay struct {
+	// Date is the day in YYYY-MM-DD format.
+	Date string `json:"date"`
+
+	// Status is down if any result was down, else degraded if
+	// any was degraded, healthy if all were healthy and unknown
+	// if there were no results.
+	Status types.StatusText `json:"status"`
+
+	// Uptime is the percentage of healthy or degraded results.
+	Uptime float64 `json:"uptime"`
+
+	// Checks is the number of results.
+	Checks int `json:"checks"`
+}
+
+type dayCount struct {
+	total, up int
+	worst     types.StatusText
+}
+
+// add counts a result with status.
+func (count *dayCount) add(status types.StatusText) {
+	count.total++
+	if status != types.StatusDown {
+		count.up++
+	}
+	if count.total == 1 || status.PriorityOver(count.worst) {
+		count.worst = status
+	}
+}
+
+// uptimeIndex keeps the results of the last days UTC days
+// counted per check title and day, so the status page does
+// not read the storage every time. It is loaded from the
+// storage once, then results are counted as they are stored.
+type uptimeIndex struct {
+	sync.Mutex
+	days   int
+	loaded bool
+
+	// counts are by title then by day since the Unix epoch
+	counts map[string]map[int64]*dayCount
+}
+
+func newUptimeIndex(days int) *uptimeIndex {
+	return &uptimeIndex{days: days, counts: make(map[string]map[int64]*dayCount)}
+}
+
+// firstDay returns the first day of the index at now.
+func (u *uptimeIndex) firstDay(now time.Time) int64 {
+	return now.UnixNano()/int64(day) - int64(u.days-1)
+}
+
+// count counts result if it is within the index at now.
+func (u *uptimeIndex) count(result types.Result, now time.Time) {
+	status := result.Status()
+	d := result.Timestamp / int64(day)
+	if status == types.StatusUnknown || result.Timestamp < 0 || d < u.firstDay(now) {
+		return
+	}
+	if u.counts[result.Title] == nil {
+		u.counts[result.Title] = make(map[int64]*dayCount)
+	}
+	if u.counts[result.Title][d] == nil {
+		u.counts[result.Title][d] = &dayCount{}
+	}
+	u.counts[result.Title][d].add(status)
+}
+
+// store passes results to storage, counting them once they
+// are stored. u may be nil, without a status page.
+func (u *uptimeIndex) store(storage Storage, results []types.Result) error {
+	if u == nil {
+		return storage.Store(results)
+	}
+
+	// Loading must not see results counted here
+	u.Lock()
+	defer u.Unlock()
+
+	if err := storage.Store(results); err != nil {
+		return err
+	}
+	if u.loaded {
+		now := time.Now()
+		for _, result := range results {
+			u.count(result, now)
+		}
+	}
+	return nil
+}
+
+// load counts the results of the check files reader stored
+// within the index at now.
+func (u *uptimeIndex) load(reader StorageReader, now time.Time) error {
+	index, err := reader.GetIndex()
+	if err != nil {
+		return err
+	}
+	for name, timestamp := range index {
+		// Check files are stored after their results
+		if timestamp < u.firstDay(now)*int64(day) {
+			continue
+		}
+		results, err := reader.Fetch(name)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			u.count(result, now)
+		}
+	}
+	return nil
+}
+
+// get returns the uptime per day at now by check title, oldest
+// day first. It loads the index from reader the first time.
+func (u *uptimeIndex) get(reader StorageReader, now time.Time) (map[string][]StatusDay, error) {
+	u.Lock()
+	defer u.Unlock()
+
+	if !u.loaded {
+		if err := u.load(reader, now); err != nil {
+			u.counts = make(map[string]map[int64]*dayCount)
+			return nil, err
+		}
+		u.loaded = true
+	}
+
+	first := u.firstDay(now)
+	uptime := make(map[string][]StatusDay, len(u.counts))
+	for title, byDay := range u.counts {
+		counts := make([]dayCount, u.days)
+		for d, count := range byDay {
+			if d < first {
+				// Forget the days out of the index
+				delete(byDay, d)
+			} else if d-first < int64(u.days) {
+				counts[d-first] = *count
+			}
+		}
+		if len(byDay) == 0 {
+			delete(u.counts, title)
+			continue
+		}
+		uptime[title] = statusDays(time.Unix(0, first*int64(day)).UTC(), counts)
+	}
+	return uptime, nil
+}
+
+// statusDays turns counts into StatusDays starting at start.
+func statusDays(start time.Time, counts []dayCount) []StatusDay {
+	days := make([]StatusDay, len(counts))
+	for i, count := range counts {
+		days[i] = StatusDay{
+			Date:   start.AddDate(0, 0, i).Format("2006-01-02"),
+			Status: types.StatusUnknown,
+			Checks: count.total,
+		}
+		if count.total > 0 {
+			days[i].Status = count.worst
+			days[i].Uptime = 100 * float64(count.up) / float64(count.total)
+		}
+	}
+	return days
+}
+
+// statusFeed builds the feed of page from the latest results
+// and the uptime read from the storage.
+func (a *APIServer) statusFeed(page *StatusPage, now time.Time) StatusFeed {
+	days := page.days()
+	start := now.UTC().Truncate(day).AddDate(0, 0, -(days - 1))
+
+	var uptime map[string][]StatusDay
+	reader, ok := a.controller.Storage().(StorageReader)
+	if index := a.controller.uptimeIndex(); ok && index != nil {
+		var err error
+		uptime, err = index.get(reader, now)
+		if err != nil {
+			a.logger.Errorf("reading uptime for status page: %v", err)
+		}
+	}
+
+	results := a.controller.Latest()
+	latest := make(map[string]types.Result, len(results))
+	for _, result := range results {
+		latest[result.Title] = result
+	}
+
+	check := func(title string) StatusFeedCheck {
+		result, ok := latest[title]
+		c := StatusFeedCheck{
+			Title:  title,
+			Status: types.StatusUnknown,
+			Days:   uptime[title],
+		}
+		if ok {
+			c.Type = result.Type
+			c.Status = result.Status()
+			if page.ShowMessages {
+				c.Message = result.Message
+			}
+			c.Timestamp = result.Timestamp
+		}
+		if c.Days == nil {
+			c.Days = statusDays(start, make([]dayCount, days))
+		}
+		var total, up float64
+		for _, day := range c.Days {
+			total += float64(day.Checks)
+			up += day.Uptime * float64(day.Checks) / 100
+		}
+		if total > 0 {
+			percent := 100 * up / total
+			c.Uptime = &percent
+		}
+		return c
+	}
+
+	feed := StatusFeed{
+		Title:   page.Title,
+		Logo:    page.Logo,
+		Status:  types.StatusUnknown,
+		Updated: now.UnixNano(),
+		Groups:  []StatusFeedGroup{},
+	}
+	add := func(name string, checks []StatusFeedCheck) {
+		group := StatusFeedGroup{Name: name, Status: types.StatusUnknown, Checks: checks}
+		for _, c := range checks {
+			if c.Status.PriorityOver(group.Status) {
+				group.Status = c.Status
+			}
+		}
+		if group.Status.PriorityOver(feed.Status) {
+			feed.Status = group.Status
+		}
+		feed.Groups = append(feed.Groups, group)
+	}
+
+	grouped := make(map[string]bool)
+	for _, group := range page.Groups {
+		var checks []StatusFeedCheck
+		for _, title := range group.Checks {
+			grouped[title] = true
+			checks = append(checks, check(title))
+		}
+		add(group.Name, checks)
+	}
+
+	byType := make(map[string][]StatusFeedCheck)
+	var checkTypes []string
+	for _, result := range results {
+		if grouped[result.Title] {
+			continue
+		}
+		if byType[result.Type] == nil {
+			checkTypes = append(checkTypes, result.Type)
+		}
+		byType[result.Type] = append(byType[result.Type], check(result.Title))
+	}
+	sort.Strings(checkTypes)
+	for _, t := range checkTypes {
+		add(t, byType[t])
+	}
+
+	return feed
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(statusPageHTML))
+
+// serveStatusPage serves the status page and its feed. It is
+// public, even with basic authentication enabled.
+func (a *APIServer) serveStatusPage(w http.ResponseWriter, r *http.Request) {
+	page := a.controller.StatusPage()
+	if page == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.URL.Path {
+	case StatusPagePath:
+		// the page fetches its feed relative to itself
+		http.Redirect(w, r, StatusPagePath+"/", http.StatusMovedPermanently)
+	case StatusPagePath + "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// The logo is trusted configuration, allow data: URLs
+		data := struct {
+			Title string
+			Logo  template.URL
+		}{page.Title, template.URL(page.Logo)}
+		if err := statusPageTemplate.Execute(w, data); err != nil {
+			a.logger.Errorf("rendering status page: %v", err)
+		}
+	case StatusPagePath + "/feed.json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := json.NewEncoder(w).Encode(a.statusFeed(page, time.Now())); err != nil {
+			a.logger.Errorf("writing status feed: %v", err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
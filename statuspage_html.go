@@ -0,0 +1,131 @@
+package checkup
+
+// statusPageHTML is the status page template, executed with the
+// title and logo of the StatusPage configuration. It renders
+// StatusPagePath/feed.json and must not load external assets.
+const statusPageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Title}}{{.Title}}{{else}}Status{{end}}</title>
+<style>
+  body { margin: 0; font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; background: #f5f6f8; color: #24292e; }
+  main { max-width: 880px; margin: 0 auto; padding: 32px 16px; }
+  header { display: flex; align-items: center; gap: 12px; margin-bottom: 24px; }
+  header img { max-height: 48px; }
+  header h1 { font-size: 24px; margin: 0; }
+  .banner { border-radius: 6px; padding: 16px 20px; color: #fff; font-size: 18px; font-weight: 600; margin-bottom: 32px; }
+  .group { background: #fff; border: 1px solid #e1e4e8; border-radius: 6px; margin-bottom: 24px; }
+  .group h2 { font-size: 16px; margin: 0; padding: 12px 20px; border-bottom: 1px solid #e1e4e8; display: flex; justify-content: space-between; }
+  .check { padding: 16px 20px; border-bottom: 1px solid #f0f1f3; }
+  .check:last-child { border-bottom: none; }
+  .check .head { display: flex; justify-content: space-between; margin-bottom: 8px; }
+  .check .title { font-weight: 600; }
+  .check .message { color: #586069; font-size: 13px; margin-bottom: 8px; }
+  .bar { display: flex; gap: 2px; height: 28px; }
+  .bar span { flex: 1; border-radius: 2px; }
+  .legend { display: flex; justify-content: space-between; color: #959da5; font-size: 12px; margin-top: 4px; }
+  .healthy { background: #2fcc66; }
+  .degraded { background: #f1c40f; }
+  .down { background: #e74c3c; }
+  .unknown { background: #d1d5da; }
+  .label { background: none; font-size: 14px; font-weight: 600; }
+  .label.healthy { color: #2fcc66; }
+  .label.degraded { color: #f1c40f; }
+  .label.down { color: #e74c3c; }
+  .label.unknown { color: #959da5; }
+  footer { color: #959da5; font-size: 12px; text-align: center; }
+</style>
+</head>
+<body>
+<main>
+  <header>
+    {{if .Logo}}<img src="{{.Logo}}" alt="">{{end}}
+    <h1>{{if .Title}}{{.Title}}{{else}}Status{{end}}</h1>
+  </header>
+  <div id="banner" class="banner unknown">Loading&hellip;</div>
+  <div id="groups"></div>
+  <footer id="updated"></footer>
+</main>
+<script>
+(function () {
+  var summaries = {
+    healthy: "All systems operational",
+    degraded: "Some systems are degraded",
+    down: "Some systems are down",
+    unknown: "Status unknown"
+  };
+
+  function el(tag, className, text) {
+    var e = document.createElement(tag);
+    if (className) { e.className = className; }
+    if (text !== undefined) { e.textContent = text; }
+    return e;
+  }
+
+  function render(feed) {
+    var banner = document.getElementById("banner");
+    banner.className = "banner " + feed.status;
+    banner.textContent = summaries[feed.status] || feed.status;
+
+    var groups = document.getElementById("groups");
+    groups.textContent = "";
+    feed.groups.forEach(function (group) {
+      var g = el("section", "group");
+      var h = el("h2");
+      h.appendChild(el("span", "", group.name));
+      h.appendChild(el("span", "label " + group.status, group.status));
+      g.appendChild(h);
+
+      group.checks.forEach(function (check) {
+        var c = el("div", "check");
+        var head = el("div", "head");
+        head.appendChild(el("span", "title", check.title));
+        head.appendChild(el("span", "label " + check.status, check.status));
+        c.appendChild(head);
+        if (check.message) {
+          c.appendChild(el("div", "message", check.message));
+        }
+
+        var bar = el("div", "bar");
+        check.days.forEach(function (day) {
+          var d = el("span", day.status);
+          d.title = day.date + ": " + (day.checks ? day.uptime.toFixed(2) + "% uptime" : "no data");
+          bar.appendChild(d);
+        });
+        c.appendChild(bar);
+
+        var legend = el("div", "legend");
+        legend.appendChild(el("span", "", check.days.length + " days ago"));
+        legend.appendChild(el("span", "", check.uptime === undefined ? "no data" : check.uptime.toFixed(2) + "% uptime"));
+        legend.appendChild(el("span", "", "Today"));
+        c.appendChild(legend);
+
+        g.appendChild(c);
+      });
+      groups.appendChild(g);
+    });
+
+    document.getElementById("updated").textContent =
+      "Last updated " + new Date(feed.updated / 1e6).toLocaleString();
+  }
+
+  function refresh() {
+    var xhr = new XMLHttpRequest();
+    xhr.open("GET", "feed.json");
+    xhr.onload = function () {
+      if (xhr.status === 200) {
+        render(JSON.parse(xhr.responseText));
+      }
+    };
+    xhr.send();
+  }
+
+  refresh();
+  setInterval(refresh, 60000);
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,159 @@
+package checkup
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+func TestUptimeIndex(t *testing.T) {
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	storage := &memStorage{files: map[string][]types.Result{}, index: map[string]int64{}}
+	for _, result := range []types.Result{
+		{Title: "Web", Healthy: true, Timestamp: today.UnixNano()},
+		{Title: "Web", Healthy: true, Timestamp: today.Add(time.Second).UnixNano()},
+		{Title: "Web", Healthy: true, Timestamp: today.Add(2 * time.Second).UnixNano()},
+		{Title: "Web", Down: true, Timestamp: today.Add(3 * time.Second).UnixNano()},
+		{Title: "Web", Degraded: true, Timestamp: today.AddDate(0, 0, -1).UnixNano()},
+		{Title: "Web", Down: true, Timestamp: today.AddDate(0, 0, -10).UnixNano()},
+	} {
+		storage.Store([]types.Result{result})
+	}
+
+	index := newUptimeIndex(3)
+	uptime, err := index.get(storage, now)
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	days := uptime["Web"]
+	if got, want := len(days), 3; got != want {
+		t.Fatalf("Expected %d days, got %d", want, got)
+	}
+	for i, want := range []StatusDay{
+		{Date: today.AddDate(0, 0, -2).Format("2006-01-02"), Status: types.StatusUnknown},
+		{Date: today.AddDate(0, 0, -1).Format("2006-01-02"), Status: types.StatusDegraded, Uptime: 100, Checks: 1},
+		{Date: today.Format("2006-01-02"), Status: types.StatusDown, Uptime: 75, Checks: 4},
+	} {
+		if got := days[i]; got != want {
+			t.Errorf("Day %d: Expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	// Stored results are counted without reading the storage again
+	fetched := storage.fetched
+	if err := index.store(storage, []types.Result{{Title: "Web", Down: true, Timestamp: now.UnixNano()}}); err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	uptime, _ = index.get(storage, now)
+	if got, want := uptime["Web"][2].Checks, 5; got != want {
+		t.Errorf("Expected %d checks today, got %d", want, got)
+	}
+	if got, want := uptime["Web"][2].Uptime, 60.0; got != want {
+		t.Errorf("Expected %v%% uptime today, got %v", want, got)
+	}
+	if storage.fetched != fetched {
+		t.Errorf("Expected no check files to be read again, %d were", storage.fetched-fetched)
+	}
+
+	// Days out of the index are forgotten
+	uptime, _ = index.get(storage, now.AddDate(0, 0, 3))
+	if _, ok := uptime["Web"]; ok {
+		t.Errorf("Expected uptime of old days to be forgotten, got %+v", uptime["Web"])
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	apiserver, err := NewAPIServer(Config{MetricsPath: "/metrics", BasicAuth: true, Username: "user"})
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	server := httptest.NewServer(apiserver.container)
+	defer server.Close()
+
+	// Disabled without configuration
+	resp, err := http.Get(server.URL + "/status/")
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("Expected status %d, got %d", want, got)
+	}
+
+	storage := &memStorage{files: map[string][]types.Result{}, index: map[string]int64{}}
+	storage.Store([]types.Result{{Title: "API", Type: "http", Down: true, Timestamp: time.Now().UnixNano()}})
+	apiserver.controller.setCheckup(Checkup{
+		Storage: storage,
+		StatusPage: &StatusPage{
+			Title:  "Example Status",
+			Logo:   "data:image/png;base64,AAAA",
+			Groups: []StatusPageGroup{{Name: "Public", Checks: []string{"Web", "Missing"}}},
+			Days:   7,
+		},
+	})
+	apiserver.controller.latest["Web"] = types.Result{Title: "Web", Type: "http", Healthy: true}
+	apiserver.controller.latest["API"] = types.Result{Title: "API", Type: "http", Down: true, Endpoint: "http://internal", Message: "dial tcp 10.0.0.1:80: connection refused"}
+	apiserver.controller.latest["DNS"] = types.Result{Title: "DNS", Type: "dns", Degraded: true}
+
+	// Public even with basic authentication
+	resp, err = http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatalf("Didn't expect an error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Errorf("Expected status %d, got %d", want, got)
+	}
+	if !strings.Contains(string(body), "<title>Example Status</title>") {
+		t.Errorf("Expected page to have the configured title")
+	}
+	if !strings.Contains(string(body), `src="data:image/png;base64,AAAA"`) {
+		t.Errorf("Expected page to have the configured logo")
+	}
+
+	var feed StatusFeed
+	getJSON(t, server.URL+"/status/feed.json", http.StatusOK, &feed)
+	if got, want := feed.Status, types.StatusDown; got != want {
+		t.Errorf("Expected feed status '%s', got '%s'", want, got)
+	}
+
+	var groups []string
+	for _, group := range feed.Groups {
+		groups = append(groups, group.Name+"="+string(group.Status))
+	}
+	if got, want := strings.Join(groups, ","), "Public=healthy,dns=degraded,http=down"; got != want {
+		t.Fatalf("Expected groups %s, got %s", want, got)
+	}
+
+	public := feed.Groups[0].Checks
+	if got, want := len(public), 2; got != want {
+		t.Fatalf("Expected %d checks, got %d", want, got)
+	}
+	if got, want := public[1].Status, types.StatusUnknown; got != want {
+		t.Errorf("Expected status '%s' for a check without results, got '%s'", want, got)
+	}
+	if got, want := len(public[0].Days), 7; got != want {
+		t.Errorf("Expected %d days, got %d", want, got)
+	}
+	if public[0].Uptime != nil {
+		t.Errorf("Expected no uptime without stored results, got %v", *public[0].Uptime)
+	}
+
+	api := feed.Groups[2].Checks[0]
+	if api.Message != "" {
+		t.Errorf("Expected no message without show_messages, got '%s'", api.Message)
+	}
+	if api.Uptime == nil || *api.Uptime != 0 {
+		t.Errorf("Expected 0%% uptime, got %v", api.Uptime)
+	}
+	if got, want := api.Days[6].Status, types.StatusDown; got != want {
+		t.Errorf("Expected today to be '%s', got '%s'", want, got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/feifeigood/checkup"
 	"github.com/feifeigood/checkup/types"
 )
 
@@ -41,6 +42,12 @@ type Storage struct {
 	CheckExpiry types.Duration `json:"check_expiry,omitempty"`
 }
 
+func init() {
+	checkup.RegisterStorage(Type, func(config json.RawMessage) (checkup.Storage, error) {
+		return New(config)
+	})
+}
+
 // New creates a new Storage instance base on json config
 func New(config json.RawMessage) (Storage, error) {
 	var storage Storage
@@ -53,6 +60,18 @@ func (Storage) Type() string {
 	return Type
 }
 
+// Validate implements checkup.Validator.
+func (fs Storage) Validate() error {
+	var errs types.Errors
+	if fs.Dir == "" {
+		errs = append(errs, types.NewValidationError("dir", "must not be empty"))
+	}
+	if fs.CheckExpiry.Duration < 0 {
+		errs = append(errs, types.NewValidationError("check_expiry", "must not be negative"))
+	}
+	return errs.Err()
+}
+
 // GetIndex returns the index from filesystem.
 func (fs Storage) GetIndex() (map[string]int64, error) {
 	return fs.readIndex()
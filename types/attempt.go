@@ -6,6 +6,48 @@ import "time"
 type Attempt struct {
 	RTT   time.Duration `json:"rtt"`
 	Error string        `json:"error,omitempty"`
+
+	// Steps are the parts of an attempt made of several
+	// exchanges, e.g. the hops of followed redirects.
+	Steps []Step `json:"steps,omitempty"`
+
+	// Timings break RTT down into phases, if the
+	// checker measures them.
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// Timings are the durations of the phases of a request. Phases
+// that did not happen, e.g. TLS for plain HTTP, are zero.
+type Timings struct {
+	// DNS is the time to resolve the host.
+	DNS time.Duration `json:"dns"`
+
+	// Connect is the time to establish the connection.
+	Connect time.Duration `json:"connect"`
+
+	// TLS is the time of the TLS handshake.
+	TLS time.Duration `json:"tls"`
+
+	// FirstByte is the time from writing the request to
+	// the first byte of the response.
+	FirstByte time.Duration `json:"first_byte"`
+
+	// Transfer is the time from the first byte of the
+	// response to reading all of it.
+	Transfer time.Duration `json:"transfer"`
+}
+
+// Step is one exchange within an Attempt.
+type Step struct {
+	// Name says what the step was, e.g. the URL requested.
+	Name string `json:"name"`
+
+	// Code is the status of the step if the protocol has
+	// one, e.g. the HTTP status code.
+	Code int `json:"code,omitempty"`
+
+	RTT   time.Duration `json:"rtt"`
+	Error string        `json:"error,omitempty"`
 }
 
 // Attempts is a list of Attempt that can be sorted by RTT.
@@ -10,7 +10,7 @@ func (e Errors) Error() string {
 	var errs []string
 	for _, err := range e {
 		if err != nil {
-			errs = append(errs, e.Error())
+			errs = append(errs, err.Error())
 		}
 	}
 
@@ -26,3 +26,11 @@ func (e Errors) Empty() bool {
 	}
 	return true
 }
+
+// Err returns e as an error, or nil if e is empty.
+func (e Errors) Err() error {
+	if e.Empty() {
+		return nil
+	}
+	return e
+}
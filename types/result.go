@@ -39,6 +39,11 @@ type Result struct {
 
 	// Message is a optional message to show
 	Message string `json:"message,omitempty"`
+
+	// Details holds checker-specific information about how
+	// the check was performed, e.g. the request method, to
+	// help debugging.
+	Details map[string]string `json:"details,omitempty"`
 }
 
 func NewResult() Result {
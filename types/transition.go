@@ -0,0 +1,38 @@
+package types
+
+import "time"
+
+// TransitionKind describes why a check is being notified.
+type TransitionKind string
+
+// Kinds of transitions passed to notifiers.
+const (
+	// TransitionDegraded means the check became degraded.
+	TransitionDegraded TransitionKind = "degraded"
+	// TransitionDown means the check went down.
+	TransitionDown TransitionKind = "down"
+	// TransitionRecovered means the check became healthy again.
+	TransitionRecovered TransitionKind = "recovered"
+	// TransitionRenotify means the check is still unhealthy
+	// and the renotify interval has elapsed.
+	TransitionRenotify TransitionKind = "renotify"
+)
+
+// Transition is a change in the status of a check, or a
+// reminder that it is still unhealthy.
+type Transition struct {
+	// Result is the result that caused the transition.
+	Result Result `json:"result"`
+
+	// Kind is the kind of transition.
+	Kind TransitionKind `json:"kind"`
+
+	// Previous is the status of the check before Result,
+	// StatusUnknown if the check had not been seen before.
+	Previous StatusText `json:"previous"`
+
+	// Duration is how long the check was in the Previous
+	// status, or for TransitionRenotify how long it has
+	// been in its current status.
+	Duration time.Duration `json:"duration"`
+}
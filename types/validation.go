@@ -0,0 +1,58 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is a problem with a configuration value.
+type ValidationError struct {
+	// Path is the JSON path of the value relative to the
+	// configuration being validated, e.g. endpoint_url or,
+	// from the top, checkers[3].endpoint_url.
+	Path string `json:"path"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// NewValidationError creates a ValidationError for the value
+// at path, formatting its message according to format.
+func NewValidationError(path, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the path and message of e.
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// JoinPath appends the JSON path elem to path.
+func JoinPath(path, elem string) string {
+	if path == "" || elem == "" || strings.HasPrefix(elem, "[") {
+		return path + elem
+	}
+	return path + "." + elem
+}
+
+// PrefixPath returns the errors in err with their paths prefixed
+// by prefix. Errors other than ValidationErrors are considered to
+// be about the value at prefix.
+func PrefixPath(prefix string, err error) Errors {
+	var errs Errors
+	switch e := err.(type) {
+	case nil:
+	case Errors:
+		for _, err := range e {
+			errs = append(errs, PrefixPath(prefix, err)...)
+		}
+	case *ValidationError:
+		errs = append(errs, &ValidationError{Path: JoinPath(prefix, e.Path), Message: e.Message})
+	default:
+		errs = append(errs, &ValidationError{Path: prefix, Message: err.Error()})
+	}
+	return errs
+}
@@ -0,0 +1,311 @@
+package checkup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+// Validator can check its own configuration. Checkers, storages
+// and notifiers implement it to report problems before they run.
+type Validator interface {
+	// Validate returns nil if the configuration is valid. Problems
+	// are preferably reported as types.Errors of *types.ValidationError
+	// with paths relative to the configuration of the implementation.
+	Validate() error
+}
+
+// Validate checks the JSON configuration in b. It returns every
+// problem found as types.Errors of *types.ValidationError, with
+// paths from the top of the configuration, or nil if it is valid.
+func Validate(b []byte) error {
+	var raw struct {
+		Checkers  []json.RawMessage `json:"checkers"`
+		Storage   json.RawMessage   `json:"storage"`
+		Notifiers []json.RawMessage `json:"notifiers"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return types.Errors{types.NewValidationError("", "%s", jsonErrorMessage(b, err))}
+	}
+
+	type checkup2 Checkup
+	var c Checkup
+	errs := decodeFields("", b, (*checkup2)(&c), "checkers", "storage", "notifiers")
+
+	if c.ConcurrentChecks < 0 {
+		errs = append(errs, types.NewValidationError("concurrent_checks", "must not be negative"))
+	}
+	if c.RenotifyInterval.Duration < 0 {
+		errs = append(errs, types.NewValidationError("renotify_interval", "must not be negative"))
+	}
+	if len(raw.Checkers) == 0 {
+		errs = append(errs, types.NewValidationError("checkers", "no checkers configured"))
+	}
+
+	titles := make(map[string]string)
+	for i, config := range raw.Checkers {
+		path := fmt.Sprintf("checkers[%d]", i)
+		errs = append(errs, validateConfig(path, "checker", config, func(typeName string) (interface{}, error) {
+			return checkerDecode(typeName, config)
+		})...)
+
+		title, key := checkerTitle(config)
+		if title == "" {
+			continue
+		}
+		if first, dup := titles[title]; dup {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, key), "duplicate title %q, also used by %s", title, first))
+			continue
+		}
+		titles[title] = path
+	}
+
+	if raw.Storage != nil {
+		errs = append(errs, validateConfig("storage", "storage", raw.Storage, func(typeName string) (interface{}, error) {
+			return storageDecode(typeName, raw.Storage)
+		})...)
+	}
+
+	for i, config := range raw.Notifiers {
+		errs = append(errs, validateConfig(fmt.Sprintf("notifiers[%d]", i), "notifier", config, func(typeName string) (interface{}, error) {
+			return notifierDecode(typeName, config)
+		})...)
+	}
+
+	if c.StatusPage != nil {
+		if c.StatusPage.Days < 0 {
+			errs = append(errs, types.NewValidationError("status_page.days", "must not be negative"))
+		}
+		for i, group := range c.StatusPage.Groups {
+			for j, title := range group.Checks {
+				if _, ok := titles[title]; !ok {
+					path := fmt.Sprintf("status_page.groups[%d].checks[%d]", i, j)
+					errs = append(errs, types.NewValidationError(path, "no checker titled %q", title))
+				}
+			}
+		}
+	}
+
+	return errs.Err()
+}
+
+// validateConfig validates the configuration at path of a checker,
+// storage or notifier, which decode creates given its type.
+func validateConfig(path, kind string, config json.RawMessage, decode func(typeName string) (interface{}, error)) types.Errors {
+	var typeInfo struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(config, &typeInfo); err != nil {
+		return types.Errors{types.NewValidationError(path, "%s", jsonErrorMessage(config, err))}
+	}
+	if typeInfo.Type == "" {
+		return types.Errors{types.NewValidationError(types.JoinPath(path, "type"), "missing %s type", kind)}
+	}
+	if !registered(kind, typeInfo.Type) {
+		return types.Errors{types.NewValidationError(types.JoinPath(path, "type"), "unknown %s type %q", kind, typeInfo.Type)}
+	}
+
+	v, err := decode(typeInfo.Type)
+	if rv := reflect.ValueOf(v); !rv.IsValid() || rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return types.PrefixPath(path, err)
+	}
+
+	// Decoding field by field reports each problem with its
+	// path, which the error of decode doesn't.
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fresh := reflect.New(t)
+	errs := decodeFields(path, config, fresh.Interface(), "type")
+	if len(errs) == 0 && err != nil {
+		return types.PrefixPath(path, err)
+	}
+
+	// v is incomplete if some fields could not be decoded,
+	// validate the fields that could be instead.
+	if len(errs) > 0 {
+		v = fresh.Interface()
+	}
+
+	validator, ok := v.(Validator)
+	if !ok {
+		return errs
+	}
+	reported := make(map[string]bool)
+	for _, err := range errs {
+		reported[err.(*types.ValidationError).Path] = true
+	}
+	validation := types.PrefixPath(path, validator.Validate())
+	sort.SliceStable(validation, func(i, j int) bool {
+		return validation[i].Error() < validation[j].Error()
+	})
+	for _, err := range validation {
+		if e, ok := err.(*types.ValidationError); ok && reported[e.Path] {
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// registered returns whether typeName is in the registry of kind.
+func registered(kind, typeName string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var ok bool
+	switch kind {
+	case "checker":
+		_, ok = checkers[typeName]
+	case "storage":
+		_, ok = storages[typeName]
+	case "notifier":
+		_, ok = notifiers[typeName]
+	}
+	return ok
+}
+
+// checkerTitle returns the title of the checker configured by
+// config and its key, which is name for exec checkers and
+// endpoint_name for the others.
+func checkerTitle(config json.RawMessage) (title, key string) {
+	var names struct {
+		EndpointName string `json:"endpoint_name"`
+		Name         string `json:"name"`
+	}
+	_ = json.Unmarshal(config, &names)
+	if names.EndpointName != "" {
+		return names.EndpointName, "endpoint_name"
+	}
+	return names.Name, "name"
+}
+
+// decodeFields decodes the JSON object raw into the struct v
+// points to one key at a time, so that unknown keys and bad
+// values are reported with their path. Keys in ignore are skipped.
+func decodeFields(path string, raw json.RawMessage, v interface{}, ignore ...string) types.Errors {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return types.Errors{types.NewValidationError(path, "%s", jsonErrorMessage(raw, err))}
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make(map[string]reflect.Value)
+	jsonFields(reflect.ValueOf(v).Elem(), fields)
+
+	var errs types.Errors
+keys:
+	for _, key := range keys {
+		for _, name := range ignore {
+			if key == name {
+				continue keys
+			}
+		}
+
+		field, ok := fields[key]
+		if !ok {
+			// encoding/json falls back to case-insensitive matching
+			for name, f := range fields {
+				if strings.EqualFold(name, key) {
+					field, ok = f, true
+					break
+				}
+			}
+		}
+		if !ok {
+			errs = append(errs, types.NewValidationError(types.JoinPath(path, key), "unknown field"))
+			continue
+		}
+
+		errs = append(errs, decodeValue(types.JoinPath(path, key), object[key], field)...)
+	}
+	return errs
+}
+
+// decodeValue decodes raw into v, which is at path. Arrays are
+// decoded one element at a time, so that errors, including those
+// of UnmarshalJSON methods, are reported with the index.
+func decodeValue(path string, raw json.RawMessage, v reflect.Value) types.Errors {
+	var elems []json.RawMessage
+	if v.Kind() == reflect.Slice && json.Unmarshal(raw, &elems) == nil && elems != nil {
+		var errs types.Errors
+		slice := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			errs = append(errs, decodeValue(types.JoinPath(path, fmt.Sprintf("[%d]", i)), elem, slice.Index(i))...)
+		}
+		v.Set(slice)
+		return errs
+	}
+
+	err := json.Unmarshal(raw, v.Addr().Interface())
+	if e, ok := err.(*json.UnmarshalTypeError); ok {
+		if e.Field != "" {
+			path = types.JoinPath(path, e.Field)
+		}
+		return types.Errors{types.NewValidationError(path, "cannot use %s as %s", e.Value, e.Type)}
+	} else if err != nil {
+		return types.Errors{types.NewValidationError(path, "%s", err)}
+	}
+	return nil
+}
+
+// jsonFields adds the exported fields of the struct v to fields
+// by their JSON name, including those of embedded structs which
+// come second like they do for encoding/json.
+func jsonFields(v reflect.Value, fields map[string]reflect.Value) {
+	t := v.Type()
+	var embedded []reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, v.Field(i))
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = v.Field(i)
+	}
+
+	for _, e := range embedded {
+		inner := make(map[string]reflect.Value)
+		jsonFields(e, inner)
+		for name, field := range inner {
+			if _, ok := fields[name]; !ok {
+				fields[name] = field
+			}
+		}
+	}
+}
+
+// jsonErrorMessage describes err from decoding data, with the
+// line and column of syntax errors.
+func jsonErrorMessage(data []byte, err error) string {
+	e, ok := err.(*json.SyntaxError)
+	if !ok {
+		return err.Error()
+	}
+	before := data[:e.Offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d, column %d: %s", line, column, e)
+}
@@ -0,0 +1,95 @@
+package checkup
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/feifeigood/checkup/types"
+)
+
+type validatedChecker struct {
+	fakeChecker
+	URL     string           `json:"endpoint_url"`
+	Timeout types.Duration   `json:"timeout,omitempty"`
+	Backoff []types.Duration `json:"backoff,omitempty"`
+}
+
+func (c *validatedChecker) Validate() error {
+	var errs types.Errors
+	if c.URL == "" {
+		errs = append(errs, types.NewValidationError("endpoint_url", "must not be empty"))
+	}
+	return errs.Err()
+}
+
+func init() {
+	RegisterChecker("validated", func(config json.RawMessage) (Checker, error) {
+		var c validatedChecker
+		err := json.Unmarshal(config, &c)
+		return &c, err
+	})
+}
+
+func TestValidate(t *testing.T) {
+	for i, test := range []struct {
+		config string
+		errs   []string
+	}{
+		{
+			config: `{"checkers": [{"type": "validated", "endpoint_name": "A", "endpoint_url": "a"}]}`,
+		},
+		{
+			config: `{"checkers": [`,
+			errs:   []string{"line 1, column 15: unexpected end of JSON input"},
+		},
+		{
+			config: `{"checkers": [
+				{"type": "validated", "endpoint_name": "A"},
+				{"type": "validated", "endpoint_name": "A", "endpoint_url": "a", "timeout": "1x", "extra": 1, "backoff": ["1s", "2x"]},
+				{"endpoint_name": "B"},
+				{"type": "missing"}
+			], "concurrent_checks": "1", "unknown": true}`,
+			errs: []string{
+				"concurrent_checks: cannot use string as int",
+				"unknown: unknown field",
+				"checkers[0].endpoint_url: must not be empty",
+				`checkers[1].backoff[1]: time: unknown unit "x" in duration "2x"`,
+				"checkers[1].extra: unknown field",
+				`checkers[1].timeout: time: unknown unit "x" in duration "1x"`,
+				`checkers[1].endpoint_name: duplicate title "A", also used by checkers[0]`,
+				"checkers[2].type: missing checker type",
+				`checkers[3].type: unknown checker type "missing"`,
+			},
+		},
+		{
+			config: `{"checkers": [{"type": "validated", "endpoint_name": "A", "endpoint_url": "a"}],
+				"status_page": {"groups": [{"name": "G", "checks": ["A", "B"]}]}}`,
+			errs: []string{`status_page.groups[0].checks[1]: no checker titled "B"`},
+		},
+	} {
+		err := Validate([]byte(test.config))
+		var got []string
+		if err != nil {
+			for _, e := range err.(types.Errors) {
+				got = append(got, e.Error())
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(test.errs, "\n") {
+			t.Errorf("Test %d: Expected errors:\n%s\ngot:\n%s", i, strings.Join(test.errs, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	var c Checkup
+	err := json.Unmarshal([]byte(`{"checkers": [{"type": "validated"}, {"type": "missing"}]}`), &c)
+	if err == nil || err.Error() != "checkers[1]: unknown checker type: missing" {
+		t.Errorf("Expected unknown type error for checkers[1], got %v", err)
+	}
+
+	err = json.Unmarshal([]byte(`{"concurrent_checks": "1"}`), &c)
+	if err == nil {
+		t.Errorf("Expected an error for a bad concurrent_checks")
+	}
+}